@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/gen2brain/avif"
+)
+
+const (
+	AVIF_QUALITY = 60
+	AVIF_SPEED   = 8 // 0 slowest and smallest, 10 fastest
+)
+
+// avifName - name of the AVIF variant of the image file
+func avifName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".avif"
+}
+
+// ensureAvif - encode the AVIF variant of the cached image, content-addressed files never change
+func ensureAvif(fileName string) error {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+	default:
+		return nil
+	}
+	dstPath := filepath.Join(config.ImageCache, avifName(fileName))
+	if _, err := os.Stat(dstPath); err == nil {
+		return nil
+	}
+
+	file, err := os.Open(filepath.Join(config.ImageCache, fileName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", fileName, err)
+	}
+	var buf bytes.Buffer
+	if err := avif.Encode(&buf, img, avif.Options{Quality: config.AvifQuality, QualityAlpha: config.AvifQuality, Speed: config.AvifSpeed}); err != nil {
+		return fmt.Errorf("encoding %s: %w", avifName(fileName), err)
+	}
+	return writeFileAtomic(dstPath, buf.Bytes())
+}
+
+// imageAvif - existing AVIF variant of the output image, empty if not encoded
+func imageAvif(imageUrl string) string {
+	fileName := cachedImageFile(imageUrl)
+	if fileName == "" {
+		return ""
+	}
+	name := avifName(fileName)
+	if _, err := os.Stat(filepath.Join(config.ImageCache, name)); err != nil {
+		return ""
+	}
+	return name
+}
@@ -0,0 +1,162 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const BASELINES_FILE = "baselines.json"
+
+// baseline sources
+const (
+	BASELINE_MANUAL = "manual"
+)
+
+// baselinePrice - everyday non-sale price of a pinned product
+type baselinePrice struct {
+	Price   float64   `json:"price"`
+	Source  string    `json:"source"`
+	Updated time.Time `json:"updated"`
+}
+
+// loadBaselines - load the baseline registry keyed by the pinned product name, a missing file is empty
+func loadBaselines(filename string) (map[string]baselinePrice, error) {
+	baselines := make(map[string]baselinePrice)
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return baselines, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &baselines); err != nil {
+		return nil, fmt.Errorf("[%s] %w", filename, err)
+	}
+	return baselines, nil
+}
+
+// saveBaselines - write the baseline registry atomically
+func saveBaselines(filename string, baselines map[string]baselinePrice) error {
+	content, err := json.MarshalIndent(baselines, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// applyBaselines - set the baseline price of the pinned offers
+func applyBaselines(goods []Goods, baselines map[string]baselinePrice) {
+	for i := range goods {
+		goods[i].Baseline = 0
+		if b, ok := baselines[goods[i].Pinned]; ok && goods[i].Pinned != "" {
+			goods[i].Baseline = b.Price
+		}
+	}
+}
+
+// savings - absolute and percentual savings of the offer against its baseline price
+func savings(item Goods) (float64, float64, bool) {
+	if item.Baseline <= 0 {
+		return 0, 0, false
+	}
+	price, ok := parsePrice(item.Price)
+	if !ok {
+		return 0, 0, false
+	}
+	absolute := item.Baseline - price
+	percent := absolute / item.Baseline * 100
+	return math.Round(absolute*100) / 100, math.Round(percent*10) / 10, true
+}
+
+// isPinnedName - check if the name is a configured pinned product
+func isPinnedName(name string) bool {
+	for _, pin := range config.PinnedProducts {
+		if pin.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// runBaseline - list, set or remove baseline prices of the pinned products
+func runBaseline(args []string) error {
+	flags := flag.NewFlagSet("baseline", flag.ExitOnError)
+	filename := flags.String("file", statePath(config.BaselinesFile), "baseline registry")
+	positional := parseInterspersed(flags, args)
+	action := ""
+	if len(positional) > 0 {
+		action = positional[0]
+	}
+
+	baselines, err := loadBaselines(*filename)
+	if err != nil {
+		return err
+	}
+
+	switch action {
+	case "", "list":
+		var names []string
+		for _, pin := range config.PinnedProducts {
+			names = append(names, pin.Name)
+		}
+		for name := range baselines {
+			if !isPinnedName(name) {
+				names = append(names, name)
+			}
+		}
+		newCollator().SortStrings(names)
+		for _, name := range names {
+			b, ok := baselines[name]
+			switch {
+			case !ok:
+				fmt.Printf("%-30s %10s\n", name, "-")
+			case !isPinnedName(name):
+				fmt.Printf("%-30s %10.2f  %s %s (not pinned)\n", name, b.Price, b.Source, b.Updated.Format("2006-01-02"))
+			default:
+				fmt.Printf("%-30s %10.2f  %s %s\n", name, b.Price, b.Source, b.Updated.Format("2006-01-02"))
+			}
+		}
+		return nil
+
+	case "set":
+		if len(positional) != 3 {
+			return fmt.Errorf("%w: koopi baseline set <pinned product> <price>", errUsage)
+		}
+		name := strings.TrimSpace(positional[1])
+		price, err := strconv.ParseFloat(strings.Replace(positional[2], ",", ".", 1), 64)
+		if err != nil || price <= 0 {
+			return fmt.Errorf("invalid price %q", positional[2])
+		}
+		if !isPinnedName(name) {
+			log.Printf("⚠️ %q is not a pinned product, the baseline is unused until pinned", name)
+		}
+		baselines[name] = baselinePrice{Price: price, Source: BASELINE_MANUAL, Updated: time.Now()}
+		if err := saveBaselines(*filename, baselines); err != nil {
+			return err
+		}
+		log.Printf("📌 %s baseline %.2f", name, price)
+		return nil
+
+	case "rm":
+		if len(positional) != 2 {
+			return fmt.Errorf("%w: koopi baseline rm <pinned product>", errUsage)
+		}
+		name := strings.TrimSpace(positional[1])
+		if _, ok := baselines[name]; !ok {
+			return fmt.Errorf("no baseline for %q", name)
+		}
+		delete(baselines, name)
+		return saveBaselines(*filename, baselines)
+	}
+	return fmt.Errorf("unknown action %q, use list | set | rm", action)
+}
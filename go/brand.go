@@ -0,0 +1,62 @@
+package main
+
+import (
+	"sort"
+	"strings"
+)
+
+// knownBrands - manufacturers recognized anywhere in the name, config.Brands are added
+var knownBrands = []string{
+	"Activia", "Albert Excellent", "Budweiser Budvar", "Bernard", "Coca-Cola", "Danone", "Emco", "Gambrinus",
+	"Hamé", "Hollandia", "Jacobs", "Jihočeské", "Kofola", "Kostelecké uzeniny", "Krušovice", "Lavazza",
+	"Lipánek", "Madeta", "Mattoni", "Milbona", "Milka", "Nescafé", "Nestlé", "Olma", "Opavia", "Orion", "Pepsi",
+	"Pilsner Urquell", "Président", "Rajec", "Radegast", "Relax", "Rio Mare", "Staropramen", "Starobrno",
+	"Tatra", "Tchibo", "Velkopopovický Kozel", "Vitana", "Zlatý Bažant",
+}
+
+// brandDictionary - known brands as lowercase words, longest first
+var brandDictionary [][]string
+
+// prepareBrands - build the dictionary of the known and the configured brands
+func prepareBrands(brands []string) {
+	brandDictionary = nil
+	for _, brand := range append(append([]string{}, knownBrands...), brands...) {
+		if words := brandWords(brand); len(words) > 0 {
+			brandDictionary = append(brandDictionary, words)
+		}
+	}
+	sort.SliceStable(brandDictionary, func(i, j int) bool { return len(brandDictionary[i]) > len(brandDictionary[j]) })
+}
+
+// brandWords - words of the name, hyphens kept (names use non-breaking hyphens)
+func brandWords(name string) []string {
+	return strings.Fields(strings.ToLower(strings.ReplaceAll(name, "‑", "-")))
+}
+
+// detectBrand - known brand in the product name, "" when none; capitalized words are product types and places
+// as often as brands, e.g. "Sýr Eidam" or "Chléb Šumava", so only the dictionary is trusted
+//
+//	"Pivo Pilsner Urquell 12" -> "Pilsner Urquell"
+//	"Sýr Eidam Milbona 30%"   -> "Milbona"
+func detectBrand(name string) string {
+	original := strings.Fields(strings.ReplaceAll(name, "‑", "-"))
+	words := brandWords(name)
+	for i := range words {
+		for _, brand := range brandDictionary {
+			if i+len(brand) <= len(words) && equalWords(words[i:i+len(brand)], brand) {
+				return strings.Join(original[i:i+len(brand)], " ")
+			}
+		}
+	}
+	return ""
+}
+
+// equalWords - same words
+func equalWords(a []string, b []string) bool {
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
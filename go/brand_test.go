@@ -0,0 +1,27 @@
+package main
+
+import "testing"
+
+func TestDetectBrand(t *testing.T) {
+	defer prepareBrands(nil)
+	prepareBrands([]string{"Pražské pekárny"})
+	tests := []struct {
+		name  string
+		brand string
+	}{
+		{"Pivo Pilsner Urquell 12", "Pilsner Urquell"},
+		{"Sýr Eidam Milbona 30%", "Milbona"},
+		{"Chléb Šumava", ""},
+		{"Sýr Eidam 30%", ""},
+		{"Mléko", ""},
+		{"Káva Nescafé Gold", "Nescafé"},
+		{"Coca‑Cola Zero", "Coca-Cola"}, // non-breaking hyphen of the site
+		{"Chléb Pražské pekárny kmínový", "Pražské pekárny"},
+		{"Pivo Velkopopovický Kozel 11", "Velkopopovický Kozel"},
+	}
+	for _, tt := range tests {
+		if brand := detectBrand(tt.name); brand != tt.brand {
+			t.Errorf("%q: %q, want %q", tt.name, brand, tt.brand)
+		}
+	}
+}
@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+const (
+	CACHE_TTL         = 12 * time.Hour
+	CACHE_META_SUFFIX = ".meta.json"
+	CACHE_GZ_SUFFIX   = ".gz"
+	CACHE_MANIFEST    = "manifest.json"
+)
+
+// cache backends
+const (
+	CACHE_FILES = "files" // one file per page in HtmlCache
+	CACHE_BOLT  = "bolt"  // single Bolt database, compressed bodies
+)
+
+// file cache layouts
+const (
+	CACHE_LAYOUT_FLAT  = "flat"  // all pages in HtmlCache
+	CACHE_LAYOUT_QUERY = "query" // HtmlCache/<query>/
+	CACHE_LAYOUT_DATE  = "date"  // HtmlCache/<fetch date>/
+)
+
+var (
+	errCacheExpired = errors.New("cache entry expired")
+	errCacheStatus  = errors.New("cached page is not a 200 response")
+)
+
+// response headers kept in the cache metadata
+var cachedHeaders = []string{"Content-Type", "Content-Length", "Last-Modified", "ETag", "Date", "Cache-Control", "Server"}
+
+// cacheMeta - metadata stored with each cached page
+type cacheMeta struct {
+	Url       string            `json:"url"`
+	Query     string            `json:"query"`
+	Status    int               `json:"status"` // 0 = unknown (legacy entries)
+	Headers   map[string]string `json:"headers,omitempty"`
+	FetchTime time.Time         `json:"fetch_time"`
+}
+
+// newCacheMeta - metadata of a successfully downloaded page
+func newCacheMeta(pageUrl string, query string, header http.Header, fetchTime time.Time) cacheMeta {
+	meta := cacheMeta{Url: pageUrl, Query: query, Status: http.StatusOK, FetchTime: fetchTime}
+	for _, name := range cachedHeaders {
+		if value := header.Get(name); value != "" {
+			if meta.Headers == nil {
+				meta.Headers = make(map[string]string)
+			}
+			meta.Headers[name] = value
+		}
+	}
+	return meta
+}
+
+// cacheEntry - cached page as listed by the backend
+type cacheEntry struct {
+	Name string
+	Meta cacheMeta
+	Size int64     // stored size including metadata
+	Used time.Time // last load or save, zero if unknown
+}
+
+// cacheBackend - storage of the cached HTML pages
+type cacheBackend interface {
+	Load(cacheName string) ([]byte, cacheMeta, error)
+	Save(cacheName string, meta cacheMeta, content []byte) error
+	Rename(oldName string, newName string) error
+	List() ([]cacheEntry, error)
+	Delete(cacheName string) error
+	Close() error
+}
+
+// current HTML cache, see openHtmlCache
+var htmlCache cacheBackend = &fileCache{}
+
+// openHtmlCache - open the configured cache backend
+func openHtmlCache() error {
+	switch config.CacheBackend {
+	case CACHE_FILES:
+		cache, err := openFileCache(config.HtmlCache)
+		if err != nil {
+			return fmt.Errorf("[%s] opening cache: %w", config.HtmlCache, err)
+		}
+		htmlCache = cache
+	case CACHE_BOLT:
+		if config.CacheDb == "" {
+			config.CacheDb = filepath.Join(config.HtmlCache, CACHE_DB)
+		}
+		cache, err := openBoltCache(config.CacheDb)
+		if err != nil {
+			return fmt.Errorf("[%s] opening cache database: %w", config.CacheDb, err)
+		}
+		htmlCache = cache
+	default:
+		return fmt.Errorf("invalid cache backend %q", config.CacheBackend)
+	}
+	return nil
+}
+
+// closeHtmlCache - close the cache backend, scraping runs enforce the size limits first
+func closeHtmlCache() {
+	if cacheLimitsOnClose {
+		enforceCacheLimits()
+		cacheLimitsOnClose = false
+	}
+	if err := htmlCache.Close(); err != nil {
+		fmt.Printf("💥 error closing cache: %v\n", err)
+	}
+	htmlCache = &fileCache{}
+}
+
+// saveHtmlToCache - save HTML and its metadata to the cache
+func saveHtmlToCache(cacheName string, meta cacheMeta, content []byte, qlog *queryLogger) {
+	if err := htmlCache.Save(cacheName, meta, content); err != nil {
+		qlog.Printf("[%s] 💥 error saving to cache: %v", cacheName, err)
+		return
+	}
+	qlog.Printf("💾 saved to cache %s (%d bytes)", cacheName, len(content))
+}
+
+// loadHtmlFromCache - load HTML from the cache, expired entries are misses (except offline)
+func loadHtmlFromCache(cacheName string) ([]byte, cacheMeta, error) {
+	content, meta, err := htmlCache.Load(cacheName)
+	if err != nil {
+		return nil, meta, err
+	}
+	if meta.Status != 0 && meta.Status != http.StatusOK {
+		return nil, meta, fmt.Errorf("%w: %d", errCacheStatus, meta.Status)
+	}
+	if !offlineMode && config.CacheTtl > 0 && time.Since(meta.FetchTime) > time.Duration(config.CacheTtl) {
+		return nil, meta, errCacheExpired
+	}
+	return content, meta, nil
+}
+
+// gzipBytes - compress the content
+func gzipBytes(content []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write(content); err != nil {
+		return nil, err
+	}
+	if err := zw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// gunzipBytes - decompress the content
+func gunzipBytes(compressed []byte) ([]byte, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	return io.ReadAll(zr)
+}
+
+// cacheKeyFor - readable query prefix with the URL hash, e.g. "pivo-10-1-3f9a1c2b.html"
+func cacheKeyFor(query string, pageNum int, pageUrl string) string {
+	hash := sha256.Sum256([]byte(pageUrl))
+	return fmt.Sprintf("%s-%d-%s.html", cacheSlug(query), pageNum, hex.EncodeToString(hash[:4]))
+}
+
+// legacyCacheKey - cache key built from the raw query, before cacheKeyFor
+func legacyCacheKey(query string, pageNum int) string {
+	return fmt.Sprintf("%s-%d.html", strings.ReplaceAll(query, " ", "-"), pageNum)
+}
+
+// cacheSlug - filesystem friendly form of the query
+func cacheSlug(query string) string {
+	slug := strings.Map(func(r rune) rune {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			return unicode.ToLower(r)
+		}
+		return '-'
+	}, query)
+	for strings.Contains(slug, "--") {
+		slug = strings.ReplaceAll(slug, "--", "-")
+	}
+	slug = strings.Trim(slug, "-")
+	if slug == "" {
+		slug = "query"
+	}
+	return slug
+}
+
+// migrateCacheKey - rename the legacy desktop and mobile entries, returns the number of moved entries
+func migrateCacheKey(oldName string, newName string) int {
+	moved := 0
+	for _, names := range [][2]string{{oldName, newName}, {mobileCacheName(oldName), mobileCacheName(newName)}} {
+		err := htmlCache.Rename(names[0], names[1])
+		if err == nil {
+			moved++
+		} else if !os.IsNotExist(err) && !os.IsExist(err) {
+			log.Printf("[%s] 💥 error migrating cache entry: %v", names[0], err)
+		}
+	}
+	return moved
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+const CACHE_DB = "cache.db"
+
+var (
+	boltPages = []byte("pages")
+	boltMeta  = []byte("meta")
+	boltUsed  = []byte("used") // last use for the LRU eviction
+)
+
+// boltRecord - metadata of the entry, keys are hashes so the name is kept here
+type boltRecord struct {
+	Name string `json:"name"`
+	cacheMeta
+}
+
+// boltCache - pages stored gzipped in a single Bolt database
+type boltCache struct {
+	db *bolt.DB
+}
+
+// openBoltCache - open or create the cache database
+func openBoltCache(filename string) (*boltCache, error) {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return nil, err
+	}
+	db, err := bolt.Open(filename, 0644, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		for _, name := range [][]byte{boltPages, boltMeta, boltUsed} {
+			if _, err := tx.CreateBucketIfNotExists(name); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &boltCache{db: db}, nil
+}
+
+// boltKey - database key of the cache entry
+func boltKey(cacheName string) []byte {
+	hash := sha256.Sum256([]byte(cacheName))
+	return hash[:]
+}
+
+// Save - store the compressed page and its metadata
+func (c *boltCache) Save(cacheName string, meta cacheMeta, content []byte) error {
+	compressed, err := gzipBytes(content)
+	if err != nil {
+		return err
+	}
+	metaBytes, err := json.Marshal(boltRecord{cacheName, meta})
+	if err != nil {
+		return err
+	}
+	key := boltKey(cacheName)
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.Bucket(boltPages).Put(key, compressed); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltMeta).Put(key, metaBytes); err != nil {
+			return err
+		}
+		return putUsed(tx, key, time.Now())
+	})
+}
+
+// putUsed - record the last use of the entry
+func putUsed(tx *bolt.Tx, key []byte, used time.Time) error {
+	value, err := used.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	return tx.Bucket(boltUsed).Put(key, value)
+}
+
+// getUsed - last use of the entry, zero if unknown
+func getUsed(tx *bolt.Tx, key []byte) time.Time {
+	var used time.Time
+	if value := tx.Bucket(boltUsed).Get(key); value != nil {
+		used.UnmarshalBinary(value)
+	}
+	return used
+}
+
+// Load - read and decompress the page
+func (c *boltCache) Load(cacheName string) ([]byte, cacheMeta, error) {
+	var record boltRecord
+	var compressed []byte
+	key := boltKey(cacheName)
+	err := c.db.View(func(tx *bolt.Tx) error {
+		page := tx.Bucket(boltPages).Get(key)
+		if page == nil {
+			return os.ErrNotExist
+		}
+		compressed = bytes.Clone(page)
+		return json.Unmarshal(tx.Bucket(boltMeta).Get(key), &record)
+	})
+	if err != nil {
+		return nil, record.cacheMeta, err
+	}
+	content, err := gunzipBytes(compressed)
+	if err == nil {
+		c.db.Batch(func(tx *bolt.Tx) error {
+			return putUsed(tx, key, time.Now())
+		})
+	}
+	return content, record.cacheMeta, err
+}
+
+// Rename - move the entry, existing target entries are kept
+func (c *boltCache) Rename(oldName string, newName string) error {
+	oldKey, newKey := boltKey(oldName), boltKey(newName)
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltPages).Get(oldKey) == nil {
+			return os.ErrNotExist
+		}
+		if tx.Bucket(boltPages).Get(newKey) != nil {
+			return os.ErrExist
+		}
+		var record boltRecord
+		if err := json.Unmarshal(tx.Bucket(boltMeta).Get(oldKey), &record); err != nil {
+			return err
+		}
+		record.Name = newName
+		metaBytes, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltPages).Put(newKey, bytes.Clone(tx.Bucket(boltPages).Get(oldKey))); err != nil {
+			return err
+		}
+		if err := tx.Bucket(boltMeta).Put(newKey, metaBytes); err != nil {
+			return err
+		}
+		if used := getUsed(tx, oldKey); !used.IsZero() {
+			if err := putUsed(tx, newKey, used); err != nil {
+				return err
+			}
+		}
+		return c.delete(tx, oldKey)
+	})
+}
+
+// List - all entries with their compressed sizes
+func (c *boltCache) List() ([]cacheEntry, error) {
+	var entries []cacheEntry
+	err := c.db.View(func(tx *bolt.Tx) error {
+		pages := tx.Bucket(boltPages)
+		return tx.Bucket(boltMeta).ForEach(func(key, value []byte) error {
+			var record boltRecord
+			if err := json.Unmarshal(value, &record); err != nil {
+				return err
+			}
+			entries = append(entries, cacheEntry{
+				Name: record.Name,
+				Meta: record.cacheMeta,
+				Size: int64(len(pages.Get(key)) + len(value)),
+				Used: getUsed(tx, key),
+			})
+			return nil
+		})
+	})
+	return entries, err
+}
+
+// Delete - remove the entry
+func (c *boltCache) Delete(cacheName string) error {
+	key := boltKey(cacheName)
+	return c.db.Update(func(tx *bolt.Tx) error {
+		if tx.Bucket(boltPages).Get(key) == nil {
+			return os.ErrNotExist
+		}
+		return c.delete(tx, key)
+	})
+}
+
+// delete - remove the entry from all buckets
+func (c *boltCache) delete(tx *bolt.Tx, key []byte) error {
+	if err := tx.Bucket(boltPages).Delete(key); err != nil {
+		return err
+	}
+	if err := tx.Bucket(boltUsed).Delete(key); err != nil {
+		return err
+	}
+	return tx.Bucket(boltMeta).Delete(key)
+}
+
+// Close - close the database
+func (c *boltCache) Close() error {
+	return c.db.Close()
+}
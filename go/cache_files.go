@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// suffix of the hash-based cache keys, see cacheKeyFor
+var reCacheKeySuffix = regexp.MustCompile(`-\d+-[0-9a-f]{8}\.html$`)
+
+// manifestEntry - index record of the cache entry, Dir is relative to HtmlCache
+type manifestEntry struct {
+	Dir       string    `json:"dir"`
+	Query     string    `json:"query,omitempty"`
+	Size      int64     `json:"size"`
+	FetchTime time.Time `json:"fetch_time"`
+	Used      time.Time `json:"used,omitzero"`
+}
+
+// fileCache - pages as files in HtmlCache with metadata sidecars,
+// the manifest maps the entries to the layout subdirectories
+type fileCache struct {
+	root     string
+	mutex    sync.Mutex
+	manifest map[string]manifestEntry
+	dirty    bool
+}
+
+// openFileCache - load the manifest of the cache directory
+func openFileCache(root string) (*fileCache, error) {
+	c := &fileCache{root: root, manifest: make(map[string]manifestEntry)}
+	content, err := os.ReadFile(filepath.Join(root, CACHE_MANIFEST))
+	if os.IsNotExist(err) {
+		return c, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &c.manifest); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// layoutDir - subdirectory of the entry for the configured layout
+func layoutDir(cacheName string, fetchTime time.Time) string {
+	switch config.CacheLayout {
+	case CACHE_LAYOUT_QUERY:
+		name := strings.TrimPrefix(cacheName, LAYOUT_MOBILE+"-")
+		return reCacheKeySuffix.ReplaceAllString(name, "")
+	case CACHE_LAYOUT_DATE:
+		return fetchTime.Format("2006-01-02")
+	}
+	return ""
+}
+
+// path - file path of the entry without suffixes, unknown entries are flat
+func (c *fileCache) path(cacheName string) string {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	return filepath.Join(c.root, c.manifest[cacheName].Dir, cacheName)
+}
+
+// setEntry - record the entry in the manifest
+func (c *fileCache) setEntry(cacheName string, entry manifestEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if old, ok := c.manifest[cacheName]; !ok || old != entry {
+		c.manifest[cacheName] = entry
+		c.dirty = true
+	}
+}
+
+// touch - record the use of the entry for the LRU eviction
+func (c *fileCache) touch(cacheName string) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if entry, ok := c.manifest[cacheName]; ok {
+		entry.Used = time.Now()
+		c.manifest[cacheName] = entry
+		c.dirty = true
+	}
+}
+
+// Save - write the page (gzipped if configured) and its metadata sidecar
+func (c *fileCache) Save(cacheName string, meta cacheMeta, content []byte) error {
+	oldPath := c.path(cacheName)
+	dir := layoutDir(cacheName, meta.FetchTime)
+	filePath := filepath.Join(c.root, dir, cacheName)
+	if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+		return err
+	}
+	if oldPath != filePath {
+		removeCacheFiles(oldPath)
+		if oldDir := filepath.Dir(oldPath); oldDir != c.root {
+			os.Remove(oldDir) // only if empty
+		}
+	}
+	size := int64(len(content))
+	if config.CacheGzip {
+		compressed, err := gzipBytes(content)
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(filePath+CACHE_GZ_SUFFIX, compressed, 0644); err != nil {
+			return err
+		}
+		size = int64(len(compressed))
+		os.Remove(filePath) // drop the stale uncompressed copy
+	} else {
+		if err := os.WriteFile(filePath, content, 0644); err != nil {
+			return err
+		}
+		os.Remove(filePath + CACHE_GZ_SUFFIX)
+	}
+	metaBytes, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filePath+CACHE_META_SUFFIX, metaBytes, 0644); err != nil {
+		return err
+	}
+	c.setEntry(cacheName, manifestEntry{dir, meta.Query, size + int64(len(metaBytes)), meta.FetchTime, time.Now()})
+	return nil
+}
+
+// Load - read the gzipped or plain page, entries without a sidecar use the file time
+func (c *fileCache) Load(cacheName string) ([]byte, cacheMeta, error) {
+	content, meta, err := c.load(cacheName)
+	if err == nil {
+		c.touch(cacheName)
+	}
+	return content, meta, err
+}
+
+// load - read the entry files
+func (c *fileCache) load(cacheName string) ([]byte, cacheMeta, error) {
+	filePath := c.path(cacheName)
+	var meta cacheMeta
+	if metaBytes, err := os.ReadFile(filePath + CACHE_META_SUFFIX); err == nil {
+		if err := json.Unmarshal(metaBytes, &meta); err != nil {
+			return nil, meta, err
+		}
+	}
+	if compressed, err := os.ReadFile(filePath + CACHE_GZ_SUFFIX); err == nil {
+		if meta.FetchTime.IsZero() {
+			if info, err := os.Stat(filePath + CACHE_GZ_SUFFIX); err == nil {
+				meta.FetchTime = info.ModTime()
+			}
+		}
+		content, err := gunzipBytes(compressed)
+		return content, meta, err
+	}
+	if meta.FetchTime.IsZero() {
+		if info, err := os.Stat(filePath); err == nil {
+			meta.FetchTime = info.ModTime()
+		}
+	}
+	content, err := os.ReadFile(filePath)
+	return content, meta, err
+}
+
+// Rename - move all files of the entry, existing target entries are kept
+func (c *fileCache) Rename(oldName string, newName string) error {
+	oldPath := c.path(oldName)
+	dir := layoutDir(newName, time.Now())
+	if config.CacheLayout == CACHE_LAYOUT_DATE {
+		dir, _ = filepath.Rel(c.root, filepath.Dir(oldPath))
+	}
+	newPath := filepath.Join(c.root, dir, newName)
+	if cacheFilesExist(newPath) || cacheFilesExist(c.path(newName)) {
+		return os.ErrExist
+	}
+	if err := os.MkdirAll(filepath.Dir(newPath), 0755); err != nil {
+		return err
+	}
+	renamed := false
+	for _, suffix := range cacheSuffixes {
+		err := os.Rename(oldPath+suffix, newPath+suffix)
+		if err == nil {
+			renamed = true
+		} else if !os.IsNotExist(err) {
+			return err
+		}
+	}
+	if !renamed {
+		return os.ErrNotExist
+	}
+	c.mutex.Lock()
+	entry := c.manifest[oldName]
+	delete(c.manifest, oldName)
+	c.mutex.Unlock()
+	entry.Dir = dir
+	c.setEntry(newName, entry)
+	return nil
+}
+
+// List - walk the cache directory, the entries are grouped by their files
+func (c *fileCache) List() ([]cacheEntry, error) {
+	byPath := make(map[string]*cacheEntry)
+	var order []string
+	err := filepath.WalkDir(c.root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		base := path
+		for _, suffix := range []string{CACHE_GZ_SUFFIX, CACHE_META_SUFFIX} {
+			base = strings.TrimSuffix(base, suffix)
+		}
+		if !strings.HasSuffix(base, ".html") {
+			return nil // manifest, cookies, database
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		entry, ok := byPath[base]
+		if !ok {
+			entry = &cacheEntry{Name: filepath.Base(base)}
+			byPath[base] = entry
+			order = append(order, base)
+		}
+		entry.Size += info.Size()
+		if entry.Meta.FetchTime.IsZero() || info.ModTime().Before(entry.Meta.FetchTime) {
+			entry.Meta.FetchTime = info.ModTime()
+		}
+		return nil
+	})
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]cacheEntry, 0, len(order))
+	for _, base := range order {
+		entry := byPath[base]
+		if metaBytes, err := os.ReadFile(base + CACHE_META_SUFFIX); err == nil {
+			var meta cacheMeta
+			if json.Unmarshal(metaBytes, &meta) == nil {
+				entry.Meta = meta
+			}
+		}
+		if dir, err := filepath.Rel(c.root, filepath.Dir(base)); err == nil {
+			if dir == "." {
+				dir = ""
+			}
+			c.mutex.Lock()
+			entry.Used = c.manifest[entry.Name].Used
+			c.mutex.Unlock()
+			c.setEntry(entry.Name, manifestEntry{dir, entry.Meta.Query, entry.Size, entry.Meta.FetchTime, entry.Used}) // repair the manifest
+		}
+		entries = append(entries, *entry)
+	}
+	return entries, nil
+}
+
+// Delete - remove all files of the entry
+func (c *fileCache) Delete(cacheName string) error {
+	filePath := c.path(cacheName)
+	if !cacheFilesExist(filePath) {
+		return os.ErrNotExist
+	}
+	removeCacheFiles(filePath)
+	if dir := filepath.Dir(filePath); dir != c.root {
+		os.Remove(dir) // only if empty
+	}
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if _, ok := c.manifest[cacheName]; ok {
+		delete(c.manifest, cacheName)
+		c.dirty = true
+	}
+	return nil
+}
+
+// Close - save the manifest if changed
+func (c *fileCache) Close() error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if !c.dirty {
+		return nil
+	}
+	content, err := json.Marshal(c.manifest)
+	if err != nil {
+		return err
+	}
+	manifestPath := filepath.Join(c.root, CACHE_MANIFEST)
+	if err := os.WriteFile(manifestPath+".tmp", content, 0644); err != nil {
+		return err
+	}
+	c.dirty = false
+	return os.Rename(manifestPath+".tmp", manifestPath)
+}
+
+// files of one cache entry
+var cacheSuffixes = []string{"", CACHE_GZ_SUFFIX, CACHE_META_SUFFIX}
+
+// removeCacheFiles - remove all files of the entry
+func removeCacheFiles(filePath string) {
+	for _, suffix := range cacheSuffixes {
+		os.Remove(filePath + suffix)
+	}
+}
+
+// cacheFilesExist - check if any file of the entry exists
+func cacheFilesExist(filePath string) bool {
+	for _, suffix := range cacheSuffixes {
+		if _, err := os.Stat(filePath + suffix); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// the contract of the cache backends: save, load, rename, list, delete, reopen
+func TestCacheBackends(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.CacheLayout = CACHE_LAYOUT_FLAT
+
+	backends := []struct {
+		name string
+		open func(dir string) (cacheBackend, error)
+	}{
+		{CACHE_FILES, func(dir string) (cacheBackend, error) { return openFileCache(dir) }},
+		{CACHE_BOLT, func(dir string) (cacheBackend, error) { return openBoltCache(filepath.Join(dir, CACHE_DB)) }},
+	}
+	for _, backend := range backends {
+		t.Run(backend.name, func(t *testing.T) {
+			dir := t.TempDir()
+			cache, err := backend.open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			meta := cacheMeta{Url: KOOPI_SEARCH_URL + "pivo", Query: "pivo", Status: 200,
+				Headers: map[string]string{"Content-Type": "text/html"}, FetchTime: time.Date(2025, 1, 15, 10, 0, 0, 0, time.UTC)}
+			content := []byte("<html>pivo</html>")
+			if err := cache.Save("pivo-1.html", meta, content); err != nil {
+				t.Fatal(err)
+			}
+			got, gotMeta, err := cache.Load("pivo-1.html")
+			if err != nil || string(got) != string(content) || !gotMeta.FetchTime.Equal(meta.FetchTime) || gotMeta.Query != "pivo" || gotMeta.Status != 200 {
+				t.Errorf("Load = %q %+v %v, want the saved page", got, gotMeta, err)
+			}
+			if _, _, err := cache.Load("missing.html"); err == nil {
+				t.Error("Load of a missing entry passed")
+			}
+
+			if err := cache.Rename("pivo-1.html", "pivo-1-0123abcd.html"); err != nil {
+				t.Fatal(err)
+			}
+			if _, _, err := cache.Load("pivo-1.html"); err == nil {
+				t.Error("the old name loads after Rename")
+			}
+			cache.Save("pivo-2.html", meta, content)
+			if err := cache.Rename("pivo-2.html", "pivo-1-0123abcd.html"); !errors.Is(err, os.ErrExist) {
+				t.Errorf("Rename over an existing entry = %v, want ErrExist", err)
+			}
+
+			entries, err := cache.List()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var names []string
+			for _, entry := range entries {
+				names = append(names, entry.Name)
+				if entry.Size <= 0 || entry.Used.IsZero() {
+					t.Errorf("%s: size %d, used %v", entry.Name, entry.Size, entry.Used)
+				}
+			}
+			if !reflect.DeepEqual(sortedStrings(names), []string{"pivo-1-0123abcd.html", "pivo-2.html"}) {
+				t.Errorf("List = %q", names)
+			}
+
+			if err := cache.Delete("pivo-2.html"); err != nil {
+				t.Fatal(err)
+			}
+			if err := cache.Delete("pivo-2.html"); !errors.Is(err, os.ErrNotExist) {
+				t.Errorf("second Delete = %v, want ErrNotExist", err)
+			}
+			if err := cache.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			// the entries survive reopening
+			cache, err = backend.open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cache.Close()
+			if got, _, err := cache.Load("pivo-1-0123abcd.html"); err != nil || string(got) != string(content) {
+				t.Errorf("Load after reopening = %q %v", got, err)
+			}
+			if _, _, err := cache.Load("pivo-2.html"); err == nil {
+				t.Error("the deleted entry loads after reopening")
+			}
+		})
+	}
+}
+
+// sortedStrings - sorted copy
+func sortedStrings(s []string) []string {
+	sorted := append([]string(nil), s...)
+	sort.Strings(sorted)
+	return sorted
+}
+
+func TestFileCacheGzip(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.CacheLayout = CACHE_LAYOUT_FLAT
+	dir := t.TempDir()
+	cache, err := openFileCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cache.Close()
+	content := []byte("<html>" + string(make([]byte, 4096)) + "</html>")
+	meta := cacheMeta{Query: "pivo", Status: 200, FetchTime: time.Now()}
+	path := filepath.Join(dir, "pivo-1.html")
+
+	tests := []struct {
+		gzip         bool
+		stored, gone string
+	}{
+		{true, path + CACHE_GZ_SUFFIX, path},
+		{false, path, path + CACHE_GZ_SUFFIX}, // the stale copy of the other mode is dropped
+		{true, path + CACHE_GZ_SUFFIX, path},
+	}
+	for _, tt := range tests {
+		config.CacheGzip = tt.gzip
+		if err := cache.Save("pivo-1.html", meta, content); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Stat(tt.stored)
+		if err != nil {
+			t.Fatalf("gzip=%v: %v", tt.gzip, err)
+		}
+		if tt.gzip && info.Size() >= int64(len(content)) {
+			t.Errorf("gzip=%v: stored %d bytes of %d, not compressed", tt.gzip, info.Size(), len(content))
+		}
+		if _, err := os.Stat(tt.gone); err == nil {
+			t.Errorf("gzip=%v: stale %s kept", tt.gzip, filepath.Base(tt.gone))
+		}
+		if got, _, err := cache.Load("pivo-1.html"); err != nil || string(got) != string(content) {
+			t.Errorf("gzip=%v: Load = %d bytes %v", tt.gzip, len(got), err)
+		}
+	}
+
+	// plain legacy pages without a sidecar load with the file time
+	os.WriteFile(filepath.Join(dir, "legacy-1.html"), []byte("<html>legacy</html>"), 0644)
+	if got, meta, err := cache.Load("legacy-1.html"); err != nil || string(got) != "<html>legacy</html>" || meta.FetchTime.IsZero() {
+		t.Errorf("legacy Load = %q %+v %v", got, meta, err)
+	}
+}
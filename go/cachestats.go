@@ -0,0 +1,182 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// page suffix of the legacy cache keys, see legacyCacheKey
+var reLegacyCacheSuffix = regexp.MustCompile(`-\d+\.html$`)
+
+// age buckets of the stats report
+var cacheAgeBuckets = []struct {
+	label string
+	limit time.Duration
+}{
+	{"<1h", time.Hour},
+	{"<12h", 12 * time.Hour},
+	{"<1d", 24 * time.Hour},
+	{"<7d", 7 * 24 * time.Hour},
+	{"older", 1<<63 - 1},
+}
+
+// queryStats - cache usage of one query
+type queryStats struct {
+	query   string
+	entries int
+	size    int64
+	newest  time.Time
+	oldest  time.Time
+}
+
+// cacheEntryQuery - originating query, entries without metadata use the key prefix
+func cacheEntryQuery(entry cacheEntry) string {
+	if entry.Meta.Query != "" {
+		return entry.Meta.Query
+	}
+	name := strings.TrimPrefix(entry.Name, LAYOUT_MOBILE+"-")
+	if reCacheKeySuffix.MatchString(name) {
+		return reCacheKeySuffix.ReplaceAllString(name, "")
+	}
+	return reLegacyCacheSuffix.ReplaceAllString(name, "")
+}
+
+// formatAge - short age like 3d, 5h or 12m
+func formatAge(d time.Duration) string {
+	switch {
+	case d >= 24*time.Hour:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	case d >= time.Hour:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	}
+	return fmt.Sprintf("%dm", int(d.Minutes()))
+}
+
+// runCache - cache subcommands
+func runCache(args []string) error {
+	if len(args) == 0 || args[0] != "stats" {
+		return fmt.Errorf("%w: koopi cache stats [--top N]", errUsage)
+	}
+	flags := flag.NewFlagSet("cache stats", flag.ExitOnError)
+	top := flags.Int("top", 30, "number of queries to list, 0 = all")
+	parseInterspersed(flags, args[1:])
+
+	if err := openHtmlCache(); err != nil {
+		return err
+	}
+	defer closeHtmlCache()
+	entries, err := htmlCache.List()
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	byQuery := make(map[string]*queryStats)
+	buckets := make([]int, len(cacheAgeBuckets))
+	var total int64
+	var oldest, newest time.Time
+	stale := 0
+	statuses := make(map[int]int)
+	for _, entry := range entries {
+		statuses[entry.Meta.Status]++
+		fetched := entry.Meta.FetchTime
+		total += entry.Size
+		if oldest.IsZero() || fetched.Before(oldest) {
+			oldest = fetched
+		}
+		if fetched.After(newest) {
+			newest = fetched
+		}
+		age := now.Sub(fetched)
+		if config.CacheTtl > 0 && age > time.Duration(config.CacheTtl) {
+			stale++
+		}
+		for i, bucket := range cacheAgeBuckets {
+			if age < bucket.limit {
+				buckets[i]++
+				break
+			}
+		}
+
+		query := cacheEntryQuery(entry)
+		qs, ok := byQuery[query]
+		if !ok {
+			qs = &queryStats{query: query, oldest: fetched}
+			byQuery[query] = qs
+		}
+		qs.entries++
+		qs.size += entry.Size
+		if fetched.Before(qs.oldest) {
+			qs.oldest = fetched
+		}
+		if fetched.After(qs.newest) {
+			qs.newest = fetched
+		}
+	}
+
+	fmt.Printf("📚 HTML cache [%s]: %d entries, %s", config.CacheBackend, len(entries), formatBytes(total))
+	if len(entries) > 0 {
+		fmt.Printf(", oldest %s, newest %s, %d stale (> %s)",
+			formatAge(now.Sub(oldest)), formatAge(now.Sub(newest)), stale, time.Duration(config.CacheTtl))
+	}
+	fmt.Println()
+	var bucketLines []string
+	for i, bucket := range cacheAgeBuckets {
+		bucketLines = append(bucketLines, fmt.Sprintf("%s %d", bucket.label, buckets[i]))
+	}
+	fmt.Printf("   age: %s\n", strings.Join(bucketLines, " | "))
+	var codes []int
+	for code := range statuses {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	var statusLines []string
+	for _, code := range codes {
+		label := strconv.Itoa(code)
+		if code == 0 {
+			label = "unknown"
+		}
+		statusLines = append(statusLines, fmt.Sprintf("%s %d", label, statuses[code]))
+	}
+	if len(statusLines) > 0 {
+		fmt.Printf("   status: %s (non-200 entries are refetched)\n", strings.Join(statusLines, " | "))
+	}
+
+	var queries []*queryStats
+	for _, qs := range byQuery {
+		queries = append(queries, qs)
+	}
+	c := newCollator()
+	sort.Slice(queries, func(i, j int) bool {
+		if queries[i].size != queries[j].size {
+			return queries[i].size > queries[j].size
+		}
+		return c.CompareString(queries[i].query, queries[j].query) < 0
+	})
+	if *top > 0 && len(queries) > *top {
+		queries = queries[:*top]
+	}
+	if len(queries) > 0 {
+		fmt.Printf("\n   %-30s %7s %10s %7s %7s\n", "query", "entries", "size", "newest", "oldest")
+	}
+	for _, qs := range queries {
+		fmt.Printf("   %-30s %7d %10s %7s %7s\n", qs.query, qs.entries, formatBytes(qs.size),
+			formatAge(now.Sub(qs.newest)), formatAge(now.Sub(qs.oldest)))
+	}
+
+	images, err := imageCacheItems()
+	if err != nil {
+		return err
+	}
+	var imagesSize int64
+	for _, image := range images {
+		imagesSize += image.size
+	}
+	fmt.Printf("\n🖼️ image cache: %d files, %s\n", len(images), formatBytes(imagesSize))
+	return nil
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// chain mapping overriding the built-in chains, see loadChains
+const CHAINS_FILE = "chains.json"
+
+// built-in chains and the market labels of their stores
+var defaultChains = map[string][]string{
+	"Albert":   {"Albert", "Albert supermarket", "Albert hypermarket"},
+	"Billa":    {"BILLA"},
+	"COOP":     {"COOP", "COOP Jednota", "Jednota"},
+	"FLOP":     {"FLOP", "FLOP TOP"},
+	"Globus":   {"Globus"},
+	"JIP":      {"JIP", "JIP CC Cash and Carry"},
+	"Kaufland": {"Kaufland"},
+	"Košík":    {"Košík", "Košík.cz"},
+	"Lidl":     {"Lidl"},
+	"Makro":    {"Makro"},
+	"Penny":    {"Penny Market", "Penny"},
+	"Tesco":    {"Tesco", "Tesco hypermarket", "Tesco supermarket", "Tesco Expres"},
+	"ZEMAN":    {"ZEMAN maso - uzeniny", "ZEMAN maso -uzeniny", "ZEMAN"},
+}
+
+// chainAlias - lowercase market label of the chain
+type chainAlias struct {
+	label string
+	chain string
+}
+
+// market labels, longest first, see loadChains
+var chainAliases = buildChainAliases(defaultChains)
+
+// buildChainAliases - labels of the chains, the longest label wins
+func buildChainAliases(chains map[string][]string) []chainAlias {
+	var aliases []chainAlias
+	for chain, labels := range chains {
+		aliases = append(aliases, chainAlias{strings.ToLower(chain), chain})
+		for _, label := range labels {
+			aliases = append(aliases, chainAlias{strings.ToLower(strings.TrimSpace(label)), chain})
+		}
+	}
+	sort.Slice(aliases, func(i, j int) bool {
+		if len(aliases[i].label) != len(aliases[j].label) {
+			return len(aliases[i].label) > len(aliases[j].label)
+		}
+		return aliases[i].label < aliases[j].label
+	})
+	return aliases
+}
+
+// loadChains - apply the chain mapping to the built-in chains, {"Chain": ["market label", ...]}
+func loadChains(filename string) error {
+	chains := make(map[string][]string)
+	for chain, labels := range defaultChains {
+		chains[chain] = labels
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var mapping map[string][]string
+		if err := json.Unmarshal(content, &mapping); err != nil {
+			return fmt.Errorf("parsing %s: %w", filename, err)
+		}
+		for chain, labels := range mapping {
+			if strings.TrimSpace(chain) == "" {
+				return fmt.Errorf("[%s] empty chain name", filename)
+			}
+			chains[chain] = labels
+		}
+	}
+	chainAliases = buildChainAliases(chains)
+	return nil
+}
+
+// marketChain - canonical chain of the market label, labels with a trailing location match too ("Tesco Praha Eden")
+func marketChain(market string) string {
+	label := strings.ToLower(strings.Join(strings.Fields(market), " "))
+	for _, alias := range chainAliases {
+		if label == alias.label || strings.HasPrefix(label, alias.label+" ") {
+			return alias.chain
+		}
+	}
+	return strings.TrimSpace(market)
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// pruneItem - cache entry or image considered for removal
+type pruneItem struct {
+	name   string
+	size   int64
+	time   time.Time // fetch or download time
+	used   time.Time // last use, for the LRU eviction
+	remove func() error
+}
+
+// cleanPolicy - what clean-cache removes
+type cleanPolicy struct {
+	olderThan time.Duration // 0 = any age
+	maxSize   int64         // per cache, 0 = no limit
+	query     string        // only HTML entries of this query
+	lru       bool          // evict by the last use instead of the age
+	dryRun    bool
+	verbose   bool
+}
+
+// selectItems - items older than olderThan, then the oldest ones over maxSize,
+// all items when neither is set (--query alone)
+func (p cleanPolicy) selectItems(items []pruneItem) []pruneItem {
+	sort.Slice(items, func(i, j int) bool {
+		if p.lru {
+			return items[i].used.Before(items[j].used)
+		}
+		return items[i].time.Before(items[j].time)
+	})
+	var total int64
+	for _, item := range items {
+		total += item.size
+	}
+	var removed []pruneItem
+	for _, item := range items {
+		tooOld := p.olderThan > 0 && time.Since(item.time) > p.olderThan
+		tooBig := p.maxSize > 0 && total > p.maxSize
+		anyItem := p.olderThan == 0 && p.maxSize == 0
+		if !tooOld && !tooBig && !anyItem {
+			continue
+		}
+		removed = append(removed, item)
+		total -= item.size
+	}
+	return removed
+}
+
+// htmlCacheItems - cached pages of the current backend, optionally of one query only
+func htmlCacheItems(query string) ([]pruneItem, error) {
+	entries, err := htmlCache.List()
+	if err != nil {
+		return nil, err
+	}
+	items := make([]pruneItem, 0, len(entries))
+	for _, entry := range entries {
+		if query != "" && cacheSlug(cacheEntryQuery(entry)) != cacheSlug(query) {
+			continue
+		}
+		used := entry.Used
+		if used.IsZero() {
+			used = entry.Meta.FetchTime
+		}
+		items = append(items, pruneItem{
+			name:   entry.Name,
+			size:   entry.Size,
+			time:   entry.Meta.FetchTime,
+			used:   used,
+			remove: func() error { return htmlCache.Delete(entry.Name) },
+		})
+	}
+	return items, nil
+}
+
+// imageCacheItems - downloaded images
+func imageCacheItems() ([]pruneItem, error) {
+	dirEntries, err := os.ReadDir(config.ImageCache)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var items []pruneItem
+	for _, d := range dirEntries {
+		if d.IsDir() || d.Name() == IMAGE_INDEX_FILE {
+			continue
+		}
+		info, err := d.Info()
+		if err != nil {
+			return nil, err
+		}
+		path := filepath.Join(config.ImageCache, d.Name())
+		items = append(items, pruneItem{
+			name:   d.Name(),
+			size:   info.Size(),
+			time:   info.ModTime(),
+			used:   info.ModTime(), // touched on cache hits
+			remove: func() error { return os.Remove(path) },
+		})
+	}
+	return items, nil
+}
+
+// referencedImages - image names without extensions used by the JSON output
+func referencedImages(filename string, refs map[string]bool) error {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var output struct {
+		Goods    []outputProduct `json:"goods"`
+		Products []outputProduct `json:"products"` // grouped json_layout
+	}
+	if err := json.Unmarshal(content, &output); err != nil {
+		return fmt.Errorf("[%s] %w", filename, err)
+	}
+	for _, item := range append(output.Goods, output.Products...) {
+		if item.Image != "" {
+			refs[strings.TrimSuffix(item.Image, filepath.Ext(item.Image))] = true
+		}
+		for _, thumb := range item.Thumbs {
+			refs[strings.TrimSuffix(thumb.Src, filepath.Ext(thumb.Src))] = true
+		}
+	}
+	return nil
+}
+
+// outputHistory - the current JSON output and the newest last files matching the pattern
+func outputHistory(pattern string, last int) ([]string, error) {
+	outputs := []string{config.OutputJson}
+	if pattern == "" || last <= 0 {
+		return outputs, nil
+	}
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	modTimes := make(map[string]time.Time)
+	for _, match := range matches {
+		if info, err := os.Stat(match); err == nil {
+			modTimes[match] = info.ModTime()
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return modTimes[matches[i]].After(modTimes[matches[j]])
+	})
+	return append(outputs, matches[:min(last, len(matches))]...), nil
+}
+
+// orphanImageItems - cached images (any format) not referenced by the outputs
+func orphanImageItems(outputs []string) ([]pruneItem, error) {
+	refs := make(map[string]bool)
+	for _, filename := range outputs {
+		if err := referencedImages(filename, refs); err != nil {
+			return nil, err
+		}
+	}
+	if len(refs) == 0 {
+		return nil, errors.New("no images referenced by the outputs, refusing to remove all")
+	}
+	items, err := imageCacheItems()
+	if err != nil {
+		return nil, err
+	}
+	var orphans []pruneItem
+	for _, item := range items {
+		if !refs[strings.TrimSuffix(item.name, filepath.Ext(item.name))] {
+			orphans = append(orphans, item)
+		}
+	}
+	return orphans, nil
+}
+
+// prune - remove the items selected by the policy and report them
+func (p cleanPolicy) prune(label string, items []pruneItem) error {
+	removed := p.selectItems(items)
+	var total, removedSize int64
+	for _, item := range items {
+		total += item.size
+	}
+	var errs []error
+	for _, item := range removed {
+		if p.verbose {
+			log.Printf("🗑️ %s %s (%s, %s)", label, item.name, formatBytes(item.size), item.time.Format("2006-01-02 15:04"))
+		}
+		if !p.dryRun {
+			if err := item.remove(); err != nil && !os.IsNotExist(err) {
+				errs = append(errs, fmt.Errorf("%s: %w", item.name, err))
+				continue
+			}
+		}
+		removedSize += item.size
+	}
+	action := "removed"
+	if p.dryRun {
+		action = "would remove"
+	}
+	log.Printf("🧹 %s: %s %d of %d entries (%s of %s)",
+		label, action, len(removed), len(items), formatBytes(removedSize), formatBytes(total))
+	return errors.Join(errs...)
+}
+
+// enforce size limits when closing the cache, set by setupRun
+var cacheLimitsOnClose bool
+
+// enforceCacheLimits - evict the least recently used pages and images over the configured sizes
+func enforceCacheLimits() {
+	for _, limit := range []struct {
+		label   string
+		maxSize ByteSize
+		items   func() ([]pruneItem, error)
+	}{
+		{"html", config.HtmlCacheMaxSize, func() ([]pruneItem, error) { return htmlCacheItems("") }},
+		{"images", config.ImageCacheMaxSize, imageCacheItems},
+	} {
+		if limit.maxSize <= 0 {
+			continue
+		}
+		items, err := limit.items()
+		if err != nil {
+			log.Printf("💥 %s cache size limit: %v", limit.label, err)
+			continue
+		}
+		var total int64
+		for _, item := range items {
+			total += item.size
+		}
+		if total <= int64(limit.maxSize) {
+			continue
+		}
+		policy := cleanPolicy{maxSize: int64(limit.maxSize), lru: true}
+		if err := policy.prune(limit.label+" (LRU)", items); err != nil {
+			log.Printf("💥 %s cache size limit: %v", limit.label, err)
+		}
+	}
+}
+
+// parseAge - durations with day and week units, e.g. "7d", "2w", "36h"
+func parseAge(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	for _, unit := range []struct {
+		suffix string
+		size   time.Duration
+	}{{"d", 24 * time.Hour}, {"w", 7 * 24 * time.Hour}} {
+		if before, ok := strings.CutSuffix(s, unit.suffix); ok {
+			n, err := strconv.ParseFloat(before, 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q", s)
+			}
+			return time.Duration(n * float64(unit.size)), nil
+		}
+	}
+	return time.ParseDuration(s)
+}
+
+// runCleanCache - prune the HTML and image caches by age and size
+func runCleanCache(args []string) error {
+	flags := flag.NewFlagSet("clean-cache", flag.ExitOnError)
+	olderThan := flags.String("older-than", "", "remove entries older than this, e.g. 7d, 2w, 36h")
+	maxSize := flags.String("max-size", "", "then remove the oldest entries over this size per cache, e.g. 2GB")
+	dryRun := flags.Bool("dry-run", false, "only report what would be removed")
+	query := flags.String("query", "", "remove only the HTML pages of this query (all pages, images are kept)")
+	orphans := flags.Bool("orphans", false, "remove only the images not referenced by the JSON output")
+	history := flags.String("history", "", "with --orphans, keep also the images of older outputs, e.g. ../stems/data_*.json")
+	last := flags.Int("last", 7, "with --history, number of newest older outputs to keep the images of")
+	verbose := flags.Bool("v", false, "list removed entries")
+	parseInterspersed(flags, args)
+
+	policy := cleanPolicy{query: strings.TrimSpace(*query), dryRun: *dryRun, verbose: *verbose}
+	var err error
+	if *olderThan != "" {
+		if policy.olderThan, err = parseAge(*olderThan); err != nil {
+			return err
+		}
+	}
+	if *maxSize != "" {
+		if policy.maxSize, err = parseByteSize(*maxSize); err != nil {
+			return err
+		}
+	}
+	if policy.olderThan == 0 && policy.maxSize == 0 && policy.query == "" && !*orphans {
+		return errors.New("nothing to do, use --older-than, --max-size, --query or --orphans")
+	}
+
+	if !checkLock() {
+		return errors.New("locked")
+	}
+	defer unlockLock()
+	if *orphans {
+		outputs, err := outputHistory(*history, *last)
+		if err != nil {
+			return err
+		}
+		orphanItems, err := orphanImageItems(outputs)
+		if err != nil {
+			return err
+		}
+		return policy.prune(fmt.Sprintf("images (orphans of %d outputs)", len(outputs)), orphanItems)
+	}
+
+	if err := openHtmlCache(); err != nil {
+		return err
+	}
+	defer closeHtmlCache()
+
+	htmlItems, err := htmlCacheItems(policy.query)
+	if err != nil {
+		return err
+	}
+	if policy.query != "" {
+		return policy.prune("html ["+policy.query+"]", htmlItems)
+	}
+	imageItems, err := imageCacheItems()
+	if err != nil {
+		return err
+	}
+	return errors.Join(
+		policy.prune("html", htmlItems),
+		policy.prune("images", imageItems),
+	)
+}
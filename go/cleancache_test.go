@@ -0,0 +1,77 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestEnforceCacheLimitsLru(t *testing.T) {
+	saved, savedCache := config, htmlCache
+	defer func() { config, htmlCache = saved, savedCache }()
+	dir := t.TempDir()
+	config.CacheLayout, config.CacheGzip = CACHE_LAYOUT_FLAT, false
+	config.HtmlCache, config.ImageCache = filepath.Join(dir, "html"), filepath.Join(dir, "images")
+
+	cache, err := openFileCache(config.HtmlCache)
+	if err != nil {
+		t.Fatal(err)
+	}
+	htmlCache = cache
+	now := time.Now()
+	// the oldest fetched page is the most recently used one, the LRU eviction keeps it
+	pages := []struct {
+		name          string
+		fetched, used time.Duration
+	}{
+		{"old-used-1.html", -72 * time.Hour, -time.Minute},
+		{"lru-1.html", -24 * time.Hour, -48 * time.Hour},
+		{"new-1.html", -time.Hour, -time.Hour},
+	}
+	var total int64
+	for _, page := range pages {
+		if err := cache.Save(page.name, cacheMeta{Status: 200, FetchTime: now.Add(page.fetched)}, []byte("<html>"+page.name+"</html>")); err != nil {
+			t.Fatal(err)
+		}
+		entry := cache.manifest[page.name]
+		entry.Used = now.Add(page.used)
+		cache.manifest[page.name] = entry
+		total += entry.Size
+	}
+
+	// images are used by their file times, touched on cache hits
+	os.MkdirAll(config.ImageCache, 0755)
+	var imagesTotal int64
+	for i, name := range []string{"recent.webp", "lru.webp", "middle.webp"} {
+		path := filepath.Join(config.ImageCache, name)
+		os.WriteFile(path, []byte(name), 0644)
+		mtime := now.Add([]time.Duration{-time.Hour, -72 * time.Hour, -24 * time.Hour}[i])
+		os.Chtimes(path, mtime, mtime)
+		imagesTotal += int64(len(name))
+	}
+	os.WriteFile(filepath.Join(config.ImageCache, IMAGE_INDEX_FILE), []byte("{}\n"), 0644)
+
+	config.HtmlCacheMaxSize, config.ImageCacheMaxSize = ByteSize(total-1), ByteSize(imagesTotal-1)
+	enforceCacheLimits()
+
+	for _, page := range pages {
+		_, _, err := cache.Load(page.name)
+		if removed := page.name == "lru-1.html"; removed != (err != nil) {
+			t.Errorf("%s: load error %v, want removed=%v", page.name, err, removed)
+		}
+	}
+	for _, name := range []string{"recent.webp", "lru.webp", "middle.webp", IMAGE_INDEX_FILE} {
+		_, err := os.Stat(filepath.Join(config.ImageCache, name))
+		if removed := name == "lru.webp"; removed != (err != nil) {
+			t.Errorf("%s: stat error %v, want removed=%v", name, err, removed)
+		}
+	}
+
+	// under the limits nothing is evicted
+	config.HtmlCacheMaxSize, config.ImageCacheMaxSize = ByteSize(total), ByteSize(imagesTotal)
+	enforceCacheLimits()
+	if entries, _ := cache.List(); len(entries) != 2 {
+		t.Errorf("%d pages left under the limit, want 2", len(entries))
+	}
+}
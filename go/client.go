@@ -0,0 +1,225 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httputil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	COOKIE_FILE = "cookies.json" // stored in the HTML cache
+	DEBUG_DIR   = "debug"        // below state_dir
+
+	CONSENT_ACCEPT = "accept"
+	CONSENT_SKIP   = "skip"
+)
+
+// consentJarCookies - cookies of the consent flow, there are no built-in ones: accept the banner of the site
+// in a browser and copy its cookies (devtools, Application, Cookies of KOOPI_HOME_URL) into consent_cookies
+func consentJarCookies() ([]*http.Cookie, error) {
+	if len(config.ConsentCookies) == 0 {
+		return nil, errors.New("--consent accept: consent_cookies is not configured, copy the cookies of the accepted banner from a browser")
+	}
+	var cookies []*http.Cookie
+	for name, value := range config.ConsentCookies {
+		cookies = append(cookies, &http.Cookie{Name: name, Value: value, Path: "/"})
+	}
+	sort.Slice(cookies, func(i, j int) bool { return cookies[i].Name < cookies[j].Name })
+	return cookies, nil
+}
+
+// shared HTTP client
+var httpClient *http.Client
+
+// cookie hosts to persist
+var cookieUrls = []string{KOOPI_HOME_URL, KOOPI_IMAGE_URL}
+
+// newHttpClient - create the shared HTTP client with a persistent cookie jar
+func newHttpClient(consent string) (*http.Client, error) {
+	jar, _ := cookiejar.New(nil)
+	loadCookies(jar)
+
+	// consent flow
+	if consent == CONSENT_ACCEPT {
+		cookies, err := consentJarCookies()
+		if err != nil {
+			return nil, err
+		}
+		homeUrl, _ := url.Parse(KOOPI_HOME_URL)
+		jar.SetCookies(homeUrl, cookies)
+	}
+
+	transport, err := newTransport()
+	if err != nil {
+		return nil, err
+	}
+	var roundTripper http.RoundTripper = transport
+	if config.BandwidthLimit > 0 {
+		roundTripper = &throttledTransport{base: transport, limiter: &bandwidthLimiter{rate: int64(config.BandwidthLimit)}}
+	}
+	return &http.Client{
+		Timeout:   time.Duration(config.BodyTimeout),
+		Jar:       jar,
+		Transport: roundTripper,
+	}, nil
+}
+
+// newTransport - create the HTTP transport using the configured DNS resolver and TLS
+func newTransport() (*http.Transport, error) {
+	tlsConfig, err := newTlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = newCachingDialer(config.DnsServers, config.DnsCache).DialContext
+	transport.TLSClientConfig = tlsConfig
+	transport.TLSHandshakeTimeout = time.Duration(config.TlsTimeout)
+	transport.ResponseHeaderTimeout = time.Duration(config.ResponseHeaderTimeout)
+	if torEnabled() {
+		transport.Proxy = torProxy()
+		log.Printf("🧅 fetching through Tor at %s", config.TorSocks)
+	}
+	return transport, nil
+}
+
+// newTlsConfig - create the TLS config (custom CA bundle, verification, min version)
+func newTlsConfig() (*tls.Config, error) {
+	tlsConfig := &tls.Config{
+		InsecureSkipVerify: config.TlsInsecure,
+	}
+	if config.TlsInsecure {
+		log.Printf("⚠️ WARNING: TLS certificate verification is disabled")
+	}
+
+	switch config.TlsMinVersion {
+	case "":
+	case "1.2":
+		tlsConfig.MinVersion = tls.VersionTLS12
+	case "1.3":
+		tlsConfig.MinVersion = tls.VersionTLS13
+	default:
+		return nil, fmt.Errorf("invalid TLS min version %q", config.TlsMinVersion)
+	}
+
+	if config.TlsCaFile != "" {
+		pem, err := os.ReadFile(config.TlsCaFile)
+		if err != nil {
+			return nil, err
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", config.TlsCaFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return tlsConfig, nil
+}
+
+// loadCookies - load cookies saved by the previous run
+func loadCookies(jar *cookiejar.Jar) {
+	content, err := os.ReadFile(filepath.Join(config.HtmlCache, COOKIE_FILE))
+	if err != nil {
+		return
+	}
+	saved := make(map[string][]*http.Cookie)
+	if err := json.Unmarshal(content, &saved); err != nil {
+		log.Printf("[%s] 💥 error reading cookies: %v", COOKIE_FILE, err)
+		return
+	}
+	for rawUrl, cookies := range saved {
+		if u, err := url.Parse(rawUrl); err == nil {
+			jar.SetCookies(u, cookies)
+		}
+	}
+}
+
+// saveCookies - persist cookies for the next run
+func saveCookies(client *http.Client) {
+	if client == nil || client.Jar == nil {
+		return
+	}
+	saved := make(map[string][]*http.Cookie)
+	for _, rawUrl := range cookieUrls {
+		u, _ := url.Parse(rawUrl)
+		if cookies := client.Jar.Cookies(u); len(cookies) > 0 {
+			saved[rawUrl] = cookies
+		}
+	}
+	content, err := json.Marshal(saved)
+	if err != nil {
+		return
+	}
+	if err := os.MkdirAll(config.HtmlCache, 0755); err != nil {
+		log.Printf("[%s] 💥 error creating cache folder: %v", config.HtmlCache, err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(config.HtmlCache, COOKIE_FILE), content, 0644); err != nil {
+		log.Printf("[%s] 💥 error saving cookies: %v", COOKIE_FILE, err)
+	}
+}
+
+// isHttpDebugged - check if HTTP debugging is enabled for the query
+func isHttpDebugged(query string) bool {
+	if !*debugHttpFlag {
+		return false
+	}
+	if *debugQueriesFlag == "" {
+		return true
+	}
+	for q := range strings.SplitSeq(*debugQueriesFlag, ",") {
+		if strings.EqualFold(strings.TrimSpace(q), query) {
+			return true
+		}
+	}
+	return false
+}
+
+// dumpHttpRequest - dump request headers
+func dumpHttpRequest(req *http.Request, qlog *queryLogger) {
+	dump, err := httputil.DumpRequestOut(req, false)
+	if err != nil {
+		qlog.Printf("💥 error dumping request: %v", err)
+		return
+	}
+	qlog.Printf("🐞 request:\n%s", strings.TrimSpace(string(dump)))
+}
+
+// dumpHttpResponse - dump response headers and optionally save the body
+func dumpHttpResponse(res *http.Response, body []byte, cacheName string, qlog *queryLogger) {
+	dump, err := httputil.DumpResponse(res, false)
+	if err != nil {
+		qlog.Printf("💥 error dumping response: %v", err)
+		return
+	}
+	qlog.Printf("🐞 response:\n%s", strings.TrimSpace(string(dump)))
+
+	if !*debugBodiesFlag || body == nil {
+		return
+	}
+	debugDir := statePath(config.DebugDir)
+	if err := os.MkdirAll(debugDir, 0755); err != nil {
+		qlog.Printf("💥 error creating debug folder [%s]: %v", debugDir, err)
+		return
+	}
+	filePath := filepath.Join(debugDir, fmt.Sprintf("%s-%d-%s", time.Now().Format("20060102-150405"), res.StatusCode, cacheName))
+	if err := os.WriteFile(filePath, body, 0644); err != nil {
+		qlog.Printf("💥 error saving response body: %v", err)
+		return
+	}
+	qlog.Printf("🐞 body saved to %s", filePath)
+}
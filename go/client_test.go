@@ -0,0 +1,18 @@
+package main
+
+import "testing"
+
+func TestConsentJarCookies(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	config.ConsentCookies = nil
+	if _, err := newHttpClient(CONSENT_ACCEPT); err == nil {
+		t.Error("--consent accept without consent_cookies passed, no cookies are built in")
+	}
+	config.ConsentCookies = map[string]string{"b": "2", "a": "1"}
+	cookies, err := consentJarCookies()
+	if err != nil || len(cookies) != 2 || cookies[0].Name != "a" || cookies[1].Value != "2" {
+		t.Errorf("cookies = %v %v, want the configured ones by name", cookies, err)
+	}
+}
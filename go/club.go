@@ -0,0 +1,51 @@
+package main
+
+import "strings"
+
+// knownClubs - loyalty programs by a substring of the lowercase club text
+var knownClubs = []struct {
+	match string
+	name  string
+}{
+	{"lidl plus", "Lidl Plus"},
+	{"kaufland card", "Kaufland Card"},
+	{"clubcard", "Tesco Clubcard"},
+	{"billa bonus", "Billa Bonus"},
+	{"moje albert", "Moje Albert"},
+	{"penny karta", "PENNY karta"},
+	{"globus", "Můj Globus"},
+	{"rossmann", "Rossmann Club"},
+	{"dm active", "dm Active Beauty"},
+	{"teta", "TETA Club"},
+}
+
+// marketClubs - loyalty program of the market for the generic "pro členy klubu"
+var marketClubs = map[string]string{
+	"albert":   "Moje Albert",
+	"billa":    "Billa Bonus",
+	"globus":   "Můj Globus",
+	"kaufland": "Kaufland Card",
+	"lidl":     "Lidl Plus",
+	"penny":    "PENNY karta",
+	"rossmann": "Rossmann Club",
+	"tesco":    "Tesco Clubcard",
+}
+
+// setClub - club_required and the normalized club name, the club text is kept for display
+func setClub(item *Goods) {
+	club := strings.ToLower(item.Club)
+	item.ClubRequired = strings.TrimSpace(club) != ""
+	item.ClubName = ""
+	if !item.ClubRequired {
+		return
+	}
+	for _, known := range knownClubs {
+		if strings.Contains(club, known.match) {
+			item.ClubName = known.name
+			return
+		}
+	}
+	if fields := strings.Fields(strings.ToLower(item.Market)); len(fields) > 0 {
+		item.ClubName = marketClubs[fields[0]]
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+)
+
+const (
+	COLLAPSE_PERCENT      = 10  // minimal items in % of the last good run
+	COLLAPSE_MIN_PREVIOUS = 100 // smaller previous runs are not compared
+	EXIT_COLLAPSED        = 3   // exit code of a collapsed run, 1 is any other failure, EXIT_USAGE wrong arguments
+
+	RUN_STATUS_COLLAPSED = "collapsed"
+)
+
+// errExtractionCollapsed - pages were loaded but (almost) no goods were extracted, the site has likely changed
+var errExtractionCollapsed = errors.New("extraction collapsed")
+
+// lastGoodItems - items of the last run of the tag which did not collapse, 0 if unknown
+func lastGoodItems(filename string, tag string) int {
+	runs, err := loadRuns(filename, tag)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[%s] 💥 error loading runs: %v", filename, err)
+		}
+		return 0
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		if runs[i].Status != RUN_STATUS_COLLAPSED {
+			return runs[i].Items
+		}
+	}
+	return 0
+}
+
+// checkCollapse - compare the items with the last good run, failed downloads are not a collapse
+func checkCollapse(items int) error {
+	if config.CollapsePercent == 0 || *forceFlag || offlineMode {
+		return nil
+	}
+	pages, errs := stats.pages.Load(), stats.errors.Load()
+	if pages == 0 || errs*2 > pages {
+		return nil
+	}
+	previous := lastGoodItems(statePath(config.RunsFile), *tagFlag)
+	if previous < COLLAPSE_MIN_PREVIOUS || items*100 >= previous*config.CollapsePercent {
+		return nil
+	}
+	return fmt.Errorf("%w: %d items from %d pages, the last good run had %d (< %d%%), check the selectors",
+		errExtractionCollapsed, items, pages, previous, config.CollapsePercent)
+}
+
+// exitCode - process exit code of the fatal error
+func exitCode(err error) int {
+	if errors.Is(err, errExtractionCollapsed) {
+		return EXIT_COLLAPSED
+	}
+	return 1
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// command - subcommand of the koopi binary
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+// commands - subcommands, running without a command scrapes the input CSV
+var commands = map[string]command{
+	"baseline":        {"list|set|rm everyday prices of the pinned products (" + BASELINES_FILE + ")", runBaseline},
+	"bought":          {"record a purchase of a pinned product for the savings report: <product> <price>", runBought},
+	"cache":           {"cache stats: entries, sizes and ages per query", runCache},
+	"clean-cache":     {"prune the HTML and image caches, --older-than 7d --max-size 2GB", runCleanCache},
+	"daemon":          {"scrape the categories by schedule_every / category_every until stopped, --once", runDaemon},
+	"discover":        {"crawl the category navigation, print the candidate scrape list (category, URL, pages), --append", runDiscover},
+	"demo":            {"run the pipeline offline against bundled fixture pages", runDemo},
+	"export":          {"convert the CSV output, --format " + exportFormatNames() + ", --out", runExport},
+	"fetch":           {"fetch or load one URL, dump headers and body, --show-extraction dumps the goods", runFetch},
+	"ids":             {"migrate|check product IDs between two JSON outputs", runIds},
+	"images":          {"sync: download the missing images of the latest output without scraping", runImages},
+	"leaflets":        {"scrape the leaflets of the chains into " + OUTPUT_LEAFLETS + ": name, validity, page images, --chains", runLeaflets},
+	"paths":           {"print the resolved cache and output paths, or one of them: image_cache, ...", runPaths},
+	"queries":         {"import-category <url>: append the facets of a category page as queries", runQueries},
+	"replay":          {"compare the extraction of saved pages with golden files, --corpus testdata/ --update", runReplay},
+	"retry":           {"re-scrape " + FAILED_URLS_FILE + " and merge into the outputs", runRetry},
+	"runs":            {"list recorded runs, --tag filters by run tag", runRuns},
+	"savings":         {"money saved against the baseline prices, --by month|week", runSavings},
+	"upload":          {"upload the changed outputs and images to upload_bucket, --force, --dry-run", runUpload},
+	"validate-output": {"check a JSON or NDJSON output against its schema, --schema " + OUTPUT_SCHEMA + ", --print-schema", runValidateOutput},
+	"warm":            {"slowly download all uncached pages of the input, --delay 30s, no extraction", runWarm},
+	"selectors":       {"print the CSS selectors in effect, a starting point for " + SELECTORS_FILE, runSelectors},
+	"sample":          {"print random offers of the latest run with their sources, --n 20", runSample},
+}
+
+// parseInterspersed - parse the flags on both sides of the positional arguments, flag.Parse stops at the first one
+func parseInterspersed(flags *flag.FlagSet, args []string) []string {
+	var positional []string
+	for {
+		flags.Parse(args)
+		if flags.NArg() == 0 {
+			return positional
+		}
+		if len(args) > flags.NArg() && args[len(args)-flags.NArg()-1] == "--" {
+			return append(positional, flags.Args()...) // the rest is positional after "--"
+		}
+		positional = append(positional, flags.Arg(0))
+		args = flags.Args()[1:]
+	}
+}
+
+// runCommand - run the subcommand
+func runCommand(name string, args []string) error {
+	cmd, ok := commands[name]
+	if !ok {
+		return fmt.Errorf("%w: unknown command %q, available:\n%s", errUsage, name, commandsUsage())
+	}
+	return cmd.run(args)
+}
+
+// commandsUsage - list of the subcommands, the usages aligned after the longest name
+func commandsUsage() string {
+	var names []string
+	width := 0
+	for name := range commands {
+		names = append(names, name)
+		width = max(width, len(name))
+	}
+	sort.Strings(names)
+	var lines []string
+	for _, name := range names {
+		lines = append(lines, fmt.Sprintf("  %-*s  %s", width, name, commands[name].usage))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// help refers to the commands map, registered in init to avoid the initialization cycle
+func init() {
+	commands["help"] = command{"list the commands, or show the usage of one: [command]", runHelp}
+}
+
+// runHelp - print the commands, or the usage of the command
+func runHelp(args []string) error {
+	if len(args) == 0 {
+		fmt.Printf("usage: koopi [flags] [command] [args], without a command scrape %s\n\n%s\n\n", INPUT_CSV, commandsUsage())
+		fmt.Println("koopi --help lists the flags, koopi <command> --help the flags of the command")
+		return nil
+	}
+	cmd, ok := commands[args[0]]
+	if !ok || len(args) > 1 {
+		return fmt.Errorf("%w: unknown command %q, available:\n%s", errUsage, strings.Join(args, " "), commandsUsage())
+	}
+	fmt.Printf("koopi %s - %s\n", args[0], cmd.usage)
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCommandsUsage(t *testing.T) {
+	lines := strings.Split(commandsUsage(), "\n")
+	if len(lines) != len(commands) {
+		t.Fatalf("%d lines for %d commands", len(lines), len(commands))
+	}
+	// the usages start in one column, after the longest name
+	column := -1
+	for _, line := range lines {
+		name := strings.Fields(line)[0]
+		start := strings.Index(line, commands[name].usage)
+		if column == -1 {
+			column = start
+		}
+		if start != column || line[start-2:start] != "  " {
+			t.Errorf("misaligned usage of %s: %q", name, line)
+		}
+	}
+}
+
+func TestRunHelp(t *testing.T) {
+	if _, ok := commands["help"]; !ok {
+		t.Fatal("no help command")
+	}
+	if err := runCommand("help", nil); err != nil {
+		t.Errorf("koopi help: %v", err)
+	}
+	if err := runCommand("help", []string{"upload"}); err != nil {
+		t.Errorf("koopi help upload: %v", err)
+	}
+	if err := runCommand("help", []string{"bogus"}); !errors.Is(err, errUsage) {
+		t.Errorf("koopi help bogus: got %v, want the usage error", err)
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// ComputedField - user-defined field evaluated per offer, e.g. {"name": "price_per_portion", "expr": "price / 4"}
+type ComputedField struct {
+	Name string `json:"name"`
+	Expr string `json:"expr"`
+
+	node exprNode
+}
+
+var (
+	// price number
+	rePriceNumber = regexp.MustCompile(`\d[\d\s\x{00A0}\x{202F}]*(?:[.,]\d+)?`)
+
+	// discount percentage
+	rePercent = regexp.MustCompile(`(\d+)[\s\x{00A0}\x{202F}]*%`)
+)
+
+// parsePrice - parse price strings like "1 299,90 Kč"
+func parsePrice(s string) (float64, bool) {
+	match := rePriceNumber.FindString(s)
+	if match == "" {
+		return 0, false
+	}
+	match = strings.NewReplacer(" ", "", "\u00A0", "", "\u202F", "", ",", ".").Replace(match)
+	v, err := strconv.ParseFloat(match, 64)
+	return v, err == nil
+}
+
+// offerVariables - variables available in computed field expressions, the parsed values of the outputs
+func offerVariables(item Goods) map[string]float64 {
+	vars := make(map[string]float64)
+	if item.PriceValue > 0 {
+		vars["price"] = item.PriceValue
+	}
+	if item.PricePerUnitValue > 0 {
+		vars["ppunit"] = item.PricePerUnitValue
+	}
+	if item.Baseline > 0 {
+		vars["baseline"] = item.Baseline
+	}
+	if item.DiscountPercent >= 0 {
+		vars["discount"] = float64(item.DiscountPercent)
+	}
+	if item.Quantity > 0 {
+		vars["pack_size"] = float64(max(item.PackCount, 1))
+		vars["amount"] = item.Quantity // size of one piece in Unit
+		if item.PieceQuantity > 0 {
+			vars["amount"] = item.PieceQuantity
+		}
+		vars["quantity"] = item.Quantity
+	}
+	return vars
+}
+
+// prepareComputedFields - parse the configured expressions
+func prepareComputedFields(fields []ComputedField) error {
+	for i := range fields {
+		node, err := parseExpr(fields[i].Expr)
+		if err != nil {
+			return fmt.Errorf("computed field %q: %w", fields[i].Name, err)
+		}
+		fields[i].node = node
+	}
+	return nil
+}
+
+// applyComputedFields - evaluate the computed fields, later fields may use the earlier ones
+func applyComputedFields(goods []Goods, fields []ComputedField) {
+	if len(fields) == 0 {
+		return
+	}
+	for i := range goods {
+		vars := offerVariables(goods[i])
+		computed := make(map[string]float64)
+		for _, field := range fields {
+			if v, ok := field.node.eval(vars); ok {
+				v = math.Round(v*100) / 100
+				computed[field.Name] = v
+				vars[strings.ToLower(field.Name)] = v
+			}
+		}
+		goods[i].Computed = computed
+	}
+}
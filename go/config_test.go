@@ -0,0 +1,58 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestStatePaths(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	dir := t.TempDir()
+	t.Chdir(dir)
+	t.Setenv("XDG_STATE_HOME", filepath.Join(dir, "xdg"))
+
+	if got := stateDir(); got != filepath.Join(dir, "xdg", "koopi") {
+		t.Errorf("stateDir = %q, want $XDG_STATE_HOME/koopi", got)
+	}
+	// the state of older versions in the working directory is kept in place
+	os.WriteFile(RUNS_FILE, []byte("{}\n"), 0644)
+	if dir := stateDir(); dir != "." {
+		t.Errorf("stateDir with the legacy %s = %q, want .", RUNS_FILE, dir)
+	}
+
+	config.StateDir = "state"
+	if path := statePath(STATS_FILE); path != filepath.Join("state", STATS_FILE) {
+		t.Errorf("statePath = %q", path)
+	}
+	if _, err := os.Stat("state"); err != nil {
+		t.Errorf("state_dir not created: %v", err)
+	}
+	if path := statePath("/var/lib/koopi/stats.json"); path != "/var/lib/koopi/stats.json" {
+		t.Errorf("absolute statePath = %q", path)
+	}
+}
+
+func TestNewCollator(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	tests := []struct {
+		collation string
+		want      []string
+	}{
+		{"cs", []string{"cukr", "hrách", "chléb", "šunka"}},
+		{"sk", []string{"cukr", "hrách", "chléb", "šunka"}},
+		{"en", []string{"chléb", "cukr", "hrách", "šunka"}},
+	}
+	for _, tt := range tests {
+		config.Collation = tt.collation
+		words := []string{"šunka", "chléb", "hrách", "cukr"}
+		newCollator().SortStrings(words)
+		if !reflect.DeepEqual(words, tt.want) {
+			t.Errorf("%s: %q, want %q", tt.collation, words, tt.want)
+		}
+	}
+}
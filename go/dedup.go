@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+)
+
+// minimal similarity of the notes of near-identical offers in %
+const DEDUP_SIMILARITY = 80
+
+// fuzzyKey - offer identity without the note, volumes and prices compared by their parsed values
+func fuzzyKey(item Goods) string {
+	volume := normalizeCzechString(item.Volume)
+	if item.Quantity > 0 {
+		volume = fmt.Sprintf("%g %s", item.Quantity, item.Unit)
+	}
+	price := normalizeCzechString(item.Price)
+	if item.PriceValue > 0 {
+		price = fmt.Sprintf("%.2f %s", item.PriceValue, item.Currency)
+	}
+	return strings.Join([]string{normalizeCzechString(item.Name), price, volume, normalizeCzechString(item.Club),
+		normalizeCzechString(item.Market), item.ValidFrom, item.ValidTo}, "|")
+}
+
+// noteSimilarity - Dice coefficient of the note words in %, the word order is ignored
+func noteSimilarity(a string, b string) int {
+	wordsA := strings.Fields(normalizeCzechString(a))
+	wordsB := strings.Fields(normalizeCzechString(b))
+	if len(wordsA) == 0 && len(wordsB) == 0 {
+		return 100
+	}
+	counts := make(map[string]int)
+	for _, w := range wordsA {
+		counts[w]++
+	}
+	common := 0
+	for _, w := range wordsB {
+		if counts[w] > 0 {
+			counts[w]--
+			common++
+		}
+	}
+	return common * 200 / (len(wordsA) + len(wordsB))
+}
+
+// fuzzyDeduplicateGoods - second pass of deduplicateGoods: merge offers differing only in the volume
+// or price formatting and in similar notes, the offer with the longer note is kept
+func fuzzyDeduplicateGoods(goods []Goods) []Goods {
+	if config.DedupSimilarity <= 0 {
+		return goods
+	}
+	buckets := make(map[string][]int) // indexes of the kept offers by fuzzyKey
+	var kept []Goods
+	merged := 0
+	for _, item := range goods {
+		key := fuzzyKey(item)
+		duplicate := false
+		for _, i := range buckets[key] {
+			if noteSimilarity(kept[i].Note, item.Note) >= config.DedupSimilarity {
+				if len(item.Note) > len(kept[i].Note) {
+					kept[i] = item
+				}
+				duplicate = true
+				merged++
+				break
+			}
+		}
+		if !duplicate {
+			buckets[key] = append(buckets[key], len(kept))
+			kept = append(kept, item)
+		}
+	}
+	if merged > 0 {
+		log.Printf("🧹 %d near-identical offers merged", merged)
+	}
+	return kept
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestFuzzyDeduplicateGoods(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	pivo := func(price string, volume string, note string, market string) Goods {
+		item := Goods{Name: "Pivo Plzeň", Price: price, Volume: volume, Note: note, Market: market}
+		setPriceValues(&item)
+		setVolumeValues(&item)
+		return item
+	}
+	tests := []struct {
+		name       string
+		similarity int
+		goods      []Goods
+		notes      []string // notes of the kept offers
+	}{
+		{"volume and price formatting", 80,
+			[]Goods{pivo("19,90 Kč", "0,5 l", "akce týdne", "Albert"), pivo("19.90 Kč", "500 ml", "akce týdne", "Albert")},
+			[]string{"akce týdne"}},
+		{"word order and case, the longer note is kept", 80,
+			[]Goods{pivo("19,90 Kč", "0,5 l", "cena za kus", "Albert"), pivo("19,90 Kč", "0,5 l", "Za kus cena  ", "Albert")},
+			[]string{"Za kus cena  "}},
+		{"similar notes", 80,
+			[]Goods{pivo("19,90 Kč", "0,5 l", "při koupi 6 kusů cena za kus", "Albert"), pivo("19,90 Kč", "0,5 l", "při koupi 6 ks cena za kus", "Albert")},
+			[]string{"při koupi 6 kusů cena za kus"}},
+		{"different notes", 80,
+			[]Goods{pivo("19,90 Kč", "0,5 l", "s Albert kartou", "Albert"), pivo("19,90 Kč", "0,5 l", "bez karty", "Albert")},
+			[]string{"s Albert kartou", "bez karty"}},
+		{"different markets", 80,
+			[]Goods{pivo("19,90 Kč", "0,5 l", "", "Albert"), pivo("19,90 Kč", "0,5 l", "", "Billa")},
+			[]string{"", ""}},
+		{"different volumes", 80,
+			[]Goods{pivo("19,90 Kč", "0,5 l", "", "Albert"), pivo("19,90 Kč", "0,33 l", "", "Albert")},
+			[]string{"", ""}},
+		{"off", 0,
+			[]Goods{pivo("19,90 Kč", "0,5 l", "akce týdne", "Albert"), pivo("19.90 Kč", "500 ml", "akce týdne", "Albert")},
+			[]string{"akce týdne", "akce týdne"}},
+	}
+	for _, tt := range tests {
+		config.DedupSimilarity = tt.similarity
+		var notes []string
+		for _, item := range fuzzyDeduplicateGoods(tt.goods) {
+			notes = append(notes, item.Note)
+		}
+		if !reflect.DeepEqual(notes, tt.notes) {
+			t.Errorf("%s: kept %q, want %q", tt.name, notes, tt.notes)
+		}
+	}
+}
+
+func TestNoteSimilarity(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 100},
+		{"akce týdne", "Akce  týdne", 100},
+		{"cena za kus", "za kus cena", 100},
+		{"a b c d", "a b c e", 75},
+		{"akce", "", 0},
+	}
+	for _, tt := range tests {
+		if got := noteSimilarity(tt.a, tt.b); got != tt.want {
+			t.Errorf("noteSimilarity(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
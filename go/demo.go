@@ -0,0 +1,84 @@
+package main
+
+import (
+	"embed"
+	"flag"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+const DEMO_OUTPUT = "demo-output"
+
+// bundled fixture pages and input CSV
+//
+//go:embed demo
+var demoFiles embed.FS
+
+// {{DATE+N}} placeholder in fixtures - date N days from today
+var reDemoDate = regexp.MustCompile(`\{\{DATE\+(\d+)\}\}`)
+
+// runDemo - run the whole pipeline against the bundled fixtures (no network)
+func runDemo(args []string) error {
+	flags := flag.NewFlagSet("demo", flag.ExitOnError)
+	outDir := flags.String("out", DEMO_OUTPUT, "output directory")
+	parseInterspersed(flags, args)
+
+	tmpDir, err := os.MkdirTemp("", "koopi-demo-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	// extract fixtures, shift the validity dates relative to today
+	now := time.Now()
+	err = fs.WalkDir(demoFiles, "demo", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := demoFiles.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		content = reDemoDate.ReplaceAllFunc(content, func(m []byte) []byte {
+			days, _ := strconv.Atoi(string(reDemoDate.FindSubmatch(m)[1]))
+			return []byte(now.AddDate(0, 0, days).Format("2. 1."))
+		})
+		target := filepath.Join(tmpDir, path)
+		if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+			return err
+		}
+		return os.WriteFile(target, content, 0644)
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(*outDir, 0755); err != nil {
+		return err
+	}
+	config.HtmlCache = filepath.Join(tmpDir, "demo", "cache")
+	config.CacheBackend = CACHE_FILES
+	config.ImageCache = filepath.Join(tmpDir, "images")
+	config.InputCsv = filepath.Join(tmpDir, "demo", "scrape.csv")
+	config.OutputCsv = filepath.Join(*outDir, OUTPUT_CSV)
+	config.OutputJson = filepath.Join(*outDir, OUTPUT_JSON)
+	config.OutputSchema = filepath.Join(*outDir, OUTPUT_SCHEMA)
+	config.OutputImages = filepath.Join(*outDir, OUTPUT_IMAGES)
+	if config.OutputNdjson != "" {
+		config.OutputNdjson = filepath.Join(*outDir, OUTPUT_NDJSON)
+	}
+	if config.OutputXml != "" {
+		config.OutputXml = filepath.Join(*outDir, OUTPUT_XML)
+	}
+	config.ProductIdsFile = filepath.Join(*outDir, PRODUCT_IDS_FILE)
+	offlineMode = true
+	*forceFlag = true
+
+	log.Printf("🧪 demo run, outputs in %s", *outDir)
+	return runScraper()
+}
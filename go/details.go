@@ -0,0 +1,211 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math/rand"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+	"koopi/postprocess"
+)
+
+const (
+	DETAIL_THREADS   = 2
+	DETAIL_SLEEP     = 3 * time.Second
+	DETAIL_CACHE_TTL = 7 * 24 * time.Hour // descriptions and histories change slowly
+	DETAIL_PREFIX    = "detail-"          // cache names of the detail pages
+)
+
+// selectors of the product detail page, the offers use the desktop offer rows
+var detailSelectors = struct {
+	Description  selectorChain
+	HistoryRow   string
+	HistoryDate  selectorChain
+	HistoryPrice selectorChain
+	Market       selectorChain
+}{
+	Description:  selectorChain{".product_description", ".product_info_text", `meta[name="description"]`},
+	HistoryRow:   ".price_history_row, .price_history tr",
+	HistoryDate:  selectorChain{".price_history_date", "td:nth-child(1)"},
+	HistoryPrice: selectorChain{".price_history_price", "td:nth-child(2)"},
+	Market:       selectorChain{".discounts_shop_name a span", ".discounts_shop_name"},
+}
+
+// pricePoint - price of the product history shown on the detail page
+type pricePoint = postprocess.PricePoint
+
+// productDetail - data of the product detail page
+type productDetail struct {
+	Description  string
+	AllMarkets   []string // all markets with an offer, not only the scraped ones
+	PriceHistory []pricePoint
+	Ean          string
+	ProductCode  string
+}
+
+// detailCacheName - cache name of the detail page
+func detailCacheName(productUrl string) string {
+	hash := sha256.Sum256([]byte(productUrl))
+	slug := productUrl
+	if i := strings.LastIndex(strings.TrimSuffix(slug, "/"), "/"); i >= 0 {
+		slug = slug[i+1:]
+	}
+	return fmt.Sprintf("%s%s-%s.html", DETAIL_PREFIX, cacheSlug(slug), hex.EncodeToString(hash[:4]))
+}
+
+// extractDetail - description, markets and price history of the detail page
+func extractDetail(body []byte) (productDetail, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return productDetail{}, err
+	}
+	var detail productDetail
+	description := findFirst(detailSelectors.Description, doc.Selection).First()
+	if content, ok := description.Attr("content"); ok {
+		detail.Description = content
+	} else {
+		detail.Description = description.Text()
+	}
+	detail.Description = sanitizeString(strings.Join(strings.Fields(detail.Description), " "))
+
+	// identifiers of the data attributes, the structured data or the text
+	detail.Ean = normalizeEan(attrCode(doc.Selection, eanAttrs))
+	detail.ProductCode = attrCode(doc.Selection, productCodeAttrs)
+	for _, p := range extractStructuredData(doc) {
+		if detail.Ean == "" {
+			detail.Ean = normalizeEan(p.Ean)
+		}
+		if detail.ProductCode == "" {
+			detail.ProductCode = p.Code
+		}
+	}
+	if m := reEanText.FindStringSubmatch(doc.Text()); detail.Ean == "" && m != nil {
+		detail.Ean = normalizeEan(m[1])
+	}
+
+	seen := make(map[string]bool)
+	findFirst(detailSelectors.Market, doc.Selection).Each(func(i int, s *goquery.Selection) {
+		market := sanitizeString(strings.TrimSpace(s.Text()))
+		if market != "" && !seen[market] {
+			seen[market] = true
+			detail.AllMarkets = append(detail.AllMarkets, market)
+		}
+	})
+
+	doc.Find(detailSelectors.HistoryRow).Each(func(i int, row *goquery.Selection) {
+		date := strings.TrimSpace(findFirst(detailSelectors.HistoryDate, row).First().Text())
+		price, ok := parsePrice(findFirst(detailSelectors.HistoryPrice, row).First().Text())
+		if date != "" && ok {
+			detail.PriceHistory = append(detail.PriceHistory, pricePoint{Date: date, Price: price})
+		}
+	})
+	return detail, nil
+}
+
+// findFirst - matches of the first selector of the chain matching within s
+func findFirst(chain selectorChain, s *goquery.Selection) *goquery.Selection {
+	var found *goquery.Selection
+	for _, selector := range chain {
+		if found = s.Find(selector); found.Length() > 0 {
+			break
+		}
+	}
+	return found
+}
+
+// loadDetail - detail page from the cache with its own TTL, else downloaded
+func loadDetail(ctx context.Context, UA string, productUrl string, qlog *queryLogger) (productDetail, error) {
+	cacheName := detailCacheName(productUrl)
+	body, meta, err := htmlCache.Load(cacheName)
+	fresh := err == nil && (offlineMode || time.Since(meta.FetchTime) <= time.Duration(config.DetailCacheTtl))
+	if !fresh {
+		if offlineMode {
+			return productDetail{}, err // cache only
+		}
+		var header map[string][]string
+		body, header, _, err = fetchPageWithRetries(ctx, UA, productUrl, cacheName, "", qlog)
+		if err != nil {
+			return productDetail{}, err
+		}
+		stats.bytes.Add(int64(len(body)))
+		saveHtmlToCache(cacheName, newCacheMeta(productUrl, "", header, time.Now()), body, qlog)
+		sleep := time.Duration(config.DetailSleep) + time.Duration(rand.Int63n(int64(config.SleepJitter)+1))
+		sleepContext(ctx, sleep)
+	}
+	return extractDetail(body)
+}
+
+// scrapeDetails - second stage: fetch the detail page of each unique product URL and attach its data
+func scrapeDetails(UA string, goods []Goods) []Goods {
+	if !config.DetailPages {
+		return goods
+	}
+	setStage("details")
+	defer stats.stageDone("details", time.Now())
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	var urls []string
+	seen := make(map[string]bool)
+	for _, item := range goods {
+		if strings.HasPrefix(item.Url, KOOPI_HOME_URL) && !seen[item.Url] {
+			seen[item.Url] = true
+			urls = append(urls, item.Url)
+		}
+	}
+
+	details := make(map[string]productDetail)
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	tasks := make(chan string)
+	failed := 0
+	for worker := 1; worker <= config.DetailThreads; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			qlog := newQueryLogger("detail", worker)
+			for productUrl := range tasks {
+				detail, err := loadDetail(ctx, UA, productUrl, qlog)
+				mutex.Lock()
+				if err != nil {
+					failed++
+				} else {
+					details[productUrl] = detail
+				}
+				mutex.Unlock()
+				if err != nil && !errors.Is(err, os.ErrNotExist) && ctx.Err() == nil {
+					qlog.Printf("💥 detail %s: %v", productUrl, err)
+				}
+			}
+		}()
+	}
+	for _, productUrl := range urls {
+		if ctx.Err() != nil {
+			break
+		}
+		tasks <- productUrl
+	}
+	close(tasks)
+	wg.Wait()
+
+	for i := range goods {
+		if detail, ok := details[goods[i].Url]; ok {
+			goods[i].Description = detail.Description
+			goods[i].AllMarkets = detail.AllMarkets
+			goods[i].PriceHistory = detail.PriceHistory
+			setProductCodes(&goods[i], detail.Ean, detail.ProductCode)
+		}
+	}
+	fmt.Printf("\n🔬 details: %d of %d products, %d failed\n", len(details), len(urls), failed)
+	return goods
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"net/url"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// root of the category navigation
+const KOOPI_CATEGORIES_URL = KOOPI_HOME_URL + "/slevy"
+
+// category navigation links and pagination links of the category pages
+const (
+	DISCOVER_LINK_SELECTOR = "a[href]"
+	DISCOVER_PAGE_SELECTOR = `a[href*="page="]`
+	DISCOVER_DEPTH         = 2
+)
+
+// discoveredCategory - candidate row of the scrape list
+type discoveredCategory struct {
+	category string // heading of the top level category
+	name     string // link text
+	url      string
+	pages    int
+	depth    int
+}
+
+// categoryPage - subcategory links, heading and page count of a category page
+func categoryPage(body []byte, pageUrl *url.URL) (children []discoveredCategory, title string, pages int, err error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", 0, err
+	}
+	prefix := strings.TrimSuffix(pageUrl.Path, "/") + "/"
+	seen := make(map[string]bool)
+	doc.Find(DISCOVER_LINK_SELECTOR).Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		link, err := pageUrl.Parse(href)
+		if err != nil || link.Host != pageUrl.Host || !strings.HasPrefix(link.Path, prefix) {
+			return
+		}
+		// direct subcategories only, the deeper ones are found on their pages
+		rest := strings.Trim(strings.TrimPrefix(link.Path, prefix), "/")
+		if rest == "" || strings.Contains(rest, "/") {
+			return
+		}
+		link.RawQuery, link.Fragment = "", ""
+		name := strings.Join(strings.Fields(reFacetNoise.ReplaceAllString(s.Text(), "")), " ")
+		if name == "" || seen[link.String()] {
+			return
+		}
+		seen[link.String()] = true
+		children = append(children, discoveredCategory{name: name, url: link.String()})
+	})
+
+	pages = 1
+	doc.Find(DISCOVER_PAGE_SELECTOR).Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		if link, err := pageUrl.Parse(href); err == nil && link.Path == pageUrl.Path {
+			if n, err := strconv.Atoi(link.Query().Get("page")); err == nil && n > pages {
+				pages = n
+			}
+		}
+	})
+	title = strings.Join(strings.Fields(doc.Find("h1").First().Text()), " ")
+	return children, title, pages, nil
+}
+
+// discoverCategories - crawl the category navigation breadth first, returns the leaf categories
+func discoverCategories(ctx context.Context, UA string, startUrl string, maxDepth int) ([]discoveredCategory, error) {
+	queue := []discoveredCategory{{url: startUrl}}
+	visited := map[string]bool{startUrl: true}
+	var leaves []discoveredCategory
+	for len(queue) > 0 && ctx.Err() == nil {
+		current := queue[0]
+		queue = queue[1:]
+		if len(visited) > 1 {
+			sleepContext(ctx, time.Duration(config.SleepMin)+time.Duration(rand.Int63n(int64(config.SleepJitter)+1)))
+		}
+
+		pageUrl, _ := url.Parse(current.url)
+		body, _, _, err := fetchPageWithRetries(ctx, UA, current.url, "", "", nil)
+		if err != nil {
+			if current.depth == 0 {
+				return nil, err
+			}
+			log.Printf("💥 [%s] %v", current.url, err)
+			continue
+		}
+		children, title, pages, err := categoryPage(body, pageUrl)
+		if err != nil {
+			return nil, err
+		}
+		if current.depth == 1 && title != "" {
+			current.category = strings.ToUpper(title)
+		}
+		current.pages = pages
+		log.Printf("🧭 %s: %d subcategories, %d pages", current.url, len(children), pages)
+
+		if current.depth > 0 && (len(children) == 0 || current.depth >= maxDepth) {
+			leaves = append(leaves, current)
+			continue
+		}
+		for _, child := range children {
+			if visited[child.url] {
+				continue
+			}
+			visited[child.url] = true
+			child.depth = current.depth + 1
+			child.category = current.category
+			if child.category == "" {
+				child.category = strings.ToUpper(child.name)
+			}
+			queue = append(queue, child)
+		}
+	}
+	return leaves, ctx.Err()
+}
+
+// runDiscover - generate the candidate scrape list from the category navigation
+func runDiscover(args []string) error {
+	flags := flag.NewFlagSet("discover", flag.ExitOnError)
+	start := flags.String("start", KOOPI_CATEGORIES_URL, "root of the category navigation")
+	depth := flags.Int("depth", DISCOVER_DEPTH, "levels of subcategories to follow")
+	appendRows := flags.Bool("append", false, "append the new rows to the input CSV instead of printing them")
+	parseInterspersed(flags, args)
+	if *depth < 1 {
+		return errors.New("--depth must be at least 1")
+	}
+	if u, err := url.Parse(*start); err != nil || u.Host == "" {
+		return fmt.Errorf("invalid URL %q", *start)
+	}
+
+	UA, err := setupRun()
+	if err != nil {
+		return err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	categories, err := discoverCategories(ctx, UA, *start, *depth)
+	if err != nil {
+		return err
+	}
+
+	existing, err := existingQueries(config.InputCsv)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	var rows [][]string
+	for _, c := range categories {
+		if existing[normalizeCzechString(c.url)] {
+			continue
+		}
+		rows = append(rows, []string{c.category, c.url, fmt.Sprint(c.pages)})
+	}
+	log.Printf("🧭 %d categories found, %d new for %s", len(categories), len(rows), config.InputCsv)
+	if len(rows) == 0 {
+		return nil
+	}
+	if !*appendRows {
+		writer := csv.NewWriter(os.Stdout)
+		writer.WriteAll(rows)
+		return writer.Error()
+	}
+	return appendInputRows(rows)
+}
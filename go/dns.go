@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// cachingDialer - dialer using custom DNS servers and caching resolved addresses
+type cachingDialer struct {
+	dialer   *net.Dialer
+	resolver *net.Resolver
+	cache    bool
+
+	mutex sync.Mutex
+	addrs map[string][]string
+}
+
+// newCachingDialer - create a dialer for the configured DNS servers
+func newCachingDialer(servers []string, cache bool) *cachingDialer {
+	d := &cachingDialer{
+		dialer:   &net.Dialer{Timeout: time.Duration(config.DialTimeout), KeepAlive: 30 * time.Second},
+		resolver: net.DefaultResolver,
+		cache:    cache,
+		addrs:    make(map[string][]string),
+	}
+	if len(servers) > 0 {
+		var addrs []string
+		for _, server := range servers {
+			if _, _, err := net.SplitHostPort(server); err != nil {
+				server = net.JoinHostPort(server, "53") // default DNS port
+			}
+			addrs = append(addrs, server)
+		}
+		var next atomic.Uint32
+		d.resolver = &net.Resolver{
+			PreferGo: true,
+			Dial: func(ctx context.Context, network, _ string) (net.Conn, error) {
+				// round robin over the servers
+				server := addrs[int(next.Add(1))%len(addrs)]
+				return d.dialer.DialContext(ctx, network, server)
+			},
+		}
+	}
+	return d
+}
+
+// lookup - resolve the host, using the run cache
+func (d *cachingDialer) lookup(ctx context.Context, host string) ([]string, error) {
+	if net.ParseIP(host) != nil {
+		return []string{host}, nil
+	}
+	if d.cache {
+		d.mutex.Lock()
+		addrs, ok := d.addrs[host]
+		d.mutex.Unlock()
+		if ok {
+			return addrs, nil
+		}
+	}
+	addrs, err := d.resolver.LookupHost(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	if d.cache {
+		d.mutex.Lock()
+		d.addrs[host] = addrs
+		d.mutex.Unlock()
+	}
+	return addrs, nil
+}
+
+// DialContext - dial the first reachable resolved address
+func (d *cachingDialer) DialContext(ctx context.Context, network, address string) (net.Conn, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	addrs, err := d.lookup(ctx, host)
+	if err != nil {
+		return nil, err
+	}
+	var lastErr error
+	for _, addr := range addrs {
+		conn, err := d.dialer.DialContext(ctx, network, net.JoinHostPort(addr, port))
+		if err == nil {
+			return conn, nil
+		}
+		lastErr = err
+	}
+	if lastErr == nil {
+		lastErr = fmt.Errorf("no addresses for %s", host)
+	}
+	return nil, lastErr
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+)
+
+// exportFormats - formats of koopi export, written from the CSV output
+var exportFormats = map[string]func(snap *outputSnapshot, filename string) error{
+	"xlsx": writeXlsx,
+	"xml":  appendToXml,
+}
+
+// exportFormatNames - sorted names of the export formats
+func exportFormatNames() string {
+	var names []string
+	for name := range exportFormats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return strings.Join(names, " | ")
+}
+
+// runExport - convert the latest CSV output to another format
+func runExport(args []string) error {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", "xlsx", "output format: "+exportFormatNames())
+	from := flags.String("from", config.OutputCsv, "CSV output to export")
+	out := flags.String("out", "", "output file, default the CSV output with the format extension")
+	parseInterspersed(flags, args)
+
+	write, ok := exportFormats[*format]
+	if !ok {
+		return fmt.Errorf("unknown format %q, use %s", *format, exportFormatNames())
+	}
+	if *out == "" {
+		*out = strings.TrimSuffix(*from, ".csv") + "." + *format
+	}
+	goods, err := loadGoodsFromCsv(*from)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	var markets []string
+	for _, item := range goods {
+		if !seen[item.Market] {
+			seen[item.Market] = true
+			markets = append(markets, item.Market)
+		}
+	}
+	if err := write(newOutputSnapshot(goods, markets), *out); err != nil {
+		return fmt.Errorf("[%s] %w", *out, err)
+	}
+	log.Printf("📤 %d offers exported to %s", len(goods), *out)
+	return nil
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// exprNode - node of a parsed arithmetic expression
+type exprNode interface {
+	eval(vars map[string]float64) (float64, bool)
+}
+
+type exprNumber float64
+
+type exprVar string
+
+type exprUnary struct {
+	x exprNode
+}
+
+type exprBinary struct {
+	op   byte
+	l, r exprNode
+}
+
+func (n exprNumber) eval(map[string]float64) (float64, bool) {
+	return float64(n), true
+}
+
+func (n exprVar) eval(vars map[string]float64) (float64, bool) {
+	v, ok := vars[string(n)]
+	return v, ok
+}
+
+func (n exprUnary) eval(vars map[string]float64) (float64, bool) {
+	v, ok := n.x.eval(vars)
+	return -v, ok
+}
+
+func (n exprBinary) eval(vars map[string]float64) (float64, bool) {
+	l, ok := n.l.eval(vars)
+	if !ok {
+		return 0, false
+	}
+	r, ok := n.r.eval(vars)
+	if !ok {
+		return 0, false
+	}
+	var v float64
+	switch n.op {
+	case '+':
+		v = l + r
+	case '-':
+		v = l - r
+	case '*':
+		v = l * r
+	case '/':
+		if r == 0 {
+			return 0, false
+		}
+		v = l / r
+	}
+	return v, !math.IsNaN(v) && !math.IsInf(v, 0)
+}
+
+// exprParser - recursive descent parser for + - * / ( ), numbers and variables
+type exprParser struct {
+	input string
+	pos   int
+}
+
+// parseExpr - parse the expression, e.g. "price / pack_size"
+func parseExpr(input string) (exprNode, error) {
+	p := &exprParser{input: input}
+	node, err := p.parseSum()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpaces()
+	if p.pos < len(p.input) {
+		return nil, fmt.Errorf("unexpected %q at %d", p.input[p.pos:], p.pos)
+	}
+	return node, nil
+}
+
+func (p *exprParser) skipSpaces() {
+	for p.pos < len(p.input) && p.input[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *exprParser) parseSum() (exprNode, error) {
+	node, err := p.parseProduct()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || (p.input[p.pos] != '+' && p.input[p.pos] != '-') {
+			return node, nil
+		}
+		op := p.input[p.pos]
+		p.pos++
+		r, err := p.parseProduct()
+		if err != nil {
+			return nil, err
+		}
+		node = exprBinary{op, node, r}
+	}
+}
+
+func (p *exprParser) parseProduct() (exprNode, error) {
+	node, err := p.parseFactor()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if p.pos >= len(p.input) || (p.input[p.pos] != '*' && p.input[p.pos] != '/') {
+			return node, nil
+		}
+		op := p.input[p.pos]
+		p.pos++
+		r, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		node = exprBinary{op, node, r}
+	}
+}
+
+func (p *exprParser) parseFactor() (exprNode, error) {
+	p.skipSpaces()
+	if p.pos >= len(p.input) {
+		return nil, fmt.Errorf("unexpected end of expression")
+	}
+	c := p.input[p.pos]
+	switch {
+	case c == '-':
+		p.pos++
+		x, err := p.parseFactor()
+		if err != nil {
+			return nil, err
+		}
+		return exprUnary{x}, nil
+	case c == '(':
+		p.pos++
+		node, err := p.parseSum()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if p.pos >= len(p.input) || p.input[p.pos] != ')' {
+			return nil, fmt.Errorf("missing ) at %d", p.pos)
+		}
+		p.pos++
+		return node, nil
+	case c == '.' || unicode.IsDigit(rune(c)):
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] == '.' || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+		v, err := strconv.ParseFloat(p.input[start:p.pos], 64)
+		if err != nil {
+			return nil, err
+		}
+		return exprNumber(v), nil
+	case c == '_' || unicode.IsLetter(rune(c)):
+		start := p.pos
+		for p.pos < len(p.input) && (p.input[p.pos] == '_' || unicode.IsLetter(rune(p.input[p.pos])) || unicode.IsDigit(rune(p.input[p.pos]))) {
+			p.pos++
+		}
+		return exprVar(strings.ToLower(p.input[start:p.pos])), nil
+	}
+	return nil, fmt.Errorf("unexpected %q at %d", c, p.pos)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExprEval(t *testing.T) {
+	vars := map[string]float64{"price": 30, "pack_size": 4, "zero": 0}
+	tests := []struct {
+		expr  string
+		value float64
+		ok    bool
+	}{
+		{"price / pack_size", 7.5, true},
+		{"1 + 2 * 3", 7, true},
+		{"(1 + 2) * 3", 9, true},
+		{"10 - 4 - 3", 3, true}, // left associative
+		{"-price + 5", -25, true},
+		{"--2", 2, true},
+		{".5 * PRICE", 15, true}, // variables are case-insensitive
+		{"price/zero", 0, false},
+		{"baseline - price", 0, false}, // unknown variable of the offer
+	}
+	for _, tt := range tests {
+		node, err := parseExpr(tt.expr)
+		if err != nil {
+			t.Errorf("%q: %v", tt.expr, err)
+			continue
+		}
+		value, ok := node.eval(vars)
+		if value != tt.value || ok != tt.ok {
+			t.Errorf("%q = %v %v, want %v %v", tt.expr, value, ok, tt.value, tt.ok)
+		}
+	}
+}
+
+func TestExprErrors(t *testing.T) {
+	tests := []struct {
+		expr string
+		err  string
+	}{
+		{"", "unexpected end of expression"},
+		{"price +", "unexpected end of expression"},
+		{"(price + 1", "missing ) at 10"},
+		{"price 2", `unexpected "2" at 6`},
+		{"price % 2", `unexpected "% 2" at 6`},
+		{"1..2", "invalid syntax"},
+		{"* 2", `unexpected '*' at 0`},
+	}
+	for _, tt := range tests {
+		_, err := parseExpr(tt.expr)
+		if err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%q: error %v, want %q", tt.expr, err, tt.err)
+		}
+	}
+}
+
+func TestComputedFields(t *testing.T) {
+	item := Goods{Price: "119,90 Kč", Volume: "4x 0,5 l", Discount: "-25 %"}
+	setVolumeValues(&item)
+	setPriceValues(&item)
+	derivePricePerUnit(&item)
+	setDiscount(&item)
+
+	fields := []ComputedField{
+		{Name: "piece", Expr: "price / pack_size"},
+		{Name: "liters", Expr: "pack_size * amount"},
+		{Name: "before", Expr: "price / (1 - discount / 100)"},
+		{Name: "per_liter", Expr: "ppunit"},
+		{Name: "double", Expr: "piece * 2"}, // an earlier field
+		{Name: "saving", Expr: "baseline - price"},
+	}
+	if err := prepareComputedFields(fields); err != nil {
+		t.Fatal(err)
+	}
+	goods := []Goods{item}
+	applyComputedFields(goods, fields)
+	want := map[string]float64{"piece": 29.98, "liters": 2, "before": 159.87, "per_liter": 59.95, "double": 59.96}
+	for name, value := range want {
+		if goods[0].Computed[name] != value {
+			t.Errorf("%s = %v, want %v", name, goods[0].Computed[name], value)
+		}
+	}
+	if _, ok := goods[0].Computed["saving"]; ok {
+		t.Error("saving computed without a baseline")
+	}
+
+	if err := prepareComputedFields([]ComputedField{{Name: "bad", Expr: "price *"}}); err == nil || !strings.Contains(err.Error(), `computed field "bad"`) {
+		t.Errorf("bad expression: %v", err)
+	}
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"runtime/debug"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	FAILURE_REPORT_FILE    = "failure-report.json"
+	FAILURE_NOTIFY_TIMEOUT = 30 * time.Second
+	EXIT_USAGE             = 2        // wrong arguments of a command
+	COMMAND_SCRAPE         = "scrape" // running without a command
+)
+
+// errUsage - wrong arguments, printed to the user without a failure report
+var errUsage = errors.New("usage")
+
+// set by runScraper, also when run by demo or daemon, failures of the other commands are not reported
+var scrapeRunning atomic.Bool
+
+// failureReport - written when the process dies on an error or a panic
+type failureReport struct {
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	Tag     string    `json:"tag,omitempty"`
+	Stage   string    `json:"stage"`
+	Error   string    `json:"error"`
+	Stack   string    `json:"stack,omitempty"` // panics only
+
+	// partial stats of the run
+	Started time.Time `json:"started,omitzero"`
+	Stats   string    `json:"stats,omitempty"`
+	Pages   int64     `json:"pages,omitempty"`
+	Items   int64     `json:"items,omitempty"`
+	Errors  int64     `json:"errors,omitempty"`
+}
+
+// stage of the current process, see setStage
+var runStage atomic.Value
+
+// setStage - record what the process is doing for the failure report
+func setStage(stage string) {
+	runStage.Store(stage)
+}
+
+// currentStage - the last recorded stage
+func currentStage() string {
+	stage, _ := runStage.Load().(string)
+	return stage
+}
+
+// newFailureReport - the report of the error with the partial stats of the run
+func newFailureReport(command string, err string) failureReport {
+	r := failureReport{Time: time.Now(), Command: command, Tag: *tagFlag, Stage: currentStage(), Error: err}
+	if !runStarted.IsZero() {
+		r.Started = runStarted
+		r.Stats = stats.String()
+		r.Pages = stats.pages.Load()
+		r.Items = stats.items.Load()
+		r.Errors = stats.errors.Load()
+	}
+	return r
+}
+
+// writeFailureReport - write the report to config.FailureReport and pipe it to config.FailureCommand
+func writeFailureReport(r failureReport) {
+	content, err := json.MarshalIndent(r, "", "  ")
+	if err != nil {
+		log.Printf("💥 error encoding failure report: %v", err)
+		return
+	}
+	if config.FailureReport != "" {
+		if err := os.WriteFile(config.FailureReport, content, 0644); err != nil {
+			log.Printf("[%s] 💥 error writing failure report: %v", config.FailureReport, err)
+		} else {
+			log.Printf("🧾 failure report written to %s", config.FailureReport)
+		}
+	}
+	if config.FailureCommand != "" {
+		ctx, cancel := context.WithTimeout(context.Background(), FAILURE_NOTIFY_TIMEOUT)
+		defer cancel()
+		cmd := exec.CommandContext(ctx, "sh", "-c", config.FailureCommand)
+		cmd.Stdin = bytes.NewReader(content)
+		cmd.Env = append(os.Environ(), "KOOPI_STAGE="+r.Stage, "KOOPI_ERROR="+r.Error)
+		if output, err := cmd.CombinedOutput(); err != nil {
+			log.Printf("💥 failure command: %v %s", err, bytes.TrimSpace(output))
+		}
+	}
+}
+
+// reportFailures - only scrape runs write the failure report and run the failure command
+func reportFailures(command string) bool {
+	return command == COMMAND_SCRAPE || scrapeRunning.Load()
+}
+
+// fatal - log the error, report it and exit
+func fatal(command string, err error) {
+	if errors.Is(err, errUsage) {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(EXIT_USAGE)
+	}
+	log.Printf("💥 %v", err)
+	if reportFailures(command) {
+		writeFailureReport(newFailureReport(command, err.Error()))
+	}
+	os.Exit(exitCode(err))
+}
+
+// recoverFatal - deferred by main, reports panics of the main goroutine before exiting
+func recoverFatal(command string) {
+	r := recover()
+	if r == nil {
+		return
+	}
+	stack := string(debug.Stack())
+	log.Printf("💥 panic: %v\n%s", r, stack)
+	if reportFailures(command) {
+		report := newFailureReport(command, fmt.Sprint(r))
+		report.Stack = stack
+		writeFailureReport(report)
+	}
+	os.Exit(2)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// jobForUrl - scrape job and page number of a search URL, other URLs get an empty query
+func jobForUrl(rawUrl string) (scrapeJob, int, error) {
+	u, err := url.Parse(rawUrl)
+	if err != nil || u.Host == "" {
+		return scrapeJob{}, 0, fmt.Errorf("invalid URL %q", rawUrl)
+	}
+	query := u.Query().Get("f")
+	pageNum, err := strconv.Atoi(u.Query().Get("page"))
+	if err != nil || pageNum < 1 {
+		pageNum = 1
+	}
+	return scrapeJob{url: rawUrl, cacheKey: cacheKeyFor(query, pageNum, rawUrl), query: query}, pageNum, nil
+}
+
+// runFetch - fetch or load one URL, dump headers and body, optionally run the extraction
+func runFetch(args []string) error {
+	flags := flag.NewFlagSet("fetch", flag.ExitOnError)
+	showExtraction := flags.Bool("show-extraction", false, "run the extraction and dump the goods as JSON")
+	noCache := flags.Bool("no-cache", false, "always download, ignore the cache")
+	save := flags.Bool("save", false, "store the downloaded page in the cache")
+	layout := flags.String("layout", "", "selector set: desktop | mobile (default by host)")
+	positional := parseInterspersed(flags, args)
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: koopi fetch [flags] <url>", errUsage)
+	}
+
+	job, pageNum, err := jobForUrl(positional[0])
+	if err != nil {
+		return err
+	}
+	if *layout == "" {
+		*layout = LAYOUT_DESKTOP
+		if strings.HasPrefix(job.url, KOOPI_MOBILE_URL) {
+			*layout = LAYOUT_MOBILE
+		}
+	}
+	if _, ok := selectorSets[*layout]; !ok {
+		return fmt.Errorf("unknown layout %q", *layout)
+	}
+
+	UA, err := setupRun()
+	if err != nil {
+		return err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+	migrateCacheKey(legacyCacheKey(job.query, pageNum), job.cacheKey)
+	if *layout == LAYOUT_MOBILE {
+		job.cacheKey = mobileCacheName(job.cacheKey)
+	}
+
+	// headers and bodies are dumped by the HTTP debugging
+	*debugHttpFlag, *debugBodiesFlag, *debugQueriesFlag = true, true, ""
+
+	var body []byte
+	fetchTime := time.Now()
+	if !*noCache {
+		var meta cacheMeta
+		body, meta, err = loadHtmlFromCache(job.cacheKey)
+		if err == nil {
+			fetchTime = meta.FetchTime
+			log.Printf("💾 from cache %s, fetched %s (status %d)", job.cacheKey, meta.FetchTime.Format(time.RFC3339), meta.Status)
+			for _, name := range cachedHeaders {
+				if value, ok := meta.Headers[name]; ok {
+					log.Printf("   %s: %s", name, value)
+				}
+			}
+			debugDir := statePath(config.DebugDir)
+			if err := os.MkdirAll(debugDir, 0755); err != nil {
+				return err
+			}
+			filePath := filepath.Join(debugDir, fmt.Sprintf("%s-cache-%s", time.Now().Format("20060102-150405"), job.cacheKey))
+			if err := os.WriteFile(filePath, body, 0644); err != nil {
+				return err
+			}
+			log.Printf("🐞 body saved to %s", filePath)
+		}
+	}
+	if body == nil {
+		var header http.Header
+		body, header, err = fetchPage(context.Background(), UA, job.url, job.cacheKey, job.query, nil)
+		if err != nil {
+			return err
+		}
+		if *save {
+			saveHtmlToCache(job.cacheKey, newCacheMeta(job.url, job.query, header, fetchTime), body, nil)
+		}
+	}
+	log.Printf("📄 %s, %d bytes", job.cacheKey, len(body))
+
+	if !*showExtraction {
+		return nil
+	}
+	goods, err := extractGoods(body, *layout, job.category, job.query, fetchTime.Format("20060102"))
+	if err != nil {
+		return err
+	}
+	setSource(goods, job.url, job.cacheKey, fetchTime)
+	out, err := json.MarshalIndent(goods, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(out))
+	log.Printf("📦 %d goods extracted", len(goods))
+	return nil
+}
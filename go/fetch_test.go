@@ -0,0 +1,71 @@
+package main
+
+import (
+	"flag"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseInterspersed(t *testing.T) {
+	tests := []struct {
+		args       []string
+		positional []string
+		extract    bool
+		layout     string
+	}{
+		{[]string{"--show-extraction", "URL"}, []string{"URL"}, true, ""},
+		{[]string{"URL", "--show-extraction"}, []string{"URL"}, true, ""},
+		{[]string{"URL", "--layout", "mobile", "--show-extraction"}, []string{"URL"}, true, "mobile"},
+		{[]string{"--layout=mobile", "URL", "OTHER"}, []string{"URL", "OTHER"}, false, "mobile"},
+		{[]string{"URL", "--", "--show-extraction"}, []string{"URL", "--show-extraction"}, false, ""},
+		{nil, nil, false, ""},
+	}
+	for _, tt := range tests {
+		flags := flag.NewFlagSet("fetch", flag.ContinueOnError)
+		extract := flags.Bool("show-extraction", false, "")
+		layout := flags.String("layout", "", "")
+		positional := parseInterspersed(flags, tt.args)
+		if !reflect.DeepEqual(positional, tt.positional) || *extract != tt.extract || *layout != tt.layout {
+			t.Errorf("%q: got %q extract=%v layout=%q, want %q extract=%v layout=%q",
+				tt.args, positional, *extract, *layout, tt.positional, tt.extract, tt.layout)
+		}
+	}
+}
+
+func TestRunFetchFlagAfterUrl(t *testing.T) {
+	const searchUrl = KOOPI_HOME_URL + "/hledej?f=pivo"
+	// an unknown layout fails before any download, so the flag must have been parsed after the URL
+	for _, args := range [][]string{
+		{"--layout", "bogus", searchUrl},
+		{searchUrl, "--layout", "bogus"},
+		{searchUrl, "--show-extraction", "--layout=bogus"},
+	} {
+		err := runFetch(args)
+		if err == nil || !strings.Contains(err.Error(), `unknown layout "bogus"`) {
+			t.Errorf("%q: got %v, want the unknown layout error", args, err)
+		}
+	}
+	if err := runFetch([]string{searchUrl, "--show-extraction", "extra"}); err == nil || !strings.HasPrefix(err.Error(), "usage:") {
+		t.Errorf("two URLs: got %v, want the usage error", err)
+	}
+}
+
+func TestCommandsFlagAfterArguments(t *testing.T) {
+	dir := t.TempDir()
+	filename := filepath.Join(dir, "baselines.json")
+	if err := runBaseline([]string{"set", "Máslo", "39,90", "--file", filename}); err != nil {
+		t.Fatal(err)
+	}
+	baselines, err := loadBaselines(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if baselines["Máslo"].Price != 39.9 {
+		t.Errorf("baseline set with a trailing --file: got %v", baselines)
+	}
+	if err := runValidateOutput([]string{filepath.Join(dir, "missing.json"), "--schema", filepath.Join(dir, "missing.schema.json")}); err == nil || !strings.Contains(err.Error(), "missing.schema.json") {
+		t.Errorf("validate-output with a trailing --schema: got %v, want the schema file error", err)
+	}
+}
@@ -4,11 +4,24 @@ go 1.26.1
 
 require (
 	github.com/PuerkitoBio/goquery v1.10.3
+	github.com/andybalholm/cascadia v1.3.3
 	github.com/chai2010/webp v1.4.0
+	github.com/chromedp/chromedp v0.16.0
+	github.com/gen2brain/avif v0.4.4
+	github.com/lib/pq v1.12.3
+	go.etcd.io/bbolt v1.5.0
+	golang.org/x/net v0.39.0
 	golang.org/x/text v0.33.0
 )
 
 require (
-	github.com/andybalholm/cascadia v1.3.3 // indirect
-	golang.org/x/net v0.39.0 // indirect
+	github.com/chromedp/cdproto v0.0.0-20260714215040-dc233986426f // indirect
+	github.com/chromedp/sysutil v1.1.0 // indirect
+	github.com/ebitengine/purego v0.8.3 // indirect
+	github.com/go-json-experiment/json v0.0.0-20260623181947-01eb4420fa68 // indirect
+	github.com/gobwas/httphead v0.1.0 // indirect
+	github.com/gobwas/pool v0.2.1 // indirect
+	github.com/gobwas/ws v1.4.0 // indirect
+	github.com/tetratelabs/wazero v1.9.0 // indirect
+	golang.org/x/sys v0.47.0 // indirect
 )
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os/exec"
+	"time"
+
+	"github.com/chromedp/chromedp"
+)
+
+// headlessBrowserPath - Chrome or Chromium binary of chromedp, config.HeadlessBrowser is a name in $PATH or a path
+func headlessBrowserPath() (string, error) {
+	path, err := exec.LookPath(config.HeadlessBrowser)
+	if err != nil {
+		return "", fmt.Errorf("--headless: browser %q not found, set headless_browser: %w", config.HeadlessBrowser, err)
+	}
+	return path, nil
+}
+
+// renderWithHeadlessBrowser - fetch the JS-rendered DOM by chromedp, limited by headless_timeout
+func renderWithHeadlessBrowser(ctx context.Context, UA string, urlToScrape string) ([]byte, error) {
+	execPath, err := headlessBrowserPath()
+	if err != nil {
+		return nil, err
+	}
+	options := append(chromedp.DefaultExecAllocatorOptions[:],
+		chromedp.ExecPath(execPath),
+		chromedp.UserAgent(UA),
+		chromedp.DisableGPU,
+		chromedp.NoSandbox,
+	)
+	allocCtx, cancelAlloc := chromedp.NewExecAllocator(ctx, options...)
+	defer cancelAlloc()
+	browserCtx, cancelBrowser := chromedp.NewContext(allocCtx)
+	defer cancelBrowser()
+	timeout := time.Duration(config.HeadlessTimeout)
+	browserCtx, cancel := context.WithTimeout(browserCtx, timeout)
+	defer cancel()
+
+	var html string
+	err = chromedp.Run(browserCtx,
+		chromedp.Navigate(urlToScrape),
+		chromedp.WaitReady("body", chromedp.ByQuery),
+		chromedp.OuterHTML("html", &html, chromedp.ByQuery),
+	)
+	if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+		return nil, fmt.Errorf("%s: timed out after %v", urlToScrape, timeout)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", urlToScrape, err)
+	}
+	return []byte(html), nil
+}
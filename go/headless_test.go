@@ -0,0 +1,20 @@
+package main
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestHeadlessBrowserMissing(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.HeadlessBrowser = "koopi-no-such-browser"
+
+	if _, err := headlessBrowserPath(); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("missing browser: %v", err)
+	}
+	if _, err := renderWithHeadlessBrowser(context.Background(), "UA", KOOPI_HOME_URL); err == nil {
+		t.Error("rendered without a browser")
+	}
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"time"
+)
+
+const ID_MIGRATION_FILE = "id-migration.json"
+
+// outputIds - products of one koopi.json output keyed by the ID hash
+type outputIds struct {
+	Created string
+	Hashes  map[string]string // hash -> product key
+}
+
+// idMigration - mapping of old ID hashes to new ones
+type idMigration struct {
+	Created string            `json:"created"`
+	From    string            `json:"from"`
+	To      string            `json:"to"`
+	Map     map[string]string `json:"map"`     // old hash -> new hash
+	Removed []string          `json:"removed"` // products no longer present
+
+	Ambiguous []string `json:"ambiguous,omitempty"` // old hashes whose key is shared by several products, not mapped
+}
+
+// productKey - normalized product identity independent of the ID hash algorithm
+func productKey(name, volume string) string {
+	return normalizeCzechString(name) + "|" + normalizeCzechString(volume)
+}
+
+// migrationKey - product key within its category, the same product may be listed in several
+func migrationKey(item outputProduct) string {
+	return productKey(item.Name, item.Volume) + "|" + normalizeCzechString(item.Cat) + "|" + normalizeCzechString(item.SubCat)
+}
+
+// loadOutputIds - load ID hashes and product keys from the JSON output
+func loadOutputIds(filename string) (outputIds, error) {
+	var ids outputIds
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return ids, err
+	}
+	var output struct {
+		Created   string            `json:"created"`
+		IdHashmap map[string]string `json:"idhashmap"`
+		Goods     []outputProduct   `json:"goods"`
+		Products  []outputProduct   `json:"products"` // grouped json_layout
+	}
+	if err := json.Unmarshal(content, &output); err != nil {
+		return ids, fmt.Errorf("[%s] %w", filename, err)
+	}
+	ids.Created = output.Created
+	ids.Hashes = make(map[string]string)
+	for _, item := range append(output.Goods, output.Products...) {
+		hash, ok := output.IdHashmap[strconv.Itoa(item.Id)]
+		if !ok {
+			continue
+		}
+		ids.Hashes[hash] = migrationKey(item)
+	}
+	return ids, nil
+}
+
+// diffIds - map old hashes to new hashes of the same products
+func diffIds(oldIds, newIds outputIds) idMigration {
+	migration := idMigration{
+		Created: time.Now().Format(time.RFC3339),
+		From:    oldIds.Created,
+		To:      newIds.Created,
+		Map:     make(map[string]string),
+	}
+	// keys of several products on either side cannot be mapped one to one
+	newByKey := make(map[string]string)
+	ambiguous := make(map[string]bool)
+	for hash, key := range newIds.Hashes {
+		if _, ok := newByKey[key]; ok {
+			ambiguous[key] = true
+		}
+		newByKey[key] = hash
+	}
+	oldByKey := make(map[string]bool)
+	for _, key := range oldIds.Hashes {
+		if oldByKey[key] {
+			ambiguous[key] = true
+		}
+		oldByKey[key] = true
+	}
+
+	for hash, key := range oldIds.Hashes {
+		if _, ok := newIds.Hashes[hash]; ok {
+			continue // stable
+		}
+		newHash, ok := newByKey[key]
+		switch {
+		case ok && ambiguous[key]:
+			migration.Ambiguous = append(migration.Ambiguous, hash)
+		case ok:
+			migration.Map[hash] = newHash
+		default:
+			migration.Removed = append(migration.Removed, hash)
+		}
+	}
+	sort.Strings(migration.Removed)
+	sort.Strings(migration.Ambiguous)
+	return migration
+}
+
+// runIds - koopi ids migrate|check
+func runIds(args []string) error {
+	if len(args) == 0 {
+		return fmt.Errorf("%w: koopi ids migrate|check --old OLD.json --new NEW.json", errUsage)
+	}
+	flags := flag.NewFlagSet("ids "+args[0], flag.ExitOnError)
+	oldFile := flags.String("old", "", "previous JSON output")
+	newFile := flags.String("new", config.OutputJson, "current JSON output")
+	migrationFile := flags.String("migration", ID_MIGRATION_FILE, "migration file")
+	parseInterspersed(flags, args[1:])
+	if *oldFile == "" {
+		return errors.New("--old is required")
+	}
+
+	oldIds, err := loadOutputIds(*oldFile)
+	if err != nil {
+		return err
+	}
+	newIds, err := loadOutputIds(*newFile)
+	if err != nil {
+		return err
+	}
+	migration := diffIds(oldIds, newIds)
+
+	switch args[0] {
+	case "migrate":
+		content, err := json.MarshalIndent(migration, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := os.WriteFile(*migrationFile, content, 0644); err != nil {
+			return err
+		}
+		for _, hash := range migration.Ambiguous {
+			log.Printf("⚠️ ambiguous %s (%s), map it by hand", hash, oldIds.Hashes[hash])
+		}
+		log.Printf("🆔 %d IDs changed, %d products removed, %d ambiguous, migration saved to %s",
+			len(migration.Map), len(migration.Removed), len(migration.Ambiguous), *migrationFile)
+		return nil
+
+	case "check":
+		// changed IDs must be covered by the published migration
+		published := idMigration{Map: map[string]string{}}
+		if content, err := os.ReadFile(*migrationFile); err == nil {
+			if err := json.Unmarshal(content, &published); err != nil {
+				return fmt.Errorf("[%s] %w", *migrationFile, err)
+			}
+		}
+		var unstable []string
+		for oldHash, newHash := range migration.Map {
+			if published.Map[oldHash] != newHash {
+				unstable = append(unstable, fmt.Sprintf("%s -> %s (%s)", oldHash, newHash, oldIds.Hashes[oldHash]))
+			}
+		}
+		for _, oldHash := range migration.Ambiguous {
+			if _, ok := published.Map[oldHash]; !ok {
+				unstable = append(unstable, fmt.Sprintf("%s -> ? ambiguous (%s)", oldHash, oldIds.Hashes[oldHash]))
+			}
+		}
+		sort.Strings(unstable)
+		for _, line := range unstable {
+			log.Printf("❌ %s", line)
+		}
+		if len(unstable) > 0 {
+			return fmt.Errorf("%d IDs changed without a migration", len(unstable))
+		}
+		log.Printf("🆔 IDs are stable (%d checked, %d migrated)", len(oldIds.Hashes), len(migration.Map))
+		return nil
+	}
+	return fmt.Errorf("unknown ids command %q", args[0])
+}
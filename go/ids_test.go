@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// golden IDs of the published outputs: a change of the ID algorithm breaks the links and the favorites
+// of the users, so it must ship with an ID migration (koopi ids migrate) and the new values here
+var idFixtures = []struct {
+	item Goods
+	md5  string
+	key  string
+	uuid string
+}{
+	{Goods{Name: "Pivo Plzeň 12°", Volume: "0,5 l", Category: "NÁPOJE", SubCat: "lahev"},
+		"4dcac79b46e3cce51fbe88ee55543d0b", "pivo plzen 12|0 5 l", "b9d6c8dc-2a6b-562f-a54f-e2a0a5b7901c"},
+	{Goods{Name: "Máslo", Volume: "250 g", Category: "MLÉKO"},
+		"392948a82483c5cfbc5587161f282235", "maslo|250 g", "f74585c8-69fe-533c-90d4-8458a5268837"},
+}
+
+func TestGoldenIds(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	for _, f := range idFixtures {
+		config.IdScheme = ID_SCHEME_MD5
+		if hash := goodsHash(f.item); hash != f.md5 {
+			t.Errorf("%s: goodsHash = %s, want %s (publish an ID migration)", f.item.Name, hash, f.md5)
+		}
+		if key := productKey(f.item.Name, f.item.Volume); key != f.key {
+			t.Errorf("%s: productKey = %q, want %q (publish an ID migration)", f.item.Name, key, f.key)
+		}
+
+		goods := []Goods{f.item}
+		if err := assignProductIds(goods, ""); err != nil {
+			t.Fatal(err)
+		}
+		if goods[0].ProductId != f.uuid {
+			t.Errorf("%s: product UUID = %s, want %s (publish an ID migration)", f.item.Name, goods[0].ProductId, f.uuid)
+		}
+		config.IdScheme = ID_SCHEME_UUID
+		if hash := goodsHash(goods[0]); hash != f.uuid {
+			t.Errorf("%s: goodsHash with the uuid scheme = %s, want %s", f.item.Name, hash, f.uuid)
+		}
+	}
+}
+
+func TestDiffIds(t *testing.T) {
+	key := func(name, cat string) string {
+		return migrationKey(outputProduct{Name: name, Volume: "1 l", Cat: cat})
+	}
+	oldIds := outputIds{Hashes: map[string]string{
+		"stable":   key("Mléko", "MLÉKO"),
+		"changed":  key("Pivo", "NÁPOJE"),
+		"removed":  key("Cola", "NÁPOJE"),
+		"cat-a":    key("Voda", "NÁPOJE"),
+		"cat-b":    key("Voda", "DROGERIE"),
+		"conflict": key("Džus", "NÁPOJE"),
+	}}
+	newIds := outputIds{Hashes: map[string]string{
+		"stable":     key("Mléko", "MLÉKO"),
+		"changed-2":  key("Pivo", "NÁPOJE"),
+		"cat-a-2":    key("Voda", "NÁPOJE"),
+		"cat-b-2":    key("Voda", "DROGERIE"),
+		"conflict-1": key("Džus", "NÁPOJE"),
+		"conflict-2": key("DŽUS", "NÁPOJE"), // the same key after the normalization
+	}}
+
+	migration := diffIds(oldIds, newIds)
+	// the same name and volume in two categories stay two products
+	wantMap := map[string]string{"changed": "changed-2", "cat-a": "cat-a-2", "cat-b": "cat-b-2"}
+	if !reflect.DeepEqual(migration.Map, wantMap) {
+		t.Errorf("map = %v, want %v", migration.Map, wantMap)
+	}
+	if !reflect.DeepEqual(migration.Removed, []string{"removed"}) {
+		t.Errorf("removed = %v", migration.Removed)
+	}
+	if !reflect.DeepEqual(migration.Ambiguous, []string{"conflict"}) {
+		t.Errorf("ambiguous = %v", migration.Ambiguous)
+	}
+}
+
+// writeIdsOutput - JSON output with the products by hash
+func writeIdsOutput(t *testing.T, filename string, products map[string]outputProduct) {
+	t.Helper()
+	output := outputDocument{Version: JSON_OUTPUT_VERSION, Created: filepath.Base(filename), IdHashmap: make(map[int]string)}
+	id := 1
+	for hash, product := range products {
+		product.Id = id
+		output.IdHashmap[id] = hash
+		output.Goods = append(output.Goods, outputItem{outputProduct: product})
+		id++
+	}
+	content, err := json.Marshal(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRunIdsCheck(t *testing.T) {
+	dir := t.TempDir()
+	oldFile, newFile := filepath.Join(dir, "old.json"), filepath.Join(dir, "new.json")
+	migrationFile := filepath.Join(dir, ID_MIGRATION_FILE)
+	check := func() error {
+		return runIds([]string{"check", "--old", oldFile, "--new", newFile, "--migration", migrationFile})
+	}
+	pivo := outputProduct{Name: "Pivo", Volume: "0,5 l", Cat: "NÁPOJE"}
+	writeIdsOutput(t, oldFile, map[string]outputProduct{"aaa": pivo})
+
+	// unchanged IDs
+	writeIdsOutput(t, newFile, map[string]outputProduct{"aaa": pivo})
+	if err := check(); err != nil {
+		t.Errorf("stable IDs: %v", err)
+	}
+
+	// changed ID without a migration fails, the published migration makes it pass
+	writeIdsOutput(t, newFile, map[string]outputProduct{"bbb": pivo})
+	if err := check(); err == nil || !strings.Contains(err.Error(), "1 IDs changed without a migration") {
+		t.Errorf("changed ID without a migration: got %v", err)
+	}
+	if err := runIds([]string{"migrate", "--old", oldFile, "--new", newFile, "--migration", migrationFile}); err != nil {
+		t.Fatal(err)
+	}
+	if err := check(); err != nil {
+		t.Errorf("changed ID with the migration: %v", err)
+	}
+
+	// a migration to another ID does not cover the change
+	os.WriteFile(migrationFile, []byte(`{"map": {"aaa": "ccc"}}`), 0644)
+	if err := check(); err == nil {
+		t.Error("changed ID with a wrong migration passed")
+	}
+
+	// ambiguous products need a hand-made mapping
+	writeIdsOutput(t, newFile, map[string]outputProduct{"bbb": pivo, "ccc": {Name: "PIVO", Volume: "0,5 l", Cat: "NÁPOJE"}})
+	os.Remove(migrationFile)
+	if err := check(); err == nil || !strings.Contains(err.Error(), "1 IDs changed") {
+		t.Errorf("ambiguous ID: got %v", err)
+	}
+	os.WriteFile(migrationFile, []byte(`{"map": {"aaa": "bbb"}}`), 0644)
+	if err := check(); err != nil {
+		t.Errorf("ambiguous ID mapped by hand: %v", err)
+	}
+
+	if err := runIds(nil); !errors.Is(err, errUsage) {
+		t.Errorf("no arguments: got %v, want the usage error", err)
+	}
+	if err := runIds([]string{"check", "--new", newFile}); err == nil {
+		t.Error("check without --old passed")
+	}
+}
@@ -0,0 +1,250 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	MAX_IMAGE_THREADS   = 4
+	IMAGE_QUEUE_SIZE    = 1000
+	FAILED_IMAGES_FILE  = "failed-images.json"
+	IMAGE_REPORT_LISTED = 10 // failures printed in the summary
+)
+
+// imageFailure - image that failed after all retries
+type imageFailure struct {
+	Url   string `json:"url"`
+	Query string `json:"query"`
+	Error string `json:"error"`
+	Time  string `json:"time"`
+}
+
+// imageTask - queued image download
+type imageTask struct {
+	url  string
+	qlog *queryLogger
+}
+
+// imagePool - bounded workers downloading the images of the scraped offers
+type imagePool struct {
+	ctx      context.Context
+	tasks    chan imageTask
+	wg       sync.WaitGroup
+	mutex    sync.Mutex
+	queued   map[string]bool
+	failures []imageFailure
+	done     int
+}
+
+// flightGroup - coalesces concurrent calls with the same key into one
+type flightGroup struct {
+	mutex sync.Mutex
+	calls map[string]*flightCall
+}
+
+// flightCall - call in progress, done is closed with err set
+type flightCall struct {
+	done chan struct{}
+	err  error
+}
+
+// in-flight image downloads keyed by URL
+var imageFlights flightGroup
+
+// do - run fn unless a call with the key is in flight, then wait for its result
+func (g *flightGroup) do(ctx context.Context, key string, fn func() error) error {
+	g.mutex.Lock()
+	if g.calls == nil {
+		g.calls = make(map[string]*flightCall)
+	}
+	if call, ok := g.calls[key]; ok {
+		g.mutex.Unlock()
+		select {
+		case <-call.done:
+			return call.err
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+	call := &flightCall{done: make(chan struct{})}
+	g.calls[key] = call
+	g.mutex.Unlock()
+
+	defer func() {
+		g.mutex.Lock()
+		delete(g.calls, key)
+		g.mutex.Unlock()
+		close(call.done)
+	}()
+	call.err = fn()
+	return call.err
+}
+
+// images of the current run, see startImagePool
+var images *imagePool
+
+// startImagePool - start the image workers, cancelling the context stops the downloads
+func startImagePool(ctx context.Context) *imagePool {
+	p := &imagePool{ctx: ctx, tasks: make(chan imageTask, IMAGE_QUEUE_SIZE), queued: make(map[string]bool)}
+	for range config.ImageThreads {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// work - download the queued images until the queue is closed
+func (p *imagePool) work() {
+	defer p.wg.Done()
+	for task := range p.tasks {
+		if p.ctx.Err() != nil {
+			continue // drain
+		}
+		err := saveImageToCache(p.ctx, task.url, task.qlog)
+		p.mutex.Lock()
+		p.done++
+		if err != nil && p.ctx.Err() == nil {
+			task.qlog.Printf("[%s] 💥 error downloading image: %v", task.url, err)
+			query := ""
+			if task.qlog != nil {
+				query = task.qlog.query
+			}
+			p.failures = append(p.failures, imageFailure{task.url, query, err.Error(), time.Now().Format(time.RFC3339)})
+		}
+		p.mutex.Unlock()
+	}
+}
+
+// queue - schedule the image download, each URL once per run
+func (p *imagePool) queue(imageUrl string, qlog *queryLogger) {
+	if p == nil || imageUrl == "" || offlineMode || *noImagesFlag {
+		return
+	}
+	p.mutex.Lock()
+	if p.queued[imageUrl] {
+		p.mutex.Unlock()
+		return
+	}
+	p.queued[imageUrl] = true
+	p.mutex.Unlock()
+	select {
+	case p.tasks <- imageTask{imageUrl, qlog}:
+	case <-p.ctx.Done():
+	}
+}
+
+// wait - finish the queued downloads and report the failures
+func (p *imagePool) wait() {
+	if p == nil {
+		return
+	}
+	close(p.tasks)
+	p.wg.Wait()
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if len(p.queued) == 0 {
+		return
+	}
+	log.Printf("🖼️ %d images processed, %d failed", p.done, len(p.failures))
+	for i, f := range p.failures {
+		if i == IMAGE_REPORT_LISTED {
+			log.Printf("   ... and %d more in %s", len(p.failures)-i, statePath(config.FailedImagesFile))
+			break
+		}
+		log.Printf("   %s: %s", f.Url, f.Error)
+	}
+	if err := saveImageFailures(statePath(config.FailedImagesFile), p.failures); err != nil {
+		log.Printf("[%s] 💥 error writing: %v", config.FailedImagesFile, err)
+	}
+}
+
+// saveImageFailures - write the failed images, remove the file when nothing failed
+func saveImageFailures(filename string, failures []imageFailure) error {
+	if len(failures) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	content, err := json.MarshalIndent(failures, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding: %w", err)
+	}
+	return os.WriteFile(filename, content, 0644)
+}
+
+// runImagesSync - download the missing images of the latest output without scraping
+func runImagesSync(args []string) error {
+	flags := flag.NewFlagSet("images sync", flag.ExitOnError)
+	from := flags.String("from", config.OutputCsv, "CSV output listing the image URLs")
+	dryRun := flags.Bool("dry-run", false, "only print the missing image URLs")
+	parseInterspersed(flags, args)
+
+	goods, err := loadGoodsFromCsv(*from)
+	if err != nil {
+		return err
+	}
+	seen := make(map[string]bool)
+	var missing []string
+	for _, item := range goods {
+		if item.ImageUrl == "" || item.ImageUrl == IMAGE_NO_IMAGE_URL || strings.Contains(item.ImageUrl, "no_discounts") || seen[item.ImageUrl] {
+			continue
+		}
+		seen[item.ImageUrl] = true
+		if cachedImageFile(item.ImageUrl) == "" {
+			missing = append(missing, item.ImageUrl)
+		}
+	}
+	log.Printf("🖼️ %d images in %s, %d missing", len(seen), *from, len(missing))
+	if len(missing) == 0 {
+		return nil
+	}
+	if *dryRun {
+		for _, imageUrl := range missing {
+			fmt.Println(imageUrl)
+		}
+		return nil
+	}
+	if *noImagesFlag {
+		return errors.New("--no-images is set")
+	}
+
+	if !checkLock() {
+		return errors.New("locked")
+	}
+	defer unlockLock()
+	if _, err := setupRun(); err != nil {
+		return err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	images = startImagePool(ctx)
+	defer func() { images = nil }()
+	for _, imageUrl := range missing {
+		images.queue(imageUrl, nil)
+	}
+	images.wait()
+	return ctx.Err()
+}
+
+// runImages - manage the image cache
+func runImages(args []string) error {
+	if len(args) > 0 && args[0] == "sync" {
+		return runImagesSync(args[1:])
+	}
+	return fmt.Errorf("%w: koopi images sync [--from koopi.csv] [--dry-run]", errUsage)
+}
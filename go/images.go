@@ -0,0 +1,230 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// errCorruptImage - the image does not decode, it is deleted and downloaded again
+var errCorruptImage = errors.New("corrupt image")
+
+// URL -> file index of the image cache, appended as images are stored
+const IMAGE_INDEX_FILE = "urls.jsonl"
+
+// imageIndexRecord - one line of IMAGE_INDEX_FILE
+type imageIndexRecord struct {
+	Url  string `json:"url"`
+	File string `json:"file"`
+	Size int64  `json:"size,omitempty"` // bytes of the file fully validated when stored, 0 = older index
+}
+
+// images are stored by content hash, the index maps their URLs to the files
+var imageIndex struct {
+	mutex sync.Mutex
+	dir   string // image cache the index was loaded from
+	urls  map[string]string
+	sizes map[string]int64 // validated file sizes by the file name
+}
+
+// loadImageIndex - load the index of the configured image cache, must hold the mutex
+func loadImageIndex() {
+	if imageIndex.urls != nil && imageIndex.dir == config.ImageCache {
+		return
+	}
+	imageIndex.dir = config.ImageCache
+	imageIndex.urls = make(map[string]string)
+	imageIndex.sizes = make(map[string]int64)
+	file, err := os.Open(filepath.Join(config.ImageCache, IMAGE_INDEX_FILE))
+	if err != nil {
+		return
+	}
+	defer file.Close()
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec imageIndexRecord
+		if json.Unmarshal(scanner.Bytes(), &rec) == nil && rec.Url != "" {
+			imageIndex.urls[rec.Url] = rec.File // later lines win
+			if rec.Size > 0 {
+				imageIndex.sizes[rec.File] = rec.Size
+			}
+		}
+	}
+}
+
+// imageFileName - content-addressed file name keeping the extension of the URL
+func imageFileName(imageUrl string, content []byte) string {
+	hash := sha256.Sum256(content)
+	ext := strings.ToLower(filepath.Ext(imageUrl))
+	switch ext {
+	case ".png", ".jpg", ".jpeg", ".gif", ".webp":
+	default:
+		ext = ".img"
+	}
+	return hex.EncodeToString(hash[:16]) + ext
+}
+
+// cachedImageFile - file name of the downloaded image, empty if not cached
+func cachedImageFile(imageUrl string) string {
+	imageIndex.mutex.Lock()
+	loadImageIndex()
+	name := imageIndex.urls[imageUrl]
+	imageIndex.mutex.Unlock()
+	if name == "" {
+		return ""
+	}
+	if _, err := os.Stat(filepath.Join(config.ImageCache, name)); err != nil {
+		return ""
+	}
+	return name
+}
+
+// storeImage - write the validated image under its content hash (once for identical images) and index its URL
+func storeImage(imageUrl string, content []byte) (string, error) {
+	name := imageFileName(imageUrl, content)
+	filePath := filepath.Join(config.ImageCache, name)
+	if _, err := os.Stat(filePath); os.IsNotExist(err) {
+		if err := writeFileAtomic(filePath, content); err != nil {
+			return "", err
+		}
+	}
+	return name, indexImage(imageUrl, name, int64(len(content)))
+}
+
+// indexImage - append the URL of the validated image file to the index
+func indexImage(imageUrl string, name string, size int64) error {
+	imageIndex.mutex.Lock()
+	defer imageIndex.mutex.Unlock()
+	loadImageIndex()
+	if imageIndex.urls[imageUrl] == name && imageIndex.sizes[name] == size {
+		return nil
+	}
+	line, err := json.Marshal(imageIndexRecord{imageUrl, name, size})
+	if err != nil {
+		return err
+	}
+	file, err := os.OpenFile(filepath.Join(config.ImageCache, IMAGE_INDEX_FILE), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	imageIndex.urls[imageUrl] = name
+	imageIndex.sizes[name] = size
+	return file.Close()
+}
+
+// writeFileAtomic - write through a unique temporary file, concurrent writers of the same file are safe
+func writeFileAtomic(filePath string, content []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filePath), filepath.Base(filePath)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), filePath)
+}
+
+// validateImage - decode the whole image, truncated files and error pages fail
+func validateImage(content []byte) error {
+	if _, _, err := image.Decode(bytes.NewReader(content)); err != nil {
+		return fmt.Errorf("%w: %v", errCorruptImage, err)
+	}
+	return nil
+}
+
+// checkCachedImage - check the size and the header of the image validated when stored,
+// images of an older index are fully validated once and indexed with their size
+func checkCachedImage(imageUrl string, fileName string) error {
+	filePath := filepath.Join(config.ImageCache, fileName)
+	imageIndex.mutex.Lock()
+	loadImageIndex()
+	size := imageIndex.sizes[fileName]
+	imageIndex.mutex.Unlock()
+
+	if size == 0 {
+		content, err := os.ReadFile(filePath)
+		if err != nil {
+			return err
+		}
+		if err := validateImage(content); err != nil {
+			return fmt.Errorf("%s: %w", fileName, err)
+		}
+		return indexImage(imageUrl, fileName, int64(len(content)))
+	}
+
+	file, err := os.Open(filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	info, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if info.Size() != size {
+		return fmt.Errorf("%s: %w: %d bytes, %d stored", fileName, errCorruptImage, info.Size(), size)
+	}
+	if _, _, err := image.DecodeConfig(bufio.NewReader(file)); err != nil {
+		return fmt.Errorf("%s: %w: %v", fileName, errCorruptImage, err)
+	}
+	return nil
+}
+
+// removeCachedImage - remove the image with its variants, the index entry is ignored until re-downloaded
+func removeCachedImage(fileName string) {
+	for _, name := range append(imageVariants(fileName), fileName) {
+		os.Remove(filepath.Join(config.ImageCache, name))
+	}
+}
+
+// adoptLegacyImage - move an image stored under its URL base name to the content-addressed name
+func adoptLegacyImage(imageUrl string) (string, bool) {
+	legacyPath := filepath.Join(config.ImageCache, filepath.Base(imageUrl))
+	content, err := os.ReadFile(legacyPath)
+	if err != nil {
+		return "", false
+	}
+	if validateImage(content) != nil {
+		return "", false // downloaded again
+	}
+	name, err := storeImage(imageUrl, content)
+	if err != nil {
+		return "", false
+	}
+	if name != filepath.Base(imageUrl) {
+		os.Remove(legacyPath)
+	}
+	return name, true
+}
+
+// imageOutputName - file name of the image in the outputs, legacy base name if not downloaded
+func imageOutputName(imageUrl string) string {
+	if imageUrl == "" || strings.Contains(imageUrl, "no_discounts") {
+		return ""
+	}
+	if name := cachedImageFile(imageUrl); name != "" {
+		return name
+	}
+	return trimImageUrl(imageUrl)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCheckCachedImage(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.ImageCache = t.TempDir()
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, 8, 8))); err != nil {
+		t.Fatal(err)
+	}
+	content := buf.Bytes()
+	const imageUrl = "https://img.example/pivo.png"
+	name, err := storeImage(imageUrl, content)
+	if err != nil {
+		t.Fatal(err)
+	}
+	filePath := filepath.Join(config.ImageCache, name)
+	if err := checkCachedImage(imageUrl, name); err != nil {
+		t.Errorf("stored image: %v", err)
+	}
+
+	// truncated file
+	os.WriteFile(filePath, content[:len(content)-10], 0644)
+	if err := checkCachedImage(imageUrl, name); !errors.Is(err, errCorruptImage) {
+		t.Errorf("truncated image: got %v", err)
+	}
+
+	// error page of the same size
+	os.WriteFile(filePath, bytes.Repeat([]byte("x"), len(content)), 0644)
+	if err := checkCachedImage(imageUrl, name); !errors.Is(err, errCorruptImage) {
+		t.Errorf("not an image: got %v", err)
+	}
+
+	// an older index without the sizes validates the image once and records its size
+	os.WriteFile(filePath, content, 0644)
+	os.WriteFile(filepath.Join(config.ImageCache, IMAGE_INDEX_FILE), []byte(`{"url":"`+imageUrl+`","file":"`+name+`"}`+"\n"), 0644)
+	imageIndex.urls = nil
+	if err := checkCachedImage(imageUrl, name); err != nil {
+		t.Errorf("image of an older index: %v", err)
+	}
+	imageIndex.urls = nil
+	imageIndex.mutex.Lock()
+	loadImageIndex()
+	size := imageIndex.sizes[name]
+	imageIndex.mutex.Unlock()
+	if size != int64(len(content)) {
+		t.Errorf("indexed size = %d, want %d", size, len(content))
+	}
+	imageIndex.urls = nil
+}
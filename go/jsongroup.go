@@ -0,0 +1,24 @@
+package main
+
+// JSON output layouts
+const (
+	JSON_LAYOUT_FLAT    = "flat"    // "goods", one entry per offer
+	JSON_LAYOUT_GROUPED = "grouped" // "products", each with its "offers"
+	JSON_LAYOUT_BOTH    = "both"
+)
+
+// groupProducts - the offers grouped by the product ID, ordered by the first offer
+func groupProducts(items []outputItem) []outputGroup {
+	products := []outputGroup{}
+	byId := make(map[int]int)
+	for _, item := range items {
+		i, ok := byId[item.Id]
+		if !ok {
+			i = len(products)
+			byId[item.Id] = i
+			products = append(products, outputGroup{outputProduct: item.outputProduct, Offers: []outputOffer{}})
+		}
+		products[i].Offers = append(products[i].Offers, item.outputOffer)
+	}
+	return products
+}
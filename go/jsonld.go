@@ -0,0 +1,303 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// structuredProduct - schema.org Product embedded in the page as JSON-LD or microdata
+type structuredProduct struct {
+	Name   string
+	Url    string
+	Image  string
+	Brand  string
+	Ean    string // gtin13, gtin, ...
+	Code   string // sku, productID, mpn
+	Offers []structuredOffer
+}
+
+// schema.org properties of the product identifiers in order of preference
+var (
+	structuredEanProps  = []string{"gtin13", "gtin", "gtin14", "gtin12", "gtin8"}
+	structuredCodeProps = []string{"sku", "productID", "mpn"}
+)
+
+// structuredOffer - schema.org Offer of the product
+type structuredOffer struct {
+	Price     float64
+	Currency  string
+	ValidFrom string // ISO date
+	ValidTo   string // ISO date
+	Seller    string
+}
+
+// ISO date prefix of schema.org dates and datetimes
+var reIsoDate = regexp.MustCompile(`^\d{4}-\d{2}-\d{2}`)
+
+// hasStructuredData - cheap check before parsing the structured data
+func hasStructuredData(body []byte) bool {
+	return bytes.Contains(body, []byte("application/ld+json")) || bytes.Contains(body, []byte("schema.org/Product"))
+}
+
+// extractStructuredData - products of the JSON-LD scripts and the microdata
+func extractStructuredData(doc *goquery.Document) []structuredProduct {
+	var products []structuredProduct
+	doc.Find(`script[type="application/ld+json"]`).Each(func(i int, s *goquery.Selection) {
+		var data any
+		if err := json.Unmarshal([]byte(s.Text()), &data); err == nil {
+			products = append(products, jsonLdProducts(data)...)
+		}
+	})
+	doc.Find(`[itemscope][itemtype*="schema.org/Product"]`).Each(func(i int, s *goquery.Selection) {
+		products = append(products, microdataProduct(s))
+	})
+	return products
+}
+
+// jsonLdProducts - Product nodes anywhere in the JSON-LD (@graph, ItemList, arrays)
+func jsonLdProducts(data any) []structuredProduct {
+	var products []structuredProduct
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			products = append(products, jsonLdProducts(item)...)
+		}
+	case map[string]any:
+		if jsonLdIsType(v, "Product") {
+			p := structuredProduct{Name: jsonLdString(v["name"]), Url: jsonLdString(v["url"]),
+				Image: jsonLdString(v["image"]), Brand: jsonLdString(v["brand"])}
+			p.Ean = jsonLdFirst(v, structuredEanProps)
+			p.Code = jsonLdFirst(v, structuredCodeProps)
+			p.Offers = jsonLdOffers(v["offers"])
+			return append(products, p)
+		}
+		for _, item := range v {
+			products = append(products, jsonLdProducts(item)...)
+		}
+	}
+	return products
+}
+
+// jsonLdOffers - Offer nodes, AggregateOffer lists its offers or the lowest price
+func jsonLdOffers(data any) []structuredOffer {
+	var offers []structuredOffer
+	switch v := data.(type) {
+	case []any:
+		for _, item := range v {
+			offers = append(offers, jsonLdOffers(item)...)
+		}
+	case map[string]any:
+		if nested, ok := v["offers"]; ok {
+			if nestedOffers := jsonLdOffers(nested); len(nestedOffers) > 0 {
+				return nestedOffers
+			}
+		}
+		price := jsonLdString(v["price"])
+		if price == "" {
+			price = jsonLdString(v["lowPrice"])
+		}
+		offer := structuredOffer{Currency: jsonLdString(v["priceCurrency"]), ValidFrom: isoDate(jsonLdString(v["validFrom"])),
+			ValidTo: isoDate(jsonLdString(v["priceValidUntil"])), Seller: jsonLdString(v["seller"])}
+		if offer.ValidTo == "" {
+			offer.ValidTo = isoDate(jsonLdString(v["validThrough"]))
+		}
+		offer.Price, _ = strconv.ParseFloat(strings.Replace(price, ",", ".", 1), 64)
+		if offer.Price > 0 {
+			offers = append(offers, offer)
+		}
+	}
+	return offers
+}
+
+// jsonLdIsType - node of the schema.org type, "@type" may be a list
+func jsonLdIsType(node map[string]any, typeName string) bool {
+	switch t := node["@type"].(type) {
+	case string:
+		return t == typeName || strings.HasSuffix(t, "/"+typeName)
+	case []any:
+		for _, item := range t {
+			if s, ok := item.(string); ok && s == typeName {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// jsonLdString - text of the value, the name or URL of nested nodes, the first item of lists
+func jsonLdString(data any) string {
+	switch v := data.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		if len(v) > 0 {
+			return jsonLdString(v[0])
+		}
+	case map[string]any:
+		for _, key := range []string{"name", "url", "contentUrl", "@id"} {
+			if s := jsonLdString(v[key]); s != "" {
+				return s
+			}
+		}
+	}
+	return ""
+}
+
+// jsonLdFirst - first non-empty property of the node
+func jsonLdFirst(node map[string]any, props []string) string {
+	for _, prop := range props {
+		if s := jsonLdString(node[prop]); s != "" {
+			return s
+		}
+	}
+	return ""
+}
+
+// microdataProduct - product of the itemscope, offers are nested itemscopes
+func microdataProduct(s *goquery.Selection) structuredProduct {
+	offers := s.Find(`[itemprop="offers"]`)
+	own := func(prop string) string {
+		found := s.Find(`[itemprop="` + prop + `"]`).FilterFunction(func(i int, item *goquery.Selection) bool {
+			return item.ParentsFiltered(`[itemprop="offers"]`).Length() == 0
+		})
+		return microdataValue(found.First())
+	}
+	p := structuredProduct{Name: own("name"), Url: own("url"), Image: own("image"), Brand: own("brand")}
+	for _, prop := range structuredEanProps {
+		if p.Ean == "" {
+			p.Ean = own(prop)
+		}
+	}
+	for _, prop := range structuredCodeProps {
+		if p.Code == "" {
+			p.Code = own(prop)
+		}
+	}
+	offers.Each(func(i int, o *goquery.Selection) {
+		prop := func(name string) string {
+			return microdataValue(o.Find(`[itemprop="` + name + `"]`).First())
+		}
+		offer := structuredOffer{Currency: prop("priceCurrency"), ValidFrom: isoDate(prop("validFrom")),
+			ValidTo: isoDate(prop("priceValidUntil")), Seller: prop("seller")}
+		offer.Price, _ = parsePrice(prop("price"))
+		if offer.Price > 0 {
+			p.Offers = append(p.Offers, offer)
+		}
+	})
+	return p
+}
+
+// microdataValue - content, link or text of the itemprop element
+func microdataValue(s *goquery.Selection) string {
+	for _, attr := range []string{"content", "href", "src", "datetime"} {
+		if v, ok := s.Attr(attr); ok {
+			return strings.TrimSpace(v)
+		}
+	}
+	return strings.TrimSpace(strings.Join(strings.Fields(s.Text()), " "))
+}
+
+// isoDate - date part of a schema.org date or datetime, "" otherwise
+func isoDate(s string) string {
+	return reIsoDate.FindString(s)
+}
+
+// absoluteUrl - site URL of the relative link
+func absoluteUrl(link string, base string) string {
+	if link == "" || strings.HasPrefix(link, "http") {
+		return link
+	}
+	return base + link
+}
+
+// mergeStructuredData - prefer the structured prices, dates and brands over the CSS fields,
+// build the goods from the structured data alone when the selectors found nothing
+func mergeStructuredData(goods []Goods, products []structuredProduct, category string, query string, scrapedAt string) []Goods {
+	byUrl := make(map[string]structuredProduct)
+	byName := make(map[string]structuredProduct)
+	for _, p := range products {
+		if p.Url != "" {
+			byUrl[absoluteUrl(p.Url, KOOPI_HOME_URL)] = p
+		}
+		byName[normalizeCzechString(p.Name)] = p
+	}
+
+	if len(goods) == 0 {
+		for _, p := range products {
+			group := productGroup{Name: p.Name, Url: p.Url, ImageUrl: p.Image}
+			if !prepareGroup(&group) {
+				continue
+			}
+			for _, o := range p.Offers {
+				raw := rawOffer{Price: strings.Replace(formatPrice(o.Price), ".", ",", 1) + " Kč", Market: o.Seller}
+				if o.Currency == CURRENCY_EUR {
+					raw.Price = strings.Replace(raw.Price, "Kč", "€", 1)
+				}
+				if item, ok := newGoodsFromOffer(group, raw, category, query, scrapedAt); ok {
+					applyStructuredOffer(&item, p, o)
+					goods = append(goods, item)
+				}
+			}
+		}
+		return goods
+	}
+
+	for i := range goods {
+		p, ok := byUrl[goods[i].Url]
+		if !ok {
+			if p, ok = byName[normalizeCzechString(goods[i].Name)]; !ok {
+				continue
+			}
+		}
+		for _, o := range p.Offers {
+			if len(p.Offers) == 1 || o.Seller != "" && marketChain(o.Seller) == goods[i].Chain {
+				applyStructuredOffer(&goods[i], p, o)
+				break
+			}
+		}
+	}
+	return goods
+}
+
+// applyStructuredOffer - override the parsed fields by the structured ones
+func applyStructuredOffer(item *Goods, p structuredProduct, o structuredOffer) {
+	if p.Brand != "" {
+		item.Brand = p.Brand
+	}
+	if ean := normalizeEan(p.Ean); ean != "" {
+		item.Ean = ean
+	}
+	if p.Code != "" {
+		item.ProductCode = p.Code
+	}
+	if item.ImageUrl == "" && p.Image != "" {
+		item.ImageUrl = absoluteUrl(p.Image, KOOPI_IMAGE_URL)
+	}
+	if o.ValidFrom != "" {
+		item.ValidFrom = o.ValidFrom
+	}
+	if o.ValidTo != "" {
+		item.ValidTo = o.ValidTo
+	}
+	item.PriceValue = o.Price
+	item.Currency = CURRENCY_CZK
+	if o.Currency != "" {
+		item.Currency = strings.ToUpper(o.Currency)
+	}
+	if item.PackCount > 0 {
+		item.PiecePrice = math.Round(item.PriceValue/float64(item.PackCount)*100) / 100
+	}
+	if item.PricePerUnitDerived {
+		item.PricePerUnit, item.PricePerUnitValue, item.PricePerUnitDerived = "", 0, false
+		derivePricePerUnit(item)
+	}
+	setDiscount(item)
+}
@@ -0,0 +1,102 @@
+package main
+
+// version of the JSON output layout, bump on incompatible changes of the types below
+const JSON_OUTPUT_VERSION = 2
+
+// outputProduct - product fields of an offer, shared by the offers of the product in the grouped layout
+type outputProduct struct {
+	hash string // goodsHash, replaced by the integer Id of the idhashmap
+
+	Id            int          `json:"id"`
+	Uuid          string       `json:"uuid"`
+	Name          string       `json:"name"`
+	Brand         string       `json:"brand"`
+	Volume        string       `json:"volume"`
+	Quantity      *float64     `json:"quantity"`
+	Unit          string       `json:"unit"`
+	PackCount     *int         `json:"pack_count"`
+	PieceQuantity *float64     `json:"piece_quantity"`
+	Cat           string       `json:"cat"`
+	SubCat        string       `json:"subcat"`
+	Packaging     string       `json:"packaging"`
+	DepositBottle bool         `json:"deposit_bottle"`
+	Ean           string       `json:"ean,omitempty"`
+	ProductCode   string       `json:"product_code,omitempty"`
+	Description   string       `json:"description,omitempty"`
+	AllMarkets    []string     `json:"all_markets,omitempty"`
+	PriceHistory  []pricePoint `json:"price_history,omitempty"`
+	Image         string       `json:"image"`
+	HasImage      bool         `json:"has_image"`
+	ImageAvif     string       `json:"image_avif,omitempty"`
+	Thumbs        []imageThumb `json:"thumbs,omitempty"`
+	Url           string       `json:"url"`
+	GroupId       string       `json:"group_id"`
+}
+
+// outputOffer - offer fields, null numbers are unknown
+type outputOffer struct {
+	Query            string             `json:"query"`
+	Price            *float64           `json:"price"`
+	PriceRaw         string             `json:"price_raw"`
+	PriceUnknown     bool               `json:"price_unknown"`
+	Pw               string             `json:"pw"` // whole part of the price
+	Pd               string             `json:"pd"` // decimal part of the price, 2 digits
+	PricePerUnit     *float64           `json:"ppunit"`
+	PricePerUnitRaw  string             `json:"ppunit_raw"`
+	PricePerUnitText string             `json:"ppunit_text"` // ppunit_raw, or formatted from a derived ppunit
+	PpunitDerived    bool               `json:"ppunit_derived"`
+	Currency         string             `json:"currency"`
+	Discount         string             `json:"discount"`
+	DiscountPercent  *int               `json:"discount_percent"`
+	DiscountImplied  bool               `json:"discount_implied"`
+	OriginalPrice    *float64           `json:"original_price"`
+	PiecePrice       *float64           `json:"piece_price"`
+	Note             string             `json:"note"`
+	Club             string             `json:"club"`
+	ClubRequired     bool               `json:"club_required"`
+	ClubName         string             `json:"club_name"`
+	Market           string             `json:"market"`
+	Chain            string             `json:"chain"`
+	Validity         string             `json:"validity"`
+	ValidFrom        string             `json:"valid_from"`
+	ValidTo          string             `json:"valid_to"`
+	Valcol           string             `json:"valcol"` // validity color: green | orange | red | blue
+	ScrapedAt        string             `json:"scrapedat"`
+	SourcePage       string             `json:"source_page"`
+	SourceCache      string             `json:"source_cache"`
+	SourceFetchTime  string             `json:"source_fetch_time"`
+	Computed         map[string]float64 `json:"computed,omitempty"`
+	Pinned           string             `json:"pinned,omitempty"`
+	Baseline         *float64           `json:"baseline,omitempty"`
+	SavingsAbsolute  *float64           `json:"savings_absolute,omitempty"`
+	SavingsPercent   *float64           `json:"savings_percent_vs_baseline,omitempty"`
+}
+
+// outputItem - one offer of the flat layout with its product fields
+type outputItem struct {
+	outputProduct
+	outputOffer
+	OfferCount string `json:"offer_count"` // "3x" offers of the same product, "" for one
+}
+
+// outputGroup - one product of the grouped layout
+type outputGroup struct {
+	outputProduct
+	Offers []outputOffer `json:"offers"`
+}
+
+// outputDocument - the JSON output
+type outputDocument struct {
+	Version       int              `json:"version"`
+	Created       string           `json:"created"`
+	Tag           string           `json:"tag,omitempty"`
+	Count         int              `json:"count"`
+	Goods         []outputItem     `json:"goods,omitzero"`    // flat and both layouts
+	Products      []outputGroup    `json:"products,omitzero"` // grouped and both layouts
+	ProductCount  int              `json:"product_count,omitempty"`
+	Markets       []marketEntry    `json:"markets"`
+	Keywords      string           `json:"keywords"`
+	KeywordsIndex map[string][]int `json:"keywordsindex"`
+	IdHashmap     map[int]string   `json:"idhashmap"`
+	CatCounts     map[string]int   `json:"catcounts"`
+}
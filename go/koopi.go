@@ -7,6 +7,8 @@ import (
 	"encoding/csv"
 	"encoding/hex"
 	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
 	"io"
 	"log"
@@ -22,39 +24,54 @@ import (
 	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 	"unicode"
 
 	"github.com/PuerkitoBio/goquery"
-	"golang.org/x/text/collate"
-	"golang.org/x/text/language"
 	"golang.org/x/text/runes"
 	"golang.org/x/text/transform"
 	"golang.org/x/text/unicode/norm"
+	"koopi/postprocess"
 )
 
 const (
+	// legacy cache folders relative to the working directory, used when they exist (see xdgDir)
 	HTML_CACHE  = "../cache"
 	IMAGE_CACHE = "../images"
 
-	INPUT_CSV   = "scrape.csv"
-	OUTPUT_CSV  = "koopi.csv"
-	OUTPUT_JSON = "koopi.json"
+	INPUT_CSV         = "scrape.csv" // CATEGORY,QUERY,PAGES[,SYNONYMS]
+	SYNONYM_SEPARATOR = "|"          // of the SYNONYMS column
+	OUTPUT_CSV        = "koopi.csv"
+	OUTPUT_JSON       = "koopi.json"
 
 	KOOPI_HOME_URL   = "https://www.kupi.cz"
 	KOOPI_IMAGE_URL  = "https://img.kupi.cz"
 	KOOPI_SEARCH_URL = "https://www.kupi.cz/hledej?f="
 	KOOPI_SUBPAGE    = "&page="
+	KOOPI_MOBILE_URL = "https://m.kupi.cz"
+	KOOPI_SHOP_URL   = "https://www.kupi.cz/slevy/" // + chain slug, the whole discount listing of the shop
 
+	// defaults of the config, see defaultConfig
 	LOCK_FILE          = "/tmp/koopi.lock"
-	LOCK_FILE_DURATION = time.Hour
+	LOCK_FILE_DURATION = time.Hour // older locks are stale
 
 	MAX_THREADS       = 9
-	MAX_SCRAPED_GOODS = 1000
+	MAX_SCRAPED_GOODS = 1000 // pages per run
 	SLEEP_RANDOM_MS   = 25000
 	SLEEP_STATIC_MS   = 9785
-	REQ_TIMEOUT       = 10 * time.Second
+	REQ_TIMEOUT       = 10 * time.Second // time to response headers
+	RETRY_BACKOFF     = 5 * time.Second  // multiplied by the attempt number
+
+	DIAL_TIMEOUT = 5 * time.Second
+	TLS_TIMEOUT  = 10 * time.Second
+	BODY_TIMEOUT = 2 * time.Minute // whole request including the body
+
+	KEEP_LAST_GOOD_PERCENT = 50 // minimal size of new output in % of the previous one
+
+	HEADLESS_BROWSER = "chromium"
+	HEADLESS_TIMEOUT = 60 * time.Second
 )
 
 // note fixes
@@ -130,6 +147,27 @@ const (
 // token bucket
 var rateLimiter chan struct{}
 
+// offline mode - use cached pages only, no network (demo)
+var offlineMode bool
+
+// command line flags
+var (
+	configFlag       = flag.String("config", CONFIG_FILE, "config file")
+	forceFlag        = flag.Bool("force", false, "replace outputs even if they shrank below keep_last_good_percent")
+	headlessFlag     = flag.Bool("headless", false, "render pages without goods in a headless browser (chromedp)")
+	consentFlag      = flag.String("consent", CONSENT_SKIP, "cookie consent flow: accept | skip")
+	groupLogsFlag    = flag.Bool("group-logs", false, "buffer log lines and print them per query")
+	tagFlag          = flag.String("tag", "", "tag the run, e.g. pre-christmas (see koopi runs)")
+	cacheReportFlag  = flag.Bool("cache-report", false, "print cache hits and misses per query after the run")
+	torFlag          = flag.Bool("tor", false, "fetch through the local Tor daemon (last resort when blocked)")
+	noImagesFlag     = flag.Bool("no-images", false, "do not download images, outputs still reference them")
+	hiddenOffersFlag = flag.Bool("hidden-offers", false, "also extract offer rows collapsed behind \"zobrazit další\"")
+
+	debugHttpFlag    = flag.Bool("debug-http", false, "dump HTTP request/response headers")
+	debugQueriesFlag = flag.String("debug-queries", "", "comma separated queries to debug (default all)")
+	debugBodiesFlag  = flag.Bool("debug-bodies", false, "save debugged response bodies to debug_dir")
+)
+
 // RegExps
 var (
 	// předložky a spojky
@@ -289,23 +327,21 @@ var blockedGoods = []string{
 	"šťouchadlo",
 }
 
-// Goods - struct for goods
-type Goods struct {
-	Category     string
-	Query        string
-	Name         string
-	Price        string
-	PricePerUnit string
-	Discount     string
-	Note         string
-	Club         string
-	Volume       string
-	Market       string
-	Validity     string
-	Url          string
-	ImageUrl     string
-	SubCat       string
-	ScrapedAt    string
+// Goods - struct for goods, shared with the post-processors
+type Goods = postprocess.Goods
+
+// scrapeJob - one page to scrape
+type scrapeJob struct {
+	url      string
+	cacheKey string
+	category string
+	query    string
+
+	// automatic pagination, see pagination.go
+	page      int    // page number of the listing
+	autoPages bool   // queue the following pages by the pagination of this one
+	firstUrl  string // first page of the listing
+	pageCap   int    // safety cap of the automatic pagination, 0 = auto_pages_max
 }
 
 // getBone - helper function to get string bones
@@ -317,11 +353,16 @@ func getBone(s string) string {
 	return strings.Join(words[:limit], " ")
 }
 
-// remove diacritics - helper function to remove diacritics from strings
+// letters without a decomposition, untouched by removing the combining marks
+var letterFolds = strings.NewReplacer("ł", "l", "Ł", "L", "ø", "o", "Ø", "O", "đ", "d", "Đ", "D", "ı", "i",
+	"ß", "ss", "æ", "ae", "Æ", "AE", "œ", "oe", "Œ", "OE")
+
+// remove diacritics - helper function to remove diacritics from strings, compatibility forms
+// (ligatures, superscripts, full-width letters) are decomposed too
 func removeDiacritics(s string) string {
-	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
 	result, _, _ := transform.String(t, s)
-	return result
+	return letterFolds.Replace(result)
 }
 
 // normalizeCzechString - helper function to normalize Czech strings for comparison
@@ -372,15 +413,15 @@ func checkLock() bool {
 	pid := os.Getpid()
 
 	// 1. read the lock
-	content, err := os.ReadFile(LOCK_FILE)
+	content, err := os.ReadFile(config.LockFile)
 	if err == nil {
-		fileInfo, _ := os.Stat(LOCK_FILE)
+		fileInfo, _ := os.Stat(config.LockFile)
 
 		// A. check lock age
-		if time.Since(fileInfo.ModTime()) > LOCK_FILE_DURATION {
+		if time.Since(fileInfo.ModTime()) > time.Duration(config.LockMaxAge) {
 			// Soubor je starší než LOCK_DURATION (1 hodina) -> Předpokládáme Zombie Lock. Smažeme jej a vytvoříme nový.
-			fmt.Printf("🔒 Lock file %s found but is too old (modified %s). Deleting old lock.\n", LOCK_FILE, fileInfo.ModTime().Format(time.RFC3339))
-			if err := os.Remove(LOCK_FILE); err != nil {
+			fmt.Printf("🔒 Lock file %s found but is too old (modified %s). Deleting old lock.\n", config.LockFile, fileInfo.ModTime().Format(time.RFC3339))
+			if err := os.Remove(config.LockFile); err != nil {
 				fmt.Printf("🚨 ERROR: failed to remove old lock file: %v\n", err)
 				return false
 			}
@@ -390,21 +431,21 @@ func checkLock() bool {
 			if parseErr == nil && isProcessRunning(lockedPID) {
 				if lockedPID == pid {
 					// lock is ours - theoretical situation
-					fmt.Printf("⚠️ WARNING: lock file %s exists and contains current PID. Proceeding.\n", LOCK_FILE)
+					fmt.Printf("⚠️ WARNING: lock file %s exists and contains current PID. Proceeding.\n", config.LockFile)
 					return true
 				}
 				// lock is not ours
-				fmt.Printf("❌ ABORT: lock file %s found for active PID %d. Run aborted.\n", LOCK_FILE, lockedPID)
+				fmt.Printf("❌ ABORT: lock file %s found for active PID %d. Run aborted.\n", config.LockFile, lockedPID)
 				return false
 			}
 			// C. lock exists, but is invalid
-			fmt.Printf("⚠️ WARNING: lock file %s exists but PID %d not running (or invalid). Overwriting.\n", LOCK_FILE, lockedPID)
+			fmt.Printf("⚠️ WARNING: lock file %s exists but PID %d not running (or invalid). Overwriting.\n", config.LockFile, lockedPID)
 		}
 	}
 
 	// 2. make a new lock
-	fmt.Printf("🔒️ new lock file %s with PID %d\n", LOCK_FILE, pid)
-	if err := os.WriteFile(LOCK_FILE, []byte(strconv.Itoa(pid)), 0644); err != nil {
+	fmt.Printf("🔒️ new lock file %s with PID %d\n", config.LockFile, pid)
+	if err := os.WriteFile(config.LockFile, []byte(strconv.Itoa(pid)), 0644); err != nil {
 		fmt.Printf("🚨 ERROR: failed to create lock file: %v\n", err)
 		return false
 	}
@@ -414,17 +455,17 @@ func checkLock() bool {
 // unlock the app lock
 func unlockLock() {
 	pid := os.Getpid()
-	content, err := os.ReadFile(LOCK_FILE)
+	content, err := os.ReadFile(config.LockFile)
 	if err == nil && strconv.Itoa(pid) == string(content) {
-		if err := os.Remove(LOCK_FILE); err != nil {
-			fmt.Printf("🚨 ERROR: failed to remove lock file %s: %v\n", LOCK_FILE, err)
+		if err := os.Remove(config.LockFile); err != nil {
+			fmt.Printf("🚨 ERROR: failed to remove lock file %s: %v\n", config.LockFile, err)
 		} else {
-			fmt.Printf("🔓️ lock file %s removed\n\n", LOCK_FILE)
+			fmt.Printf("🔓️ lock file %s removed\n\n", config.LockFile)
 		}
 	} else if err != nil && !os.IsNotExist(err) {
 		fmt.Printf("🚨 ERROR: failed to read lock file for verification: %v\n", err)
 	} else {
-		fmt.Printf("⚠️ WARNING: could not verify/remove lock file %s (file not found or content mismatch).\n", LOCK_FILE)
+		fmt.Printf("⚠️ WARNING: could not verify/remove lock file %s (file not found or content mismatch).\n", config.LockFile)
 	}
 }
 
@@ -450,10 +491,53 @@ func sanitizeString(s string) string {
 	return strings.Join(fields, " ")
 }
 
+// productGroup - product info shared by all offers of the group
+type productGroup struct {
+	Name        string
+	Url         string
+	ImageUrl    string
+	Ean         string // data attributes of the group, see productcode.go
+	ProductCode string
+}
+
+// rawOffer - texts of one offer row as found in the HTML
+type rawOffer struct {
+	Price        string
+	PricePerUnit string
+	Discount     string
+	Volume       string
+	Note         string
+	Club         string
+	Validity     string
+	Market       string
+
+	OriginalPrice string
+}
+
+// extractGoods - extract data from HTML of the layout using the configured parser
+func extractGoods(body []byte, layout string, category string, query string, scrapedAt string) ([]Goods, error) {
+	defer stats.workerTime("extract", time.Now())
+	structured := config.StructuredData && hasStructuredData(body)
+	if config.Parser == PARSER_STREAM && layout == LAYOUT_DESKTOP && !customSelectors(layout) && !structured {
+		return extractGoodsFromHtmlStream(body, category, query, scrapedAt)
+	}
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	goods := extractGoodsFromHtml(doc, selectorSets[layout], category, query, scrapedAt)
+	if structured {
+		goods = mergeStructuredData(goods, extractStructuredData(doc), category, query, scrapedAt)
+	}
+	return goods, nil
+}
+
 // extractGoodsFromHtml - extract data from HTML
-func extractGoodsFromHtml(doc *goquery.Document, category string, query string, scrapedAt string) []Goods {
+func extractGoodsFromHtml(doc *goquery.Document, sel selectorSet, category string, query string, scrapedAt string) []Goods {
 	var goods []Goods
-	doc.Find("div.group_discounts").Each(func(i int, s *goquery.Selection) {
+	health := make(selectorHealth)
+	defer stats.addSelectorHealth(health)
+	doc.Find(sel.Group).Each(func(i int, s *goquery.Selection) {
 
 		// ignore .notactive
 		if s.HasClass("notactive") {
@@ -461,116 +545,32 @@ func extractGoodsFromHtml(doc *goquery.Document, category string, query string,
 		}
 
 		// extract general product info once per group
-		nameSelection := s.Find("div.product_name h2 a")
-		productName := strings.TrimSpace(nameSelection.Text())
-		productName = sanitizeString(productName)
-
-		// skip forbidden goods
-		if isForbidden(productName, blockedGoods) {
+		var group productGroup
+		nameSelection := health.find(sel.layout, "name", sel.Name, s).First()
+		group.Name = nameSelection.Text()
+		group.Url, _ = nameSelection.Attr("href")
+		group.ImageUrl, _ = health.find(sel.layout, "image", sel.Image, s).Attr(sel.ImageAttr)
+		group.Ean = attrCode(s, eanAttrs)
+		group.ProductCode = attrCode(s, productCodeAttrs)
+		if !prepareGroup(&group) {
 			return
 		}
 
-		productUrl, _ := nameSelection.Attr("href")
-		if !strings.HasPrefix(productUrl, "http") {
-			productUrl = KOOPI_HOME_URL + productUrl
-		}
-
-		imgSelection := s.Find("div.product_image a img")
-		productImageUrl, _ := imgSelection.Attr("data-src")
-		if !strings.HasPrefix(productImageUrl, "http") {
-			productImageUrl = KOOPI_IMAGE_URL + productImageUrl
-		}
-
 		// iterate through each specific offer within the product group
-		s.Find(".discount_row").Each(func(j int, offer *goquery.Selection) {
-			var newGoods Goods
-			newGoods.Category = category
-			newGoods.Query = query
-			newGoods.ScrapedAt = scrapedAt
-			newGoods.Name = productName
-			newGoods.Url = productUrl
-			newGoods.ImageUrl = productImageUrl
-
-			// name
-			newGoods.Name = strings.ReplaceAll(newGoods.Name, "-", "\u2011")
-
-			// price
-			newGoods.Price = strings.TrimSpace(offer.Find(".discount_price_value").Text())
-
-			// price per unit
-			newGoods.PricePerUnit = strings.TrimSpace(offer.Find(".price_per_unit").Text())
-
-			// discount
-			newGoods.Discount = strings.TrimSpace(offer.Find(".discount_percentage").Text())
-			newGoods.Discount = strings.ReplaceAll(newGoods.Discount, "–", "-")
-			newGoods.Discount = strings.ReplaceAll(newGoods.Discount, "\u00A0", "\u202F")
-			newGoods.Discount = strings.TrimSpace(newGoods.Discount)
-
-			// volume
-			newGoods.Volume = strings.TrimSpace(offer.Find(".discount_amount").Text())
-			newGoods.Volume = strings.TrimPrefix(newGoods.Volume, "/")
-			newGoods.Volume = strings.TrimSpace(newGoods.Volume)
-			newGoods.Volume = strings.ReplaceAll(newGoods.Volume, ".", ",")
-			if newGoods.Volume == "" {
-				newGoods.Volume = "?" // no volume specified
-			}
-
-			// note
-			newGoods.Note = strings.TrimSpace(offer.Find(".discount_note").Text())
-			for _, fix := range noteFixes {
-				newGoods.Note = strings.ReplaceAll(newGoods.Note, fix.old, fix.new)
-			}
-			newGoods.Note = sanitizeString(newGoods.Note)
-			newGoods.Note = typoFix(newGoods.Note)
-
-			// club
-			newGoods.Club = strings.TrimSpace(offer.Find(".discounts_club").Text())
-			newGoods.Club = strings.ToLower(newGoods.Club)
-			newGoods.Club = strings.ReplaceAll(newGoods.Club, "platí pro členy klubu", "pro členy klubu")
-			newGoods.Club = strings.ReplaceAll(newGoods.Club, "cena s aplikací lidl plus", "aplikace Lidl Plus 📱")
-			newGoods.Club = strings.ReplaceAll(newGoods.Club, "cena s kaufland card", "Kaufland Card 💳️")
-			newGoods.Club = sanitizeString(newGoods.Club)
-
-			// validity
-			newGoods.Validity = strings.TrimSpace(offer.Find(".discounts_validity").Text())
-			newGoods.Validity = strings.TrimPrefix(newGoods.Validity, "v ")
-			newGoods.Validity = sanitizeString(newGoods.Validity)
-
-			// market
-			newGoods.Market = strings.TrimSpace(offer.Find(".discounts_shop_name a span").Text())
-			newGoods.Market = strings.ReplaceAll(newGoods.Market, "&", "and")
-			newGoods.Market = sanitizeString(newGoods.Market)
-			newGoods.Market = strings.ReplaceAll(newGoods.Market, "Albert supermarket", "Albert")
-
-			// skip forbidden markets
-			if isForbidden(newGoods.Market, blockedMarkets) {
-				return
-			}
-
-			// add SubCat based on Note
-			if strings.Contains(newGoods.Note, "zálohovaná lahev") {
-				newGoods.SubCat = "lahev"
-			}
-			if strings.Contains(newGoods.Note, "plech") {
-				newGoods.SubCat = "plech"
-			}
-
-			// function helper to compare prices
-			cleanForCompare := func(s string) string {
-				s = strings.ReplaceAll(s, "\u00A0", "") // remove No-Break Space
-				s = strings.ReplaceAll(s, "\u202F", "") // remove Narrow No-Break Space
-				s = strings.ReplaceAll(s, " ", "")      // remove spaces
-				s = strings.ToLower(s)
-				return s
+		s.Find(sel.offerSelector()).Each(func(j int, offer *goquery.Selection) {
+			raw := rawOffer{
+				Price:        health.find(sel.layout, "price", sel.Price, offer).Text(),
+				PricePerUnit: health.find(sel.layout, "price_per_unit", sel.PricePerUnit, offer).Text(),
+				Discount:     health.find(sel.layout, "discount", sel.Discount, offer).Text(),
+				Volume:       health.find(sel.layout, "volume", sel.Volume, offer).Text(),
+				Note:         health.find(sel.layout, "note", sel.Note, offer).Text(),
+				Club:         health.find(sel.layout, "club", sel.Club, offer).Text(),
+				Validity:     health.find(sel.layout, "validity", sel.Validity, offer).Text(),
+				Market:       health.find(sel.layout, "market", sel.Market, offer).Text(),
+
+				OriginalPrice: health.find(sel.layout, "original_price", sel.OriginalPrice, offer).Text(),
 			}
-
-			fullPrice := fmt.Sprintf("%s/%s", newGoods.Price, newGoods.Volume)
-			if cleanForCompare(fullPrice) == cleanForCompare(newGoods.PricePerUnit) {
-				newGoods.PricePerUnit = "\u00A0"
-			}
-
-			// append the struct to the global list
-			if newGoods.Name != "" {
+			if newGoods, ok := newGoodsFromOffer(group, raw, category, query, scrapedAt); ok {
 				goods = append(goods, newGoods)
 			}
 		})
@@ -579,114 +579,416 @@ func extractGoodsFromHtml(doc *goquery.Document, category string, query string,
 	return goods
 }
 
-// saveHtmlToCache - save HTML to the cache
-func saveHtmlToCache(cacheName string, content []byte) {
-	if _, err := os.Stat(HTML_CACHE); os.IsNotExist(err) {
-		err = os.MkdirAll(HTML_CACHE, 0755)
-		if err != nil {
-			log.Printf("[%s] 💥 error creating cache folder [%s]: %v", cacheName, HTML_CACHE, err)
-			return
+// prepareGroup - clean up the product group, returns false for forbidden goods
+func prepareGroup(group *productGroup) bool {
+	group.Name = strings.TrimSpace(group.Name)
+	group.Name = sanitizeString(group.Name)
+
+	// skip forbidden goods
+	if isForbidden(group.Name, blockedGoods) {
+		stats.filtered.Add(1)
+		return false
+	}
+
+	if !strings.HasPrefix(group.Url, "http") {
+		group.Url = KOOPI_HOME_URL + group.Url
+	}
+	if !strings.HasPrefix(group.ImageUrl, "http") {
+		group.ImageUrl = KOOPI_IMAGE_URL + group.ImageUrl
+	}
+	return true
+}
+
+// groupId - product group identity, the product page slug of the site (name hash without a link)
+func groupId(group productGroup) string {
+	path := strings.Trim(strings.TrimPrefix(group.Url, KOOPI_HOME_URL), "/")
+	if i := strings.LastIndex(path, "/"); i >= 0 {
+		path = path[i+1:]
+	}
+	if path != "" {
+		return path
+	}
+	hash := md5.Sum([]byte(normalizeCzechString(group.Name)))
+	return hex.EncodeToString(hash[:4])
+}
+
+// newGoodsFromOffer - create goods from the offer row, returns false for skipped offers
+func newGoodsFromOffer(group productGroup, offer rawOffer, category string, query string, scrapedAt string) (Goods, bool) {
+	var newGoods Goods
+	newGoods.Category = category
+	newGoods.Query = query
+	newGoods.ScrapedAt = scrapedAt
+	newGoods.Name = group.Name
+	newGoods.Url = group.Url
+	newGoods.ImageUrl = group.ImageUrl
+	newGoods.GroupId = groupId(group)
+
+	// name
+	newGoods.Name = strings.ReplaceAll(newGoods.Name, "-", "\u2011")
+	newGoods.Name = replaceText("name", newGoods.Name)
+	newGoods.Brand = detectBrand(newGoods.Name)
+	setProductCodes(&newGoods, group.Ean, group.ProductCode)
+	urlEan, urlCode := urlProductCode(group.Url)
+	setProductCodes(&newGoods, urlEan, urlCode)
+
+	// price
+	newGoods.Price = strings.TrimSpace(offer.Price)
+
+	// price per unit
+	newGoods.PricePerUnit = strings.TrimSpace(offer.PricePerUnit)
+
+	// discount
+	newGoods.Discount = strings.TrimSpace(offer.Discount)
+	newGoods.Discount = strings.ReplaceAll(newGoods.Discount, "–", "-")
+	newGoods.Discount = strings.ReplaceAll(newGoods.Discount, "\u00A0", "\u202F")
+	newGoods.Discount = strings.TrimSpace(newGoods.Discount)
+
+	// volume
+	newGoods.Volume = strings.TrimSpace(offer.Volume)
+	newGoods.Volume = strings.TrimPrefix(newGoods.Volume, "/")
+	newGoods.Volume = strings.TrimSpace(newGoods.Volume)
+	newGoods.Volume = strings.ReplaceAll(newGoods.Volume, ".", ",")
+	newGoods.Volume = replaceText("volume", newGoods.Volume)
+	if newGoods.Volume == "" {
+		newGoods.Volume = "?" // no volume specified
+	}
+	setVolumeValues(&newGoods)
+
+	// note
+	newGoods.Note = strings.TrimSpace(offer.Note)
+	for _, fix := range noteFixes {
+		newGoods.Note = strings.ReplaceAll(newGoods.Note, fix.old, fix.new)
+	}
+	newGoods.Note = replaceText("note", newGoods.Note)
+	newGoods.Note = sanitizeString(newGoods.Note)
+	newGoods.Note = typoFix(newGoods.Note)
+
+	// club
+	newGoods.Club = strings.TrimSpace(offer.Club)
+	newGoods.Club = strings.ToLower(newGoods.Club)
+	newGoods.Club = strings.ReplaceAll(newGoods.Club, "platí pro členy klubu", "pro členy klubu")
+	newGoods.Club = strings.ReplaceAll(newGoods.Club, "cena s aplikací lidl plus", "aplikace Lidl Plus 📱")
+	newGoods.Club = strings.ReplaceAll(newGoods.Club, "cena s kaufland card", "Kaufland Card 💳️")
+	newGoods.Club = replaceText("club", newGoods.Club)
+	newGoods.Club = sanitizeString(newGoods.Club)
+
+	// validity
+	newGoods.Validity = strings.TrimSpace(offer.Validity)
+	newGoods.Validity = strings.TrimPrefix(newGoods.Validity, "v ")
+	newGoods.Validity = replaceText("validity", newGoods.Validity)
+	newGoods.Validity = sanitizeString(newGoods.Validity)
+	newGoods.ValidFrom, newGoods.ValidTo = parseValidity(newGoods.Validity, scrapedAt)
+
+	// market
+	newGoods.Market = strings.TrimSpace(offer.Market)
+	newGoods.Market = strings.ReplaceAll(newGoods.Market, "&", "and")
+	newGoods.Market = sanitizeString(newGoods.Market)
+	newGoods.Market = strings.ReplaceAll(newGoods.Market, "Albert supermarket", "Albert")
+	newGoods.Market = replaceText("market", newGoods.Market)
+	newGoods.Chain = marketChain(newGoods.Market)
+
+	// skip forbidden markets
+	if isForbidden(newGoods.Market, blockedMarkets) {
+		stats.filtered.Add(1)
+		return newGoods, false
+	}
+
+	// club of the market
+	setClub(&newGoods)
+
+	// packaging, SubCat by the rules
+	setPackaging(&newGoods)
+	setSubCat(&newGoods)
+
+	setPriceValues(&newGoods)
+	derivePricePerUnit(&newGoods)
+	newGoods.OriginalPrice = originalPrice(offer.OriginalPrice, newGoods.Note)
+	setDiscount(&newGoods)
+
+	return newGoods, newGoods.Name != ""
+}
+
+// saveImageToCache - save the original image to the cache for processing, concurrent calls for one URL share the download
+func saveImageToCache(ctx context.Context, imageUrl string, qlog *queryLogger) error {
+	if offlineMode || *noImagesFlag {
+		return nil
+	}
+	return imageFlights.do(ctx, imageUrl, func() error {
+		return cacheImage(ctx, imageUrl, qlog)
+	})
+}
+
+// cacheImage - download and convert the image unless cached, retryable errors are retried
+func cacheImage(ctx context.Context, imageUrl string, qlog *queryLogger) error {
+	defer stats.workerTime("images", time.Now())
+	if err := os.MkdirAll(config.ImageCache, 0755); err != nil {
+		return fmt.Errorf("creating image cache folder: %w", err)
+	}
+
+	fileName := cachedImageFile(imageUrl)
+	if fileName == "" {
+		fileName, _ = adoptLegacyImage(imageUrl)
+	}
+	if fileName != "" {
+		if err := checkCachedImage(imageUrl, fileName); err != nil {
+			qlog.Printf("🧟 %v, re-downloading %s", err, imageUrl)
+			removeCachedImage(fileName)
+			fileName = ""
+		}
+	}
+	if fileName != "" {
+		now := time.Now()
+		for _, name := range append(imageVariants(fileName), fileName) {
+			os.Chtimes(filepath.Join(config.ImageCache, name), now, now) // last use for the LRU eviction
+		}
+		return convertImage(fileName)
+	}
+
+	qlog.Printf("📥 downloading %s%s%s", ColorCyan, imageUrl, ColorReset)
+	var imageBytes []byte
+	var err error
+	for attempt := 1; ; attempt++ {
+		imageBytes, err = downloadImage(ctx, imageUrl)
+		if err == nil || !isRetryable(ctx, err) || attempt > config.Retries {
+			break
+		}
+		if !sleepContext(ctx, time.Duration(config.RetryBackoff)*time.Duration(attempt)) {
+			break
 		}
 	}
-	filePath := filepath.Join(HTML_CACHE, cacheName)
-	err := os.WriteFile(filePath, content, 0644)
 	if err != nil {
-		log.Printf("[%s] 💥 error saving to cache: %v", cacheName, err)
+		return err
 	}
+	fileName, err = storeImage(imageUrl, imageBytes)
+	if err != nil {
+		return fmt.Errorf("saving image: %w", err)
+	}
+	return convertImage(fileName)
 }
 
-// loadHtmlFromCache - load HTML from the cache
-func loadHtmlFromCache(cacheName string) (*goquery.Document, error) {
-	filePath := filepath.Join(HTML_CACHE, cacheName)
-	localFileContent, err := os.ReadFile(filePath)
+// convertImage - encode the configured variants of the cached image
+func convertImage(fileName string) error {
+	if config.ImageWebp {
+		if err := ensureWebp(fileName); err != nil {
+			return err
+		}
+	}
+	if config.ImageAvif {
+		if err := ensureAvif(fileName); err != nil {
+			return err
+		}
+	}
+	return ensureThumbnails(fileName)
+}
+
+// downloadImage - download the image body
+func downloadImage(ctx context.Context, imageUrl string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+	if !waitFetchPause(ctx) {
+		return nil, ctx.Err()
+	}
+	resp, err := httpClient.Do(req)
 	if err != nil {
 		return nil, err
 	}
-	doc, err := goquery.NewDocumentFromReader(strings.NewReader(string(localFileContent)))
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusTooManyRequests {
+		rateLimited(resp.Header, imageUrl, nil)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, &httpStatusError{resp.StatusCode, resp.Status}
+	}
+	imageBytes, err := readCheckedBody(resp, "image/")
 	if err != nil {
-		log.Printf("[%s] 😵‍💫 error creating document from cache: %v", cacheName, err)
 		return nil, err
 	}
-	return doc, nil
+	if err := validateImage(imageBytes); err != nil {
+		return nil, err // truncated downloads are retried
+	}
+	return imageBytes, nil
 }
 
-// saveImageToCache - save the original image to the cache for processing
-func saveImageToCache(imageUrl string) {
-	if _, err := os.Stat(IMAGE_CACHE); os.IsNotExist(err) {
-		err = os.MkdirAll(IMAGE_CACHE, 0755)
-		if err != nil {
-			log.Printf("[%s] 💥 error creating image cache folder: %v", IMAGE_CACHE, err)
-			return
-		}
+// setSource - helper function to record the source page of the goods
+func setSource(goods []Goods, urlToScrape string, cacheName string, fetchTime time.Time) {
+	for i := range goods {
+		goods[i].SourcePage = urlToScrape
+		goods[i].SourceCache = cacheName
+		goods[i].SourceFetchTime = fetchTime.Format(time.RFC3339)
 	}
+}
 
-	fileName := filepath.Base(imageUrl)
-	filePath := filepath.Join(IMAGE_CACHE, fileName)
-	if _, err := os.Stat(filePath); err == nil {
-		return
+// httpStatusError - non-200 response
+type httpStatusError struct {
+	code   int
+	status string
+}
+
+// Error - error message
+func (e *httpStatusError) Error() string {
+	return fmt.Sprintf("request code [%d]: '%s'", e.code, e.status)
+}
+
+// isRetryable - network errors, 429 and 5xx responses are worth retrying
+func isRetryable(ctx context.Context, err error) bool {
+	if ctx.Err() != nil {
+		return false
+	}
+	if errors.Is(err, errBodyTooLarge) || errors.Is(err, errContentType) {
+		return false
+	}
+	var statusErr *httpStatusError
+	if errors.As(err, &statusErr) {
+		return statusErr.code == http.StatusTooManyRequests || statusErr.code >= 500
+	}
+	return true
+}
+
+// sleepContext - interruptible sleep, returns false when the context is done
+func sleepContext(ctx context.Context, d time.Duration) bool {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
 	}
+}
 
-	log.Printf("📥 downloading %s%s%s", ColorCyan, imageUrl, ColorReset)
+// fetchPage - download the page
+func fetchPage(ctx context.Context, UA string, urlToScrape string, cacheName string, query string, qlog *queryLogger) ([]byte, http.Header, error) {
+	qlog.Printf("🔎 %s%s%s", ColorCyan, urlToScrape, ColorReset)
 
-	resp, err := http.Get(imageUrl)
+	req, err := http.NewRequestWithContext(ctx, "GET", urlToScrape, nil)
 	if err != nil {
-		log.Printf("[%s] 💥 error downloading image: %v", imageUrl, err)
-		return
+		return nil, nil, fmt.Errorf("error in request: %w", err)
 	}
-	defer resp.Body.Close()
-	if resp.StatusCode != 200 {
-		log.Printf("[%s] 💥 failed to download image, code: %d", imageUrl, resp.StatusCode)
-		return
+	req.Header.Set("User-Agent", UA)
+	if !waitFetchPause(ctx) {
+		return nil, nil, ctx.Err()
 	}
-	file, err := os.Create(filePath)
+	debugHttp := isHttpDebugged(query)
+	if debugHttp {
+		dumpHttpRequest(req, qlog)
+	}
+	res, err := httpClient.Do(req)
 	if err != nil {
-		log.Printf("[%s] 💥 error creating file for image: %v", fileName, err)
-		return
+		return nil, nil, fmt.Errorf("error during request: %w", err)
 	}
-	defer file.Close()
-	_, err = io.Copy(file, resp.Body)
+	defer res.Body.Close()
+	if res.StatusCode == http.StatusTooManyRequests {
+		rateLimited(res.Header, urlToScrape, qlog)
+	}
+	if res.StatusCode != 200 {
+		if debugHttp {
+			body, _ := io.ReadAll(res.Body)
+			dumpHttpResponse(res, body, cacheName, qlog)
+		}
+		return nil, nil, &httpStatusError{res.StatusCode, res.Status}
+	}
+
+	bodyBytes, err := readCheckedBody(res, htmlContentTypes...)
 	if err != nil {
-		log.Printf("[%s] 💥 error saving image to file: %v", fileName, err)
+		return nil, nil, fmt.Errorf("error reading response body: %w", err)
+	}
+	if debugHttp {
+		dumpHttpResponse(res, bodyBytes, cacheName, qlog)
+	}
+	return bodyBytes, res.Header, nil
+}
+
+// fetchPageWithRetries - download the page, retryable errors are retried with a backoff
+func fetchPageWithRetries(ctx context.Context, UA string, urlToScrape string, cacheName string, query string, qlog *queryLogger) ([]byte, http.Header, int, error) {
+	defer stats.workerTime("fetch", time.Now())
+	attempt := 1
+	for ; ; attempt++ {
+		bodyBytes, header, err := fetchPage(ctx, UA, urlToScrape, cacheName, query, qlog)
+		if err == nil || !isRetryable(ctx, err) || attempt > config.Retries {
+			return bodyBytes, header, attempt, err
+		}
+		backoff := time.Duration(config.RetryBackoff) * time.Duration(attempt)
+		var statusErr *httpStatusError
+		if errors.As(err, &statusErr) && statusErr.code == http.StatusTooManyRequests {
+			backoff = 0 // fetchPage waits for the Retry-After pause
+		}
+		qlog.Printf("🔁 retry %d/%d in %s: %v", attempt, config.Retries, backoff, err)
+		if !sleepContext(ctx, backoff) {
+			return nil, nil, attempt, err
+		}
 	}
 }
 
 // scrapePage - scrape pages (cache/online)
-func scrapePage(UA string, ctx context.Context, urlToScrape string, cacheName string, category string, query string, allGoods *[]Goods, mutex *sync.Mutex, wg *sync.WaitGroup) {
+func scrapePage(UA string, ctx context.Context, urlToScrape string, cacheName string, category string, query string, allGoods *[]Goods, mutex *sync.Mutex, wg *sync.WaitGroup, qlog *queryLogger) pageResult {
 	defer wg.Done()
-
-	// 1. try cache first
-	doc, err := loadHtmlFromCache(cacheName)
+	defer qlog.Done()
+	qlog = qlog.withTrace(newTraceId())
+	stats.pages.Add(1)
+
+	// 1. try cache first (desktop, then mobile site)
+	cacheStart := time.Now()
+	layout, pageUrl, pageCacheName := LAYOUT_DESKTOP, urlToScrape, cacheName
+	cachedBytes, meta, err := loadHtmlFromCache(cacheName)
+	if err != nil {
+		if mobileBytes, mobileMeta, mobileErr := loadHtmlFromCache(mobileCacheName(cacheName)); mobileErr == nil {
+			cachedBytes, meta, err = mobileBytes, mobileMeta, nil
+			layout, pageUrl, pageCacheName = LAYOUT_MOBILE, mobileSiteUrl(urlToScrape), mobileCacheName(cacheName)
+		}
+	}
+	stats.workerTime("cache", cacheStart)
+	if err == errCacheExpired {
+		qlog.Printf("⌛ cache expired %s", cacheName)
+	}
+	if err != nil {
+		stats.cacheMiss(query, err == errCacheExpired)
+	}
+	fetchTime := time.Now()
+	var goodsList []Goods
 	if err == nil {
-		scrapedAt := time.Now().Format("20060102")
-		if info, err := os.Stat(filepath.Join(HTML_CACHE, cacheName)); err == nil {
-			scrapedAt = info.ModTime().Format("20060102")
+		fetchTime = meta.FetchTime
+		goodsList, err = extractGoods(cachedBytes, layout, category, query, fetchTime.Format("20060102"))
+		if err != nil {
+			qlog.Printf("[%s] 😵‍💫 error creating document from cache: %v", pageCacheName, err)
+			stats.errors.Add(1)
 		}
-		goodsList := extractGoodsFromHtml(doc, category, query, scrapedAt)
-		mutex.Lock()
+	}
+	if err == nil {
+		stats.cacheHit(query)
+		stats.items.Add(int64(len(goodsList)))
+		setSource(goodsList, pageUrl, pageCacheName, fetchTime)
 		for _, good := range goodsList {
-			saveImageToCache(good.ImageUrl)
+			images.queue(good.ImageUrl, qlog)
 		}
+		mutex.Lock()
 		*allGoods = append(*allGoods, goodsList...)
 		mutex.Unlock()
 
 		// console stats
 		if len(goodsList) == 0 {
-			log.Printf("🫥 %d %s %s0%s (cache) %s%s%s", len(*allGoods), query, ColorBlue, ColorReset, ColorCyan, urlToScrape, ColorReset)
+			qlog.Printf("🫥 %d %s0%s (cache) %s%s%s", len(*allGoods), ColorBlue, ColorReset, ColorCyan, urlToScrape, ColorReset)
 		} else {
-			log.Printf("📦 %d %s %s+%d%s", len(*allGoods), query, ColorBlue, len(goodsList), ColorReset)
+			qlog.Printf("📦 %d %s+%d%s", len(*allGoods), ColorBlue, len(goodsList), ColorReset)
 		}
-		return
+		return pageResult{ok: true, items: len(goodsList), lastPage: lastPageLink(cachedBytes)}
+	}
+
+	if offlineMode {
+		qlog.Printf("🫥 not in cache (offline) %s%s%s", ColorCyan, urlToScrape, ColorReset)
+		return pageResult{}
 	}
 
 	// 2. Rate Limiter Acquisition (Only for network scrape)
 	select {
 	case <-ctx.Done():
 		// Task cancelled before acquiring token
-		return
+		return pageResult{}
 	case <-rateLimiter:
 		defer func() {
 			// A. Calculate sleep time
-			sleepTime := time.Duration(rand.Intn(SLEEP_RANDOM_MS)+SLEEP_STATIC_MS) * time.Millisecond
+			sleepTime := time.Duration(config.SleepMin) + time.Duration(rand.Int63n(int64(config.SleepJitter)+1))
 
 			// B. Wait on a Timer or Context Done (INTERRUPTIBLE SLEEP!)
 			timer := time.NewTimer(sleepTime)
@@ -694,7 +996,7 @@ func scrapePage(UA string, ctx context.Context, urlToScrape string, cacheName st
 			select {
 			case <-ctx.Done():
 				timer.Stop()
-				log.Printf("❌ [%s] sleep interrupted", query)
+				qlog.Printf("❌ sleep interrupted")
 			case <-timer.C:
 				// Timer finished normally.
 			}
@@ -704,115 +1006,230 @@ func scrapePage(UA string, ctx context.Context, urlToScrape string, cacheName st
 		}()
 	}
 
-	log.Printf("🔎 %s%s%s %s%s%s", ColorBold, query, ColorReset, ColorCyan, urlToScrape, ColorReset)
-
-	client := &http.Client{
-		Timeout: REQ_TIMEOUT,
-	}
-	req, err := http.NewRequestWithContext(ctx, "GET", urlToScrape, nil)
-	if err != nil {
-		log.Printf("[%s] 💥 error in request: %v", query, err)
-		return
-	}
-	req.Header.Set("User-Agent", UA)
-	res, err := client.Do(req)
+	// fetch with retries
+	bodyBytes, header, attempt, err := fetchPageWithRetries(ctx, UA, urlToScrape, cacheName, query, qlog)
 	if err != nil {
-		// log.Printf("[%s] 💥 error during request: %v", query, err)
-		return
-	}
-	defer res.Body.Close()
-	if res.StatusCode != 200 {
-		log.Printf("[%s] 💥 request code [%d]: '%s'", query, res.StatusCode, res.Status)
-		return
+		if ctx.Err() == nil {
+			qlog.Printf("💥 %v", err)
+			stats.errors.Add(1)
+			recordFailedJob(scrapeJob{url: urlToScrape, cacheKey: cacheName, category: category, query: query}, err, attempt)
+		}
+		return pageResult{}
 	}
+	stats.networkPage(query)
+	stats.bytes.Add(int64(len(bodyBytes)))
+	torRotate(qlog)
 
-	bodyBytes, err := io.ReadAll(res.Body)
+	// extract goods from HTML
+	fetchTime = time.Now()
+	goodsList, err = extractGoods(bodyBytes, layout, category, query, fetchTime.Format("20060102"))
 	if err != nil {
-		log.Printf("[%s] 💥 error reading response body: %v", query, err)
-		return
+		qlog.Printf("😵‍💫 error creating document: %v", err)
+		stats.errors.Add(1)
+		return pageResult{}
 	}
-	resDoc, err := goquery.NewDocumentFromReader(bytes.NewReader(bodyBytes))
-	if err != nil {
-		log.Printf("[%s] 😵‍💫 error creating document: %v", query, err)
-		return
+
+	// headless browser fallback for JS-rendered pages
+	if *headlessFlag && len(goodsList) == 0 {
+		qlog.Printf("🤖 no goods, rendering in %s", config.HeadlessBrowser)
+		renderedBytes, err := renderWithHeadlessBrowser(ctx, UA, urlToScrape)
+		if err != nil {
+			qlog.Printf("💥 headless browser error: %v", err)
+		} else if renderedGoods, err := extractGoods(renderedBytes, layout, category, query, fetchTime.Format("20060102")); err != nil {
+			qlog.Printf("😵‍💫 error creating rendered document: %v", err)
+		} else {
+			bodyBytes, goodsList = renderedBytes, renderedGoods
+		}
 	}
 
-	// extract goods from HTML
-	scrapedAt := time.Now().Format("20060102")
-	goodsList := extractGoodsFromHtml(resDoc, category, query, scrapedAt)
+	// mobile site fallback for broken desktop layout, not for the empty results
+	if config.MobileFallback && len(goodsList) == 0 && layoutBroken(bodyBytes, selectorSets[layout]) {
+		mobileUrl := mobileSiteUrl(urlToScrape)
+		qlog.Printf("📱 desktop layout not recognized, trying the mobile site")
+		mobileBytes, mobileHeader, err := fetchPage(ctx, UA, mobileUrl, mobileCacheName(cacheName), query, qlog)
+		if err != nil {
+			qlog.Printf("💥 mobile site error: %v", err)
+		} else {
+			stats.bytes.Add(int64(len(mobileBytes)))
+			fetchTime = time.Now()
+			if mobileGoods, err := extractGoods(mobileBytes, LAYOUT_MOBILE, category, query, fetchTime.Format("20060102")); err != nil {
+				qlog.Printf("😵‍💫 error creating mobile document: %v", err)
+			} else {
+				bodyBytes, header, goodsList = mobileBytes, mobileHeader, mobileGoods
+				layout, pageUrl, pageCacheName = LAYOUT_MOBILE, mobileUrl, mobileCacheName(cacheName)
+			}
+		}
+	}
+	stats.items.Add(int64(len(goodsList)))
+	setSource(goodsList, pageUrl, pageCacheName, fetchTime)
 
 	// save HTML to cache
-	saveHtmlToCache(cacheName, bodyBytes)
+	saveHtmlToCache(pageCacheName, newCacheMeta(pageUrl, query, header, fetchTime), bodyBytes, qlog)
 
 	// extract goods images
-	mutex.Lock()
 	for _, good := range goodsList {
-		saveImageToCache(good.ImageUrl)
+		images.queue(good.ImageUrl, qlog)
 	}
+	mutex.Lock()
 	*allGoods = append(*allGoods, goodsList...)
 	total := len(*allGoods)
 	mutex.Unlock()
 
 	// console
 	if total == 0 {
-		log.Printf("🫥 %d %s %s0%s%s%s", total, query, ColorBlue, ColorCyan, urlToScrape, ColorReset)
-		return
+		qlog.Printf("🫥 %d %s0%s%s%s", total, ColorBlue, ColorCyan, urlToScrape, ColorReset)
 	} else {
-		log.Printf("📦 %d %s %s+%d%s", total, query, ColorBlue, len(goodsList), ColorReset)
+		qlog.Printf("📦 %d %s+%d%s", total, ColorBlue, len(goodsList), ColorReset)
 	}
+	return pageResult{ok: true, items: len(goodsList), lastPage: lastPageLink(bodyBytes)}
 }
 
-// appendToCsv - append data to the CSV file
-func appendToCsv(goods []Goods, filename string, mutex *sync.Mutex) {
-	mutex.Lock()
-	defer mutex.Unlock()
+// previousOutputCount - helper function to count items in the previous output file
+func previousOutputCount(filename string) int {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return 0
+	}
+	if strings.HasSuffix(filename, ".json") {
+		var previous struct {
+			Count int `json:"count"`
+		}
+		if err := json.Unmarshal(content, &previous); err != nil {
+			return 0
+		}
+		return previous.Count
+	}
+	if strings.HasSuffix(filename, ".ndjson") {
+		count := 0
+		for line := range bytes.Lines(content) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				count++
+			}
+		}
+		return count
+	}
+	if strings.HasSuffix(filename, ".xml") {
+		return xmlFeedCount(content)
+	}
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil || len(records) == 0 {
+		return 0
+	}
+	return len(records) - 1 // header
+}
+
+// newOutputCount - items of the new output counted like previousOutputCount counts the previous one:
+// the CSV lists all offers, the JSON, NDJSON and XML outputs the ones still valid
+func newOutputCount(filename string, goods int, validOffers int) int {
+	if strings.HasSuffix(filename, ".json") || strings.HasSuffix(filename, ".ndjson") || strings.HasSuffix(filename, ".xml") {
+		return validOffers
+	}
+	return goods
+}
+
+// keepLastGood - check if the new output may replace the previous one
+func keepLastGood(filename string, count int) bool {
+	if *forceFlag {
+		return true
+	}
+	return keepLastGoodCount(filename, previousOutputCount(filename), count)
+}
 
+// keepLastGoodCount - compare the item counts of the new and the previous output, 0 = no previous output
+func keepLastGoodCount(name string, previous int, count int) bool {
+	if *forceFlag || previous == 0 {
+		return true
+	}
+	if count*100 < previous*config.KeepLastGoodPercent {
+		log.Printf("🛡️ [%s] %snew output has %d items, previous had %d (< %d%%), keeping the previous one (use --force to override)%s",
+			name, ColorRed, count, previous, config.KeepLastGoodPercent, ColorReset)
+		return false
+	}
+	return true
+}
+
+// goodsHash - unique product hash used as the stable ID (see koopi ids)
+func goodsHash(item Goods) string {
+	if config.IdScheme == ID_SCHEME_UUID && item.ProductId != "" {
+		return item.ProductId
+	}
+	hash := md5.Sum([]byte(item.Name + item.Volume + item.Category + item.SubCat))
+	return hex.EncodeToString(hash[:])
+}
+
+// appendToCsv - append data to the CSV file
+func appendToCsv(snap *outputSnapshot, filename string) error {
 	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
 	if err != nil {
-		log.Fatalf("[%s] 💥 error opening for writing: %v", filename, err)
+		return err
 	}
 	defer file.Close()
 
 	writer := csv.NewWriter(file)
 	writer.Comma = ';'
-	headers := []string{"Name", "Price", "PricePerUnit", "Discount", "Category", "SubCat", "Note", "Club", "Volume", "Market", "Validity", "Url", "ImageUrl", "Query", "ScrapedAt"}
+	headers := []string{"Name", "Brand", "Price", "PriceRaw", "PricePerUnit", "PricePerUnitRaw", "PricePerUnitDerived", "Currency", "Discount", "DiscountPercent", "DiscountImplied", "OriginalPrice", "Category", "SubCat", "DepositBottle", "Packaging", "Note", "Club", "ClubRequired", "ClubName", "Volume", "Quantity", "Unit", "PackCount", "PieceQuantity", "PiecePrice", "Market", "Chain", "Validity", "ValidFrom", "ValidTo", "Url", "ImageUrl", "Query", "ScrapedAt", "SourcePage", "SourceCache", "SourceFetchTime", "Pinned", "GroupId", "ProductId", "Ean", "ProductCode"}
 	writer.Write(headers)
 
-	for _, item := range goods {
-		item.ImageUrl = strings.TrimPrefix(item.ImageUrl, "https://img.kupi.cz/kupi/thumbs/")
-		item.ImageUrl = strings.TrimPrefix(item.ImageUrl, "https://img.kupi.cz/img/no_img/no_discounts.png")
-
-		cleanUrl := strings.TrimPrefix(item.Url, KOOPI_HOME_URL)
+	for _, item := range snap.Goods {
 		writer.Write([]string{
 			item.Name,
+			item.Brand,
+			formatPrice(item.PriceValue),
 			item.Price,
+			formatPrice(item.PricePerUnitValue),
 			item.PricePerUnit,
+			strconv.FormatBool(item.PricePerUnitDerived),
+			item.Currency,
 			item.Discount,
+			formatDiscount(item.DiscountPercent),
+			strconv.FormatBool(item.DiscountImplied),
+			formatPrice(item.OriginalPrice),
 			item.Category,
 			item.SubCat,
+			strconv.FormatBool(item.DepositBottle),
+			item.Packaging,
 			item.Note,
 			item.Club,
+			strconv.FormatBool(item.ClubRequired),
+			item.ClubName,
 			item.Volume,
+			formatQuantity(item.Quantity),
+			item.Unit,
+			formatQuantity(float64(item.PackCount)),
+			formatQuantity(item.PieceQuantity),
+			formatPrice(item.PiecePrice),
 			item.Market,
+			item.Chain,
 			item.Validity,
-			cleanUrl,
-			item.ImageUrl,
+			item.ValidFrom,
+			item.ValidTo,
+			trimUrl(item.Url),
+			trimImageUrl(item.ImageUrl),
 			item.Query,
 			item.ScrapedAt,
+			item.SourcePage,
+			item.SourceCache,
+			item.SourceFetchTime,
+			item.Pinned,
+			item.GroupId,
+			item.ProductId,
+			item.Ean,
+			item.ProductCode,
 		})
 	}
 
 	writer.Flush()
 	if err := writer.Error(); err != nil {
-		log.Fatalf("[%s] 💥 error writing: %v", filename, err)
+		return err
 	}
+	return file.Close()
 }
 
-// appendToJson - save data to the JSON file
-func appendToJson(goods []Goods, filename string, markets []string, mutex *sync.Mutex) {
-	mutex.Lock()
-	defer mutex.Unlock()
-
+// outputItems - the offers of the JSON outputs with the integer product IDs, hashmap maps the goodsHash to the ID
+func outputItems(goods []Goods) (items []outputItem, hashmap map[string]int) {
 	// this map is used to find how many offers exist for a given product name/volume combination
 	genericProductCounts := make(map[string]int)
 	for _, item := range goods {
@@ -820,38 +1237,73 @@ func appendToJson(goods []Goods, filename string, markets []string, mutex *sync.
 		genericProductCounts[genericHashKey]++
 	}
 
-	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
-	if err != nil {
-		log.Fatalf("[%s] 💥 error opening for writing: %v", filename, err)
-	}
-	defer file.Close()
-
-	var cleanedGoods []map[string]any
+	items = []outputItem{}
 	for _, item := range goods {
-		hashString := item.Name + item.Volume + item.Category + item.SubCat // unique good hash (for ID)
-		hash := md5.Sum([]byte(hashString))
-		md5Hash := hex.EncodeToString(hash[:])
-
 		// retrieve the offer count for the generic product
 		genericHashKey := item.Name + item.Volume + item.Category + item.SubCat
 		offerCount := genericProductCounts[genericHashKey]
 
-		cleanedItem := make(map[string]any)
-		cleanedItem["id"] = md5Hash
-		cleanedItem["cat"] = item.Category
-		cleanedItem["subcat"] = item.SubCat
-		cleanedItem["query"] = item.Query
-		cleanedItem["name"] = item.Name
-		cleanedItem["price"] = strings.Replace(item.Price, ",", ".", 1)
-		cleanedItem["ppunit"] = strings.Replace(item.PricePerUnit, ".", ",", 1)
-		cleanedItem["discount"] = item.Discount
-		cleanedItem["note"] = item.Note
-		cleanedItem["club"] = item.Club
-		cleanedItem["volume"] = item.Volume
-		cleanedItem["market"] = item.Market
-		cleanedItem["validity"] = item.Validity
-		cleanedItem["url"] = strings.TrimPrefix(item.Url, KOOPI_HOME_URL)
-		cleanedItem["scrapedat"] = item.ScrapedAt
+		product := outputProduct{
+			hash:          goodsHash(item), // unique good hash (for ID)
+			Uuid:          item.ProductId,
+			Name:          item.Name,
+			Brand:         item.Brand,
+			Volume:        item.Volume,
+			Quantity:      optionalNumber(item.Quantity),
+			Unit:          item.Unit,
+			PieceQuantity: optionalNumber(item.PieceQuantity),
+			Cat:           item.Category,
+			SubCat:        item.SubCat,
+			Packaging:     item.Packaging,
+			DepositBottle: item.DepositBottle,
+			Ean:           item.Ean,
+			ProductCode:   item.ProductCode,
+			Description:   item.Description,
+			AllMarkets:    item.AllMarkets,
+			PriceHistory:  item.PriceHistory,
+			Url:           trimUrl(item.Url),
+			GroupId:       item.GroupId,
+		}
+		if item.PackCount != 0 {
+			product.PackCount = &item.PackCount
+		}
+		offer := outputOffer{
+			Query:            item.Query,
+			Price:            optionalNumber(item.PriceValue),
+			PriceRaw:         item.Price,
+			PriceUnknown:     isPriceUnknown(item),
+			PricePerUnit:     optionalNumber(item.PricePerUnitValue),
+			PricePerUnitRaw:  item.PricePerUnit,
+			PricePerUnitText: pricePerUnitText(item),
+			PpunitDerived:    item.PricePerUnitDerived,
+			Currency:         item.Currency,
+			Discount:         item.Discount,
+			DiscountImplied:  item.DiscountImplied,
+			OriginalPrice:    optionalNumber(item.OriginalPrice),
+			PiecePrice:       optionalNumber(item.PiecePrice),
+			Note:             item.Note,
+			Club:             item.Club,
+			ClubRequired:     item.ClubRequired,
+			ClubName:         item.ClubName,
+			Market:           item.Market,
+			Chain:            item.Chain,
+			ValidFrom:        item.ValidFrom,
+			ValidTo:          item.ValidTo,
+			ScrapedAt:        item.ScrapedAt,
+			SourcePage:       item.SourcePage,
+			SourceCache:      item.SourceCache,
+			SourceFetchTime:  item.SourceFetchTime,
+			Computed:         item.Computed,
+			Pinned:           item.Pinned,
+		}
+		if item.DiscountPercent >= 0 {
+			offer.DiscountPercent = &item.DiscountPercent
+		}
+		if absolute, percent, ok := savings(item); ok {
+			offer.Baseline = &item.Baseline
+			offer.SavingsAbsolute = &absolute
+			offer.SavingsPercent = &percent
+		}
 
 		cleanPrice := strings.ReplaceAll(item.Price, "Kč", "")
 		cleanPrice = strings.ReplaceAll(cleanPrice, " ", "")
@@ -863,11 +1315,11 @@ func appendToJson(goods []Goods, filename string, markets []string, mutex *sync.
 		// split price to parts: whole,decimal
 		if priceFloat, err := strconv.ParseFloat(cleanPrice, 64); err == nil {
 			whole, frac := math.Modf(priceFloat)
-			cleanedItem["pw"] = strconv.Itoa(int(whole))
-			cleanedItem["pd"] = fmt.Sprintf("%02d", int(math.Round(frac*100)))
+			offer.Pw = strconv.Itoa(int(whole))
+			offer.Pd = fmt.Sprintf("%02d", int(math.Round(frac*100)))
 		} else {
-			cleanedItem["pw"] = cleanPrice
-			cleanedItem["pd"] = "00"
+			offer.Pw = cleanPrice
+			offer.Pd = "00"
 		}
 
 		// cat data.json | jq '.goods[].validity' | sort | uniq
@@ -937,50 +1389,65 @@ func appendToJson(goods []Goods, filename string, markets []string, mutex *sync.
 		}
 
 		// store the values
-		cleanedItem["valcol"] = valcol
-		cleanedItem["validity"] = validity
+		offer.Valcol = valcol
+		offer.Validity = validity
 
 		// image
-		imageURL := item.ImageUrl
+		imageURL := imageOutputName(item.ImageUrl)
 		if before, ok := strings.CutSuffix(imageURL, ".png"); ok {
 			imageURL = before + ".webp"
 		} else if before0, ok0 := strings.CutSuffix(imageURL, ".jpg"); ok0 {
 			imageURL = before0 + ".webp"
 		}
-		imageURL = strings.TrimPrefix(imageURL, "https://img.kupi.cz/kupi/thumbs/")
-		imageURL = strings.TrimPrefix(imageURL, "https://img.kupi.cz/img/no_img/no_discounts.png")
 		if imageURL == "" || strings.Contains(imageURL, "no_discounts") {
 			imageURL = "default.webp"
 		}
-		cleanedItem["image"] = imageURL
+		product.Image = imageURL
+		product.HasImage = imageURL != "default.webp"
+		product.ImageAvif = imageAvif(item.ImageUrl)
+		product.Thumbs = imageThumbs(item.ImageUrl)
+
+		outItem := outputItem{outputProduct: product, outputOffer: offer}
+		if offerCount > 1 {
+			outItem.OfferCount = fmt.Sprintf("%dx", offerCount)
+		}
+		items = append(items, outItem)
+	}
 
-		if offerCount <= 1 {
-			cleanedItem["offer_count"] = ""
-		} else {
-			cleanedItem["offer_count"] = fmt.Sprintf("%dx", offerCount)
+	// convert id hashes to integers, create hashmap
+	id := 1
+	hashmap = make(map[string]int)
+	for i := range items {
+		hash := items[i].hash
+		if _, exists := hashmap[hash]; !exists {
+			hashmap[hash] = id
+			id++
 		}
+		items[i].Id = hashmap[hash]
+	}
+	return items, hashmap
+}
+
+// appendToJson - save data to the JSON file
+func appendToJson(snap *outputSnapshot, filename string) error {
+	items, hashmap := outputItems(snap.Goods)
 
-		cleanedGoods = append(cleanedGoods, cleanedItem)
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
 	}
+	defer file.Close()
 
-	// convert id hashes to integers, find unique keywords, create hashmap
-	id := 1
-	hashmap := make(map[string]int)
+	// find unique keywords
 	wordsSeen := make(map[string]bool)
 	keywordsIndex := make(map[string][]int)
 	cleaner := strings.NewReplacer("%", "", "°", "", ",", "", "!", "")
 	var uniqueWords []string
-	for i := range cleanedGoods {
-		hash := cleanedGoods[i]["id"].(string)
-		if _, exists := hashmap[hash]; !exists {
-			hashmap[hash] = id
-			id++
-		}
-		currentIntID := hashmap[hash]
-		cleanedGoods[i]["id"] = currentIntID
+	for i := range items {
+		currentIntID := items[i].Id
 
 		// processing unique keywords
-		name := strings.ToLower(cleanedGoods[i]["name"].(string))
+		name := strings.ToLower(items[i].Name)
 		for w := range strings.FieldsSeq(name) {
 			w = removeDiacritics(w)
 			w = cleaner.Replace(w)
@@ -998,7 +1465,7 @@ func appendToJson(goods []Goods, filename string, markets []string, mutex *sync.
 			}
 		}
 	}
-	sort.Strings(uniqueWords)
+	newCollator().SortStrings(uniqueWords)
 
 	// reverse hashmap for quick JavaScript pairing
 	reversedHashmap := make(map[int]string)
@@ -1008,20 +1475,29 @@ func appendToJson(goods []Goods, filename string, markets []string, mutex *sync.
 
 	// count items
 	catCounts := make(map[string]int)
-	for _, item := range cleanedGoods {
-		catCounts[item["cat"].(string)]++
+	for _, item := range items {
+		catCounts[item.Cat]++
 	}
 
 	// output data
-	outputData := make(map[string]any)
-	outputData["created"] = time.Now().Format(time.RFC3339)
-	outputData["count"] = len(cleanedGoods)
-	outputData["goods"] = cleanedGoods
-	outputData["markets"] = markets
-	outputData["keywords"] = strings.Join(uniqueWords, " ")
-	outputData["keywordsindex"] = keywordsIndex
-	outputData["idhashmap"] = reversedHashmap
-	outputData["catcounts"] = catCounts
+	outputData := outputDocument{
+		Version:       JSON_OUTPUT_VERSION,
+		Created:       time.Now().Format(time.RFC3339),
+		Tag:           *tagFlag,
+		Count:         len(items),
+		Markets:       marketEntries(snap),
+		Keywords:      strings.Join(uniqueWords, " "),
+		KeywordsIndex: keywordsIndex,
+		IdHashmap:     reversedHashmap,
+		CatCounts:     catCounts,
+	}
+	if config.JsonLayout != JSON_LAYOUT_GROUPED {
+		outputData.Goods = items
+	}
+	if config.JsonLayout != JSON_LAYOUT_FLAT {
+		outputData.Products = groupProducts(items)
+		outputData.ProductCount = len(outputData.Products)
+	}
 
 	// save to JSON
 	encoder := json.NewEncoder(file)
@@ -1030,39 +1506,128 @@ func appendToJson(goods []Goods, filename string, markets []string, mutex *sync.
 	//encoder.SetIndent("", "  ")
 
 	if err := encoder.Encode(outputData); err != nil {
-		log.Fatalf("[%s] 💥 error writing to JSON: %v", filename, err)
+		return err
 	}
+	return file.Close()
 }
 
 // MAIN
 func main() {
-	if !checkLock() {
-		os.Exit(1)
+	flag.Parse()
+	command := COMMAND_SCRAPE
+	if flag.NArg() > 0 {
+		command = flag.Arg(0)
+	}
+	defer recoverFatal(command)
+
+	setStage("config")
+	if err := loadConfig(*configFlag); err != nil {
+		fatal(command, fmt.Errorf("[%s] error loading config: %w", *configFlag, err))
 	}
-	defer unlockLock()
 
 	// set flags
 	log.SetFlags(0)
 
+	// subcommands
+	if flag.NArg() > 0 {
+		setStage(command)
+		if err := runCommand(flag.Arg(0), flag.Args()[1:]); err != nil {
+			fatal(command, fmt.Errorf("%s: %w", flag.Arg(0), err))
+		}
+		return
+	}
+
+	if !checkLock() {
+		os.Exit(1)
+	}
+	err := func() error {
+		defer unlockLock() // released on panics too, before recoverFatal exits
+		return runScraper()
+	}()
+	if err != nil {
+		fatal(command, err)
+	}
+}
+
+// errOutputsKept - the previous outputs were kept by the keep-last-good protection
+var errOutputsKept = errors.New("outputs were NOT replaced")
+
+// runScraper - scrape all queries from the input CSV and write the outputs
+func runScraper() error {
+	scrapeRunning.Store(true)
+	UA, err := setupRun()
+	if err != nil {
+		return err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+
+	start := time.Now()
+	jobs, err := loadJobs(config.InputCsv)
+	if err != nil {
+		return err
+	}
+	stats.stageDone("urls", start)
+	if len(jobs) == 0 {
+		log.Println("🍀 Nothing to scrape.")
+		return nil
+	}
+
+	scrapedGoods := scrapeJobs(UA, jobs)
+	return finishRun(scrapeDetails(UA, scrapedGoods), jobs)
+}
+
+// setupRun - pick the UA, create the HTTP client and the rate limiter
+func setupRun() (string, error) {
+	if err := validateRunTag(*tagFlag); err != nil {
+		return "", err
+	}
+	setStage("setup")
+	runStarted = time.Now()
+	stats = newRunStats()
+
+	if *headlessFlag {
+		if _, err := headlessBrowserPath(); err != nil {
+			return "", err
+		}
+	}
+
 	// set random UA
-	UA := UserAgents[rand.Intn(len(UserAgents))]
+	UA := config.UserAgents[rand.Intn(len(config.UserAgents))]
 	log.Printf("UA: %s", UA)
 
+	// shared HTTP client
+	var err error
+	httpClient, err = newHttpClient(*consentFlag)
+	if err != nil {
+		return "", fmt.Errorf("creating HTTP client: %w", err)
+	}
+
 	// set rate limiter
-	rateLimiter = make(chan struct{}, MAX_THREADS)
-	for range MAX_THREADS {
+	rateLimiter = make(chan struct{}, config.Threads)
+	for range config.Threads {
 		rateLimiter <- struct{}{}
 	}
 
+	// HTML cache backend
+	if err := openHtmlCache(); err != nil {
+		return "", err
+	}
+	enforceCacheLimits()
+	cacheLimitsOnClose = true
+
 	// just to be sure make blocked goods lowercase
 	for i, v := range blockedGoods {
 		blockedGoods[i] = strings.ToLower(v)
 	}
+	return UA, nil
+}
 
-	// load input CSV
-	file, err := os.Open(INPUT_CSV)
+// loadJobs - generate pages to scrape from the input CSV
+func loadJobs(filename string) ([]scrapeJob, error) {
+	file, err := os.Open(filename)
 	if err != nil {
-		log.Fatalf("[%s] 💥 error opening: %v", INPUT_CSV, err)
+		return nil, fmt.Errorf("[%s] error opening: %w", filename, err)
 	}
 	defer file.Close()
 
@@ -1071,20 +1636,16 @@ func main() {
 	reader.FieldsPerRecord = -1
 	inputRecords, err := reader.ReadAll()
 	if err != nil {
-		log.Fatalf("[%s] 💥 error reading: %v", INPUT_CSV, err)
+		return nil, fmt.Errorf("[%s] error reading: %w", filename, err)
 	}
 
 	if len(inputRecords) == 0 {
-		log.Printf("😐️ [%s] is empty. Nothing to scrape.", INPUT_CSV)
-		return
+		log.Printf("😐️ [%s] is empty. Nothing to scrape.", filename)
+		return nil, nil
 	}
 
-	var urlsToScrape []struct {
-		url      string
-		cacheKey string
-		category string
-		query    string
-	}
+	var jobs []scrapeJob
+	migrated := 0
 
 	// generate URLs to scrape
 	for _, record := range inputRecords {
@@ -1093,55 +1654,112 @@ func main() {
 		}
 		category := strings.TrimSpace(record[0])
 		query := strings.TrimSpace(record[1])
-		pages, _ := strconv.Atoi(strings.TrimSpace(record[2]))
-		escapedQuery := url.QueryEscape(query)
+		pagesText := ""
+		if len(record) > 2 {
+			pagesText = strings.TrimSpace(record[2])
+		}
+		pages, _ := strconv.Atoi(pagesText)
+		autoPages := strings.EqualFold(pagesText, PAGES_AUTO) || config.AutoPages && pages > 0
+		if autoPages {
+			pages = 1 // the rest is queued by the pagination of the first page
+		}
 
-		for pageNum := 1; pageNum <= pages; pageNum++ {
-			var urlStr string
-			if pageNum == 1 {
-				urlStr = KOOPI_SEARCH_URL + escapedQuery
-			} else {
-				urlStr = fmt.Sprintf("%s%s%s%d", KOOPI_SEARCH_URL, escapedQuery, KOOPI_SUBPAGE, pageNum)
+		// listing pages: the shop discount listing ("shop:Lidl", paginated automatically without PAGES)
+		// or a category page URL, e.g. rows of koopi discover
+		var listingUrl *url.URL
+		label, pageCap := query, 0
+		if chain, ok := strings.CutPrefix(query, SHOP_QUERY_PREFIX); ok {
+			listingUrl, _ = url.Parse(KOOPI_SHOP_URL + slugify(chain))
+			pageCap = config.ShopPagesMax
+			if pages == 0 {
+				autoPages, pages = true, 1
+			}
+		} else if categoryUrl, err := url.Parse(query); err == nil && categoryUrl.Host != "" {
+			listingUrl = categoryUrl
+			label = strings.Trim(categoryUrl.Path, "/")
+			label = label[strings.LastIndex(label, "/")+1:]
+		}
+		if listingUrl != nil {
+			for pageNum := 1; pageNum <= pages; pageNum++ {
+				urlStr := listingPageUrl(*listingUrl, pageNum)
+				jobs = append(jobs, scrapeJob{url: urlStr, cacheKey: cacheKeyFor(label, pageNum, urlStr), category: category, query: label,
+					page: pageNum, autoPages: autoPages, firstUrl: listingUrl.String(), pageCap: pageCap})
+			}
+			continue
+		}
+
+		// the synonyms are searched too, their goods are merged under the query
+		for _, term := range queryTerms(query, record) {
+			escapedQuery := url.QueryEscape(term)
+			for pageNum := 1; pageNum <= pages; pageNum++ {
+				var urlStr string
+				if pageNum == 1 {
+					urlStr = KOOPI_SEARCH_URL + escapedQuery
+				} else {
+					urlStr = fmt.Sprintf("%s%s%s%d", KOOPI_SEARCH_URL, escapedQuery, KOOPI_SUBPAGE, pageNum)
+				}
+				cacheKey := cacheKeyFor(term, pageNum, urlStr)
+				migrated += migrateCacheKey(legacyCacheKey(term, pageNum), cacheKey)
+				jobs = append(jobs, scrapeJob{url: urlStr, cacheKey: cacheKey, category: category, query: query,
+					page: pageNum, autoPages: autoPages, firstUrl: KOOPI_SEARCH_URL + escapedQuery})
+			}
+		}
+	}
+	if migrated > 0 {
+		log.Printf("🔑 migrated %d cache entries to hash-based keys", migrated)
+	}
+	return jobs, nil
+}
+
+// queryTerms - the query and its synonyms of the SYNONYMS column, e.g. "butter|maslo"
+func queryTerms(query string, record []string) []string {
+	terms := []string{query}
+	seen := map[string]bool{strings.ToLower(query): true} // "maslo" is another search than "máslo"
+	if len(record) > 3 {
+		for _, synonym := range strings.Split(record[3], SYNONYM_SEPARATOR) {
+			synonym = strings.TrimSpace(synonym)
+			if synonym != "" && !seen[strings.ToLower(synonym)] {
+				seen[strings.ToLower(synonym)] = true
+				terms = append(terms, synonym)
 			}
-			cacheKey := fmt.Sprintf("%s-%d.html", strings.ReplaceAll(query, " ", "-"), pageNum)
-			urlsToScrape = append(urlsToScrape, struct {
-				url      string
-				cacheKey string
-				category string
-				query    string
-			}{urlStr, cacheKey, category, query})
 		}
 	}
+	return terms
+}
 
-	urlsToScrape2 := make([]struct {
-		url      string
-		cacheKey string
-		category string
-		query    string
-	}, len(urlsToScrape))
+// listingPageUrl - page of the search or category listing, the first one is the listing URL
+func listingPageUrl(listingUrl url.URL, pageNum int) string {
+	if pageNum > 1 {
+		values := listingUrl.Query()
+		values.Set("page", strconv.Itoa(pageNum))
+		listingUrl.RawQuery = values.Encode()
+	}
+	return listingUrl.String()
+}
 
-	// unshuffled original copy of the list
-	copy(urlsToScrape2, urlsToScrape)
+// scrapeJobs - scrape the pages by the workers
+func scrapeJobs(UA string, jobs []scrapeJob) []Goods {
+	urlsToScrape := make([]scrapeJob, len(jobs))
+	copy(urlsToScrape, jobs)
 
 	// shuffle URLs
 	rand.Shuffle(len(urlsToScrape), func(i, j int) {
 		urlsToScrape[i], urlsToScrape[j] = urlsToScrape[j], urlsToScrape[i]
 	})
-
-	// check limits
-	if len(urlsToScrape) == 0 {
-		log.Println("🍀 Nothing to scrape.")
-		return
+	if config.StopOnEmpty {
+		// earlier pages first, an empty page cancels the later ones of its query
+		sort.SliceStable(urlsToScrape, func(i, j int) bool {
+			return urlsToScrape[i].page < urlsToScrape[j].page
+		})
 	}
 
 	// check limits
-	if len(urlsToScrape) > MAX_SCRAPED_GOODS {
-		log.Println("😶 Applying MAX_SCRAPED_GOODS limit.")
-		urlsToScrape = urlsToScrape[:MAX_SCRAPED_GOODS]
+	if len(urlsToScrape) > config.MaxPages {
+		log.Printf("😶 Applying max_pages limit %d.", config.MaxPages)
+		urlsToScrape = urlsToScrape[:config.MaxPages]
 	}
 
 	var newScrapedGoods []Goods
-	var csvMutex sync.Mutex
 	var goodsMutex sync.Mutex
 	var wg sync.WaitGroup
 	ctx, cancel := context.WithCancel(context.Background())
@@ -1150,37 +1768,111 @@ func main() {
 	// signals handling
 	signals := make(chan os.Signal, 1)
 	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
 	go func() {
-		<-signals
-		log.Println("\n\n🤯 Ctrl+C ...")
-		cancel()
+		select {
+		case <-signals:
+			log.Println("\n\n🤯 Ctrl+C ...")
+			cancel()
+		case <-ctx.Done():
+		}
 	}()
 
-	// concurrency
-	concurrencyLimit := make(chan struct{}, MAX_THREADS)
+	// concurrency - worker slots
+	concurrencyLimit := make(chan int, config.Threads)
+	for worker := 1; worker <= config.Threads; worker++ {
+		concurrencyLimit <- worker
+	}
 
-	// workers
+	setStage("scrape")
+	scrapeStart := time.Now()
+
+	// per-query log groups
+	for _, urlData := range urlsToScrape {
+		expectLogGroup(urlData.query)
+	}
+
+	// image downloads
+	images = startImagePool(ctx)
+	defer func() { images = nil }()
+
+	// live progress
+	progressDone := make(chan struct{})
+	go stats.reportProgress(len(urlsToScrape), progressDone)
+	defer close(progressDone)
+
+	// job queue, the automatic pagination queues more pages of the listings
+	queue := make(chan scrapeJob, len(urlsToScrape)+len(urlsToScrape)*max(config.AutoPagesMax, config.ShopPagesMax))
+	var pending sync.WaitGroup
+	var queuedPages atomic.Int64
+	queuedPages.Store(int64(len(urlsToScrape)))
+	pager := newListingPager(urlsToScrape)
+	var skippedPages atomic.Int64
 	for _, urlData := range urlsToScrape {
+		pending.Add(1)
+		queue <- urlData
+	}
+	go func() {
+		pending.Wait()
+		close(queue)
+	}()
+
+	// workers
+	for urlData := range queue {
+		worker := <-concurrencyLimit
+		if pager.skip(urlData) {
+			// a previous page of the listing was empty
+			skippedPages.Add(1)
+			newQueryLogger(urlData.query, worker).Done()
+			concurrencyLimit <- worker
+			pending.Done()
+			continue
+		}
 		wg.Add(1)
-		concurrencyLimit <- struct{}{}
-		go func(urlData struct {
-			url      string
-			cacheKey string
-			category string
-			query    string
-		}) {
+		go func(urlData scrapeJob) {
+			defer pending.Done()
 			defer func() {
-				<-concurrencyLimit
+				concurrencyLimit <- worker
 			}()
-			scrapePage(UA, ctx, urlData.url, urlData.cacheKey, urlData.category, urlData.query, &newScrapedGoods, &goodsMutex, &wg)
+			qlog := newQueryLogger(urlData.query, worker)
+			if urlData.autoPages {
+				expectLogGroup(urlData.query) // keep the group open for the following pages
+				defer qlog.Done()
+			}
+			result := scrapePage(UA, ctx, urlData.url, urlData.cacheKey, urlData.category, urlData.query, &newScrapedGoods, &goodsMutex, &wg, qlog)
+			for _, next := range pager.next(urlData, result) {
+				if ctx.Err() != nil || queuedPages.Add(1) > int64(config.MaxPages) {
+					break
+				}
+				expectLogGroup(next.query)
+				pending.Add(1)
+				queue <- next
+			}
 		}(urlData)
 	}
 
 	// wait for workers to finish
 	wg.Wait()
+	flushAllLogGroups()
+	if skippedPages.Load() > 0 {
+		log.Printf("⏭️ %d pages skipped after empty pages of their queries", skippedPages.Load())
+	}
+	stats.stageDone("scrape", scrapeStart)
+	imagesStart := time.Now()
+	images.wait()
+	stats.stageDone("images", imagesStart)
+	return newScrapedGoods
+}
+
+// finishRun - deduplicate and post-process the goods, write the outputs
+func finishRun(newScrapedGoods []Goods, urlsToScrape2 []scrapeJob) error {
+	setStage("process")
 
 	// deduplication
-	finalGoods := deduplicateGoods(newScrapedGoods)
+	start := time.Now()
+	finalGoods := fuzzyDeduplicateGoods(deduplicateGoods(newScrapedGoods))
+	stats.stageDone("dedup", start)
+	start = time.Now()
 
 	// create stats
 	uniqueMarkets := make(map[string]struct{})
@@ -1200,6 +1892,30 @@ func main() {
 		}
 	}
 
+	// custom post-processors
+	finalGoods = postprocess.Apply(finalGoods)
+
+	// offers without a price
+	finalGoods = applyPriceUnknownPolicy(finalGoods, config.PriceUnknown)
+
+	// pinned products, placeholders for the ones without offers
+	finalGoods = applyPinnedProducts(finalGoods, config.PinnedProducts)
+	if len(config.PinnedProducts) > 0 {
+		baselines, err := loadBaselines(statePath(config.BaselinesFile))
+		if err != nil {
+			log.Printf("💥 error loading baselines: %v", err)
+		}
+		applyBaselines(finalGoods, baselines)
+	}
+
+	// user-defined computed fields
+	applyComputedFields(finalGoods, config.ComputedFields)
+
+	// image availability
+	if config.VerifyImages != 0 && !offlineMode {
+		verifyImages(finalGoods, config.VerifyImages)
+	}
+
 	// unique markets and volumes
 	for _, good := range finalGoods {
 		if good.Market != "" {
@@ -1216,7 +1932,7 @@ func main() {
 	for market := range uniqueMarkets {
 		marketsList = append(marketsList, market)
 	}
-	sort.Strings(marketsList)
+	newCollator().SortStrings(marketsList)
 	var marketStatsList []string
 	for _, market := range marketsList {
 		marketStatsList = append(marketStatsList, fmt.Sprintf("%s (%d)", market, marketCounts[market]))
@@ -1231,22 +1947,98 @@ func main() {
 	sort.Strings(volumesList)
 	//fmt.Printf("\n🥡 Volumes [%d]: %s\n", len(volumesList), strings.Join(volumesList, ", "))
 
-	// save to CSV
-	c := collate.New(language.Czech)
-	sort.Slice(finalGoods, func(i, j int) bool {
-		return c.CompareString(finalGoods[i].Name, finalGoods[j].Name) < 0
-	})
-	appendToCsv(finalGoods, OUTPUT_CSV, &csvMutex)
+	stats.stageDone("process", start)
 
-	// save to JSON
-	cExport := collate.New(language.Czech, collate.IgnoreCase)
-	sort.Slice(marketsList, func(i, j int) bool {
-		return cExport.CompareString(marketsList[i], marketsList[j]) < 0
-	})
-	appendToJson(finalGoods, OUTPUT_JSON, marketsList, &csvMutex)
+	// stats and failed URLs for koopi retry, also of the runs that do not replace the outputs
+	if !offlineMode {
+		defer func() {
+			if err := stats.save(statePath(config.StatsFile)); err != nil {
+				log.Printf("[%s] 💥 error writing stats: %v", config.StatsFile, err)
+			}
+			saveFailedJobs(statePath(config.FailedUrlsFile))
+		}()
+	}
+
+	// site-change alarm, an empty feed is never published
+	if err := checkCollapse(len(finalGoods)); err != nil {
+		setStage("collapse")
+		log.Printf("🚨 %s%v%s", ColorRed, err, ColorReset)
+		fmt.Printf("\n📊 %s\n", stats)
+		stats.selectorReport()
+		fmt.Printf("\n🚨 Scraper COLLAPSED with %d items, outputs were NOT replaced.\n\n", len(finalGoods))
+		rec := runRecord{Tag: *tagFlag, Started: runStarted, Finished: time.Now(), Items: len(finalGoods), Output: config.OutputJson,
+			Status: RUN_STATUS_COLLAPSED}
+		if err := recordRun(statePath(config.RunsFile), rec); err != nil {
+			log.Printf("[%s] 💥 error recording run: %v", config.RunsFile, err)
+		}
+		return err
+	}
+
+	// keep-last-good protection, the offer outputs count the offers still valid like their previous files
+	writers := enabledOutputs()
+	validOffers, _ := outputItems(finalGoods)
+	outputsOk := true
+	for _, w := range writers {
+		if w.database {
+			continue // checked within the transaction of the writer
+		}
+		if !keepLastGood(w.filename, newOutputCount(w.filename, len(finalGoods), len(validOffers))) {
+			outputsOk = false
+		}
+	}
+	if !outputsOk {
+		fmt.Printf("\n🛡️ Outputs were NOT replaced, %d items scraped.\n\n", len(finalGoods))
+		return errOutputsKept
+	}
+
+	// stable product IDs
+	if err := assignProductIds(finalGoods, config.ProductIdsFile); err != nil {
+		return fmt.Errorf("[%s] %w", config.ProductIdsFile, err)
+	}
+
+	// write all outputs from one snapshot
+	setStage("write")
+	start = time.Now()
+	snap := newOutputSnapshot(finalGoods, marketsList)
+	stats.stageDone("sort", start)
+	if err := writeOutputs(snap, writers); err != nil {
+		return err
+	}
+
+	// images of offers no longer listed
+	if config.PruneOrphanImages && config.OutputJson != "" && !offlineMode {
+		if orphans, err := orphanImageItems([]string{config.OutputJson}); err != nil {
+			log.Printf("💥 orphan images: %v", err)
+		} else if err := (cleanPolicy{}).prune("images (orphans)", orphans); err != nil {
+			log.Printf("💥 orphan images: %v", err)
+		}
+	}
 
+	// bucket upload
+	if config.UploadBucket != "" && !offlineMode {
+		setStage("upload")
+		start = time.Now()
+		if _, err := uploadAll(context.Background(), false, false); err != nil {
+			log.Printf("💥 upload: %v", err)
+		}
+		stats.stageDone("upload", start)
+	}
+
+	fmt.Printf("\n📊 %s\n", stats)
+	stats.timingReport()
+	stats.selectorReport()
+	stats.cacheReport(*cacheReportFlag)
 	fmt.Printf("\n🍀 Scraper finished with %d unique items.\n\n", len(finalGoods))
 
+	// run history
+	if !offlineMode {
+		rec := runRecord{Tag: *tagFlag, Started: runStarted, Finished: time.Now(), Items: len(finalGoods), Output: config.OutputJson,
+			RateLimited: int(stats.rateLimited.Load()), RateLimitPause: Duration(stats.rateLimitPause.Load())}
+		if err := recordRun(statePath(config.RunsFile), rec); err != nil {
+			log.Printf("[%s] 💥 error recording run: %v", config.RunsFile, err)
+		}
+	}
+
 	// compute frequences
 	wordFreq := make(map[string]int)
 	for _, item := range finalGoods {
@@ -1271,4 +2063,5 @@ func main() {
 	}
 
 	fmt.Println()
+	return nil
 }
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadJobsShortRows(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.HtmlCache = t.TempDir()
+
+	filename := filepath.Join(t.TempDir(), "scrape.csv")
+	input := "MLÉKO,máslo\nNÁPOJE,pivo,2\nNÁPOJE,džus,1,juice|dzus\nOBILÍ\n"
+	if err := os.WriteFile(filename, []byte(input), 0644); err != nil {
+		t.Fatal(err)
+	}
+	jobs, err := loadJobs(filename)
+	if err != nil {
+		t.Fatal(err)
+	}
+	count := make(map[string]int)
+	for _, job := range jobs {
+		count[job.query]++
+	}
+	// a row without PAGES has no pages, the synonyms are searched under the query
+	if count["máslo"] != 0 || count["pivo"] != 2 || count["džus"] != 3 || len(jobs) != 5 {
+		t.Errorf("jobs by query = %v", count)
+	}
+}
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"log"
+	"math/rand"
+	"net/url"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+const (
+	OUTPUT_LEAFLETS    = "leaflets.json"
+	KOOPI_LEAFLETS_URL = KOOPI_HOME_URL + "/letaky/" // + chain slug
+	LEAFLET_PREFIX     = "letaky-"                   // cache names of the leaflet pages
+)
+
+// selectors of the leaflet listing and the leaflet pages
+var leafletSelectors = struct {
+	Item      string
+	Name      selectorChain
+	Validity  selectorChain
+	Link      selectorChain
+	PageImage string
+	ImageAttr []string
+}{
+	Item:      ".leaflet, .letak_item, .leaflets_item",
+	Name:      selectorChain{".leaflet_name", ".letak_name", "h3", "a[title]"},
+	Validity:  selectorChain{".leaflet_validity", ".letak_validity", ".validity"},
+	Link:      selectorChain{"a[href*='/letak']", "a[href]"},
+	PageImage: ".leaflet_page img, .letak_page img, .leaflet_pages img",
+	ImageAttr: []string{"data-src", "src"},
+}
+
+// leaflet - one leaflet of the chain in OUTPUT_LEAFLETS
+type leaflet struct {
+	Chain     string   `json:"chain"`
+	Name      string   `json:"name"`
+	Url       string   `json:"url"`
+	Validity  string   `json:"validity"`
+	ValidFrom string   `json:"valid_from,omitempty"`
+	ValidTo   string   `json:"valid_to,omitempty"`
+	Pages     []string `json:"pages"` // page image URLs in order
+}
+
+// leafletsOutput - content of OUTPUT_LEAFLETS
+type leafletsOutput struct {
+	Created  string    `json:"created"`
+	Count    int       `json:"count"`
+	Leaflets []leaflet `json:"leaflets"`
+}
+
+// leafletChains - canonical chains of the chain mapping
+func leafletChains() []string {
+	seen := make(map[string]bool)
+	var chains []string
+	for _, alias := range chainAliases {
+		if !seen[alias.chain] {
+			seen[alias.chain] = true
+			chains = append(chains, alias.chain)
+		}
+	}
+	newCollator().SortStrings(chains)
+	return chains
+}
+
+// loadLeafletPage - leaflet page from the cache, else downloaded and cached
+func loadLeafletPage(ctx context.Context, UA string, pageUrl string) ([]byte, error) {
+	cacheName := LEAFLET_PREFIX + cacheKeyFor(pageUrl[strings.LastIndex(strings.TrimSuffix(pageUrl, "/"), "/")+1:], 1, pageUrl)
+	body, _, err := loadHtmlFromCache(cacheName)
+	if err == nil || offlineMode {
+		return body, err
+	}
+	body, header, _, err := fetchPageWithRetries(ctx, UA, pageUrl, cacheName, "", nil)
+	if err != nil {
+		return nil, err
+	}
+	stats.bytes.Add(int64(len(body)))
+	saveHtmlToCache(cacheName, newCacheMeta(pageUrl, "", header, time.Now()), body, nil)
+	sleepContext(ctx, time.Duration(config.SleepMin)+time.Duration(rand.Int63n(int64(config.SleepJitter)+1)))
+	return body, nil
+}
+
+// extractLeaflets - leaflets of the chain listing page
+func extractLeaflets(body []byte, chain string, listingUrl *url.URL, scrapedAt time.Time) ([]leaflet, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	var leaflets []leaflet
+	doc.Find(leafletSelectors.Item).Each(func(i int, s *goquery.Selection) {
+		href, _ := findFirst(leafletSelectors.Link, s).First().Attr("href")
+		link, err := listingUrl.Parse(href)
+		if href == "" || err != nil {
+			return
+		}
+		name := findFirst(leafletSelectors.Name, s).First()
+		item := leaflet{Chain: chain, Url: link.String()}
+		if item.Name = strings.TrimSpace(name.Text()); item.Name == "" {
+			item.Name, _ = name.Attr("title")
+		}
+		item.Name = sanitizeString(strings.Join(strings.Fields(item.Name), " "))
+		item.Validity = sanitizeString(strings.Join(strings.Fields(findFirst(leafletSelectors.Validity, s).First().Text()), " "))
+		item.ValidFrom, item.ValidTo = parseValidity(item.Validity, scrapedAt.Format(SCRAPED_AT_DATE))
+		leaflets = append(leaflets, item)
+	})
+	return leaflets, nil
+}
+
+// extractLeafletPages - page image URLs of the leaflet page
+func extractLeafletPages(body []byte, leafletUrl *url.URL) ([]string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool)
+	pages := []string{}
+	doc.Find(leafletSelectors.PageImage).Each(func(i int, s *goquery.Selection) {
+		for _, attr := range leafletSelectors.ImageAttr {
+			src, ok := s.Attr(attr)
+			if !ok || src == "" {
+				continue
+			}
+			if image, err := leafletUrl.Parse(src); err == nil && !seen[image.String()] {
+				seen[image.String()] = true
+				pages = append(pages, image.String())
+			}
+			break
+		}
+	})
+	return pages, nil
+}
+
+// runLeaflets - scrape the leaflet listings of the chains into OUTPUT_LEAFLETS
+func runLeaflets(args []string) error {
+	flags := flag.NewFlagSet("leaflets", flag.ExitOnError)
+	chainList := flags.String("chains", "", "comma separated chains (default all chains of the chain mapping)")
+	output := flags.String("out", OUTPUT_LEAFLETS, "output file")
+	parseInterspersed(flags, args)
+
+	UA, err := setupRun()
+	if err != nil {
+		return err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+
+	chains := leafletChains()
+	if *chainList != "" {
+		chains = strings.Split(*chainList, ",")
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	out := leafletsOutput{Leaflets: []leaflet{}}
+	for _, chain := range chains {
+		chain = strings.TrimSpace(chain)
+		listingUrl, _ := url.Parse(KOOPI_LEAFLETS_URL + slugify(chain))
+		body, err := loadLeafletPage(ctx, UA, listingUrl.String())
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			log.Printf("💥 [%s] %v", chain, err)
+			continue
+		}
+		leaflets, err := extractLeaflets(body, chain, listingUrl, time.Now())
+		if err != nil {
+			return err
+		}
+		for i := range leaflets {
+			leafletUrl, _ := url.Parse(leaflets[i].Url)
+			leaflets[i].Pages = []string{}
+			pageBody, err := loadLeafletPage(ctx, UA, leaflets[i].Url)
+			if err != nil {
+				log.Printf("💥 [%s] %s: %v", chain, leaflets[i].Url, err)
+				continue
+			}
+			if leaflets[i].Pages, err = extractLeafletPages(pageBody, leafletUrl); err != nil {
+				return err
+			}
+		}
+		log.Printf("📰 %s: %d leaflets", chain, len(leaflets))
+		out.Leaflets = append(out.Leaflets, leaflets...)
+	}
+
+	out.Created = time.Now().Format(time.RFC3339)
+	out.Count = len(out.Leaflets)
+	content, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(*output, content); err != nil {
+		return err
+	}
+	log.Printf("📰 %d leaflets saved to %s", out.Count, *output)
+	return nil
+}
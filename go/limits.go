@@ -0,0 +1,74 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const MAX_BODY_SIZE = 5 << 20
+
+var (
+	errBodyTooLarge = errors.New("response body too large")
+	errContentType  = errors.New("unexpected content type")
+)
+
+// content types accepted for the pages
+var htmlContentTypes = []string{"text/html", "application/xhtml+xml"}
+
+// readLimitedBody - read the body, fail when it exceeds MaxBodySize (0 = unlimited)
+func readLimitedBody(res *http.Response) ([]byte, error) {
+	limit := int64(config.MaxBodySize)
+	if limit <= 0 {
+		return io.ReadAll(res.Body)
+	}
+	if res.ContentLength > limit {
+		return nil, fmt.Errorf("%w: %d bytes > %d", errBodyTooLarge, res.ContentLength, limit)
+	}
+	body, err := io.ReadAll(io.LimitReader(res.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(body)) > limit {
+		return nil, fmt.Errorf("%w: more than %d bytes", errBodyTooLarge, limit)
+	}
+	return body, nil
+}
+
+// checkContentType - the media type must match one of the prefixes
+func checkContentType(contentType string, prefixes ...string) error {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return fmt.Errorf("%w: %q", errContentType, contentType)
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(mediaType, prefix) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", errContentType, mediaType)
+}
+
+// readCheckedBody - check the declared content type before reading the limited body,
+// responses without one are sniffed
+func readCheckedBody(res *http.Response, prefixes ...string) ([]byte, error) {
+	contentType := res.Header.Get("Content-Type")
+	if contentType != "" {
+		if err := checkContentType(contentType, prefixes...); err != nil {
+			return nil, err
+		}
+	}
+	body, err := readLimitedBody(res)
+	if err != nil {
+		return nil, err
+	}
+	if contentType == "" {
+		if err := checkContentType(http.DetectContentType(body), prefixes...); err != nil {
+			return nil, err
+		}
+	}
+	return body, nil
+}
@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"math/rand"
+	"sync"
+)
+
+// per-query log groups
+var (
+	logGroupsMutex sync.Mutex
+	logGroups      = make(map[string]*logGroup)
+)
+
+// logGroup - buffered log lines of one query
+type logGroup struct {
+	pending int // pages not yet finished
+	buffer  bytes.Buffer
+}
+
+// queryLogger - logger tagging every line with the worker and query
+type queryLogger struct {
+	query  string
+	worker int
+	trace  string // fetch trace ID
+}
+
+// newQueryLogger - create a logger for the query processed by the worker
+func newQueryLogger(query string, worker int) *queryLogger {
+	return &queryLogger{query: query, worker: worker}
+}
+
+// newTraceId - short random ID to correlate log lines of one fetch
+func newTraceId() string {
+	return fmt.Sprintf("%06x", rand.Intn(1<<24))
+}
+
+// withTrace - copy of the logger tagging lines with the trace ID
+func (l *queryLogger) withTrace(trace string) *queryLogger {
+	if l == nil {
+		return nil
+	}
+	traced := *l
+	traced.trace = trace
+	return &traced
+}
+
+// expectLogGroup - register one more page of the query to wait for before flushing
+func expectLogGroup(query string) {
+	logGroupsMutex.Lock()
+	defer logGroupsMutex.Unlock()
+	group, ok := logGroups[query]
+	if !ok {
+		group = &logGroup{}
+		logGroups[query] = group
+	}
+	group.pending++
+}
+
+// prefix - line prefix with the worker, query and trace ID
+func (l *queryLogger) prefix() string {
+	if l.trace != "" {
+		return fmt.Sprintf("%s[w%d|%s|%s]%s ", ColorDim, l.worker, l.query, l.trace, ColorReset)
+	}
+	return fmt.Sprintf("%s[w%d|%s]%s ", ColorDim, l.worker, l.query, ColorReset)
+}
+
+// Printf - log a tagged line (buffered per query with --group-logs)
+func (l *queryLogger) Printf(format string, v ...any) {
+	if l == nil {
+		log.Printf(format, v...)
+		return
+	}
+	line := l.prefix() + fmt.Sprintf(format, v...)
+	if !*groupLogsFlag {
+		log.Print(line)
+		return
+	}
+	logGroupsMutex.Lock()
+	defer logGroupsMutex.Unlock()
+	if group, ok := logGroups[l.query]; ok {
+		group.buffer.WriteString(line + "\n")
+		return
+	}
+	log.Print(line)
+}
+
+// Done - mark one page of the query as finished, flush the group when it's complete
+func (l *queryLogger) Done() {
+	if l == nil || !*groupLogsFlag {
+		return
+	}
+	logGroupsMutex.Lock()
+	defer logGroupsMutex.Unlock()
+	group, ok := logGroups[l.query]
+	if !ok {
+		return
+	}
+	group.pending--
+	if group.pending <= 0 {
+		flushLogGroup(l.query, group)
+		delete(logGroups, l.query)
+	}
+}
+
+// flushLogGroup - write the buffered block of one query
+func flushLogGroup(query string, group *logGroup) {
+	if group.buffer.Len() == 0 {
+		return
+	}
+	fmt.Fprintf(log.Writer(), "%s── %s ──%s\n%s", ColorBold, query, ColorReset, group.buffer.String())
+}
+
+// flushAllLogGroups - flush unfinished groups (e.g. after Ctrl+C)
+func flushAllLogGroups() {
+	logGroupsMutex.Lock()
+	defer logGroupsMutex.Unlock()
+	for query, group := range logGroups {
+		flushLogGroup(query, group)
+		delete(logGroups, query)
+	}
+}
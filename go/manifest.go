@@ -0,0 +1,80 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const OUTPUT_IMAGES = "images.json"
+
+// manifestFile - cached image file in the images manifest
+type manifestFile struct {
+	Size   int64  `json:"size"`
+	Sha256 string `json:"sha256"`
+}
+
+// imagesManifest - content of the images manifest, products are keyed by the ID hash (see idhashmap)
+type imagesManifest struct {
+	Created  string                  `json:"created"`
+	Count    int                     `json:"count"` // all goods, for the keep-last-good check
+	Products map[string][]string     `json:"products"`
+	Files    map[string]manifestFile `json:"files"`
+}
+
+// fileSha256 - hash of the file content
+func fileSha256(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
+
+// writeImagesManifest - map the products to their cached images and variants with sizes and hashes
+func writeImagesManifest(snap *outputSnapshot, filename string) error {
+	manifest := imagesManifest{
+		Created:  time.Now().Format(time.RFC3339),
+		Count:    len(snap.Goods),
+		Products: make(map[string][]string),
+		Files:    make(map[string]manifestFile),
+	}
+	for _, item := range snap.Goods {
+		fileName := cachedImageFile(item.ImageUrl)
+		if item.ImageUrl == "" || fileName == "" {
+			continue
+		}
+		var names []string
+		for _, name := range append([]string{fileName}, imageVariants(fileName)...) {
+			if _, ok := manifest.Files[name]; !ok {
+				filePath := filepath.Join(config.ImageCache, name)
+				info, err := os.Stat(filePath)
+				if err != nil {
+					continue // variant not encoded
+				}
+				hash, err := fileSha256(filePath)
+				if err != nil {
+					return err
+				}
+				manifest.Files[name] = manifestFile{info.Size(), hash}
+			}
+			names = append(names, name)
+		}
+		manifest.Products[goodsHash(item)] = names
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, content)
+}
@@ -0,0 +1,125 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+)
+
+const (
+	MARKETS_FILE     = "markets.json" // chain metadata overriding the built-in one, see loadMarketInfo
+	MARKET_LOGO_PATH = "/markets-v2/" // logos of the front-end by the market label
+)
+
+// chain types
+const (
+	MARKET_SUPERMARKET = "supermarket"
+	MARKET_HYPERMARKET = "hypermarket"
+	MARKET_DISCOUNT    = "discount"
+	MARKET_ONLINE      = "online"
+	MARKET_WHOLESALE   = "wholesale"
+	MARKET_DRUGSTORE   = "drugstore"
+)
+
+// marketInfo - metadata of a chain, empty fields are derived
+type marketInfo struct {
+	Slug     string `json:"slug,omitempty"`
+	Logo     string `json:"logo,omitempty"` // default MARKET_LOGO_PATH + market label + .webp
+	Homepage string `json:"homepage,omitempty"`
+	Type     string `json:"type,omitempty"`
+}
+
+// built-in chain metadata
+var defaultMarketInfo = map[string]marketInfo{
+	"Albert":   {Homepage: "https://www.albert.cz", Type: MARKET_SUPERMARKET},
+	"Billa":    {Homepage: "https://www.billa.cz", Type: MARKET_SUPERMARKET},
+	"COOP":     {Homepage: "https://www.coop.cz", Type: MARKET_SUPERMARKET},
+	"Globus":   {Homepage: "https://www.globus.cz", Type: MARKET_HYPERMARKET},
+	"Kaufland": {Homepage: "https://www.kaufland.cz", Type: MARKET_HYPERMARKET},
+	"Košík":    {Homepage: "https://www.kosik.cz", Type: MARKET_ONLINE},
+	"Lidl":     {Homepage: "https://www.lidl.cz", Type: MARKET_DISCOUNT},
+	"Makro":    {Homepage: "https://www.makro.cz", Type: MARKET_WHOLESALE},
+	"Norma":    {Homepage: "https://www.norma-online.cz", Type: MARKET_DISCOUNT},
+	"Penny":    {Homepage: "https://www.penny.cz", Type: MARKET_DISCOUNT},
+	"Rossmann": {Homepage: "https://www.rossmann.cz", Type: MARKET_DRUGSTORE},
+	"Tesco":    {Homepage: "https://www.itesco.cz", Type: MARKET_HYPERMARKET},
+}
+
+// chain metadata, the built-in one with the data file applied
+var marketInfos = defaultMarketInfo
+
+// marketEntry - market of the JSON output, the label of the offers with the metadata of its chain
+type marketEntry struct {
+	Name  string `json:"name"` // market label of the offers
+	Chain string `json:"chain"`
+	Count int    `json:"count"` // offers of the market
+	marketInfo
+}
+
+// loadMarketInfo - apply the data file to the built-in metadata, {"Chain": {"slug", "logo", "homepage", "type"}}
+func loadMarketInfo(filename string) error {
+	infos := make(map[string]marketInfo)
+	for chain, info := range defaultMarketInfo {
+		infos[chain] = info
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	if err == nil {
+		var data map[string]json.RawMessage
+		if err := json.Unmarshal(content, &data); err != nil {
+			return fmt.Errorf("parsing %s: %w", filename, err)
+		}
+		for chain, raw := range data {
+			info := infos[chain]
+			if err := json.Unmarshal(raw, &info); err != nil {
+				return fmt.Errorf("[%s] %s: %w", filename, chain, err)
+			}
+			infos[chain] = info
+		}
+	}
+	marketInfos = infos
+	return nil
+}
+
+// marketEntries - the markets in the snapshot order with their chain metadata
+func marketEntries(snap *outputSnapshot) []marketEntry {
+	counts := make(map[string]int)
+	chains := make(map[string]string)
+	for _, item := range snap.Goods {
+		counts[item.Market]++
+		chains[item.Market] = item.Chain
+	}
+	entries := make([]marketEntry, 0, len(snap.Markets))
+	for _, market := range snap.Markets {
+		chain := chains[market]
+		if chain == "" {
+			chain = marketChain(market)
+		}
+		info := marketInfos[chain]
+		if info.Slug == "" {
+			info.Slug = slugify(chain)
+		}
+		if info.Logo == "" {
+			info.Logo = MARKET_LOGO_PATH + market + ".webp"
+		}
+		entries = append(entries, marketEntry{market, chain, counts[market], info})
+	}
+	return entries
+}
+
+// slugify - lowercase ASCII words joined by hyphens
+func slugify(s string) string {
+	var b strings.Builder
+	for _, r := range removeDiacritics(strings.ToLower(s)) {
+		switch {
+		case 'a' <= r && r <= 'z' || '0' <= r && r <= '9':
+			b.WriteRune(r)
+		case b.Len() > 0 && !strings.HasSuffix(b.String(), "-"):
+			b.WriteByte('-')
+		}
+	}
+	return strings.TrimSuffix(b.String(), "-")
+}
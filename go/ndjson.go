@@ -0,0 +1,33 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"os"
+)
+
+// newline-delimited JSON output, one offer per line, see config.OutputNdjson
+const OUTPUT_NDJSON = "koopi.ndjson"
+
+// appendToNdjson - save the offers of the flat layout to the NDJSON file, streamable by jq, ClickHouse or BigQuery
+func appendToNdjson(snap *outputSnapshot, filename string) error {
+	items, _ := outputItems(snap.Goods)
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w) // Encode terminates each value with a newline
+	for _, item := range items {
+		if err := encoder.Encode(item); err != nil {
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/text/collate"
+)
+
+const (
+	IMAGE_THUMBS_URL   = KOOPI_IMAGE_URL + "/kupi/thumbs/"
+	IMAGE_NO_IMAGE_URL = KOOPI_IMAGE_URL + "/img/no_img/no_discounts.png"
+)
+
+// outputSnapshot - final goods shared read-only by all output writers
+type outputSnapshot struct {
+	Goods   []Goods  // sorted by name
+	Markets []string // sorted, case insensitive
+}
+
+// outputWriter - one enabled output format
+type outputWriter struct {
+	name     string
+	filename string
+	write    func(snap *outputSnapshot, filename string) error
+	database bool // filename is a table, not a file
+}
+
+// newOutputSnapshot - sort the goods and markets once for all writers
+func newOutputSnapshot(goods []Goods, markets []string) *outputSnapshot {
+	c := newCollator()
+	sort.Slice(goods, func(i, j int) bool {
+		return c.CompareString(goods[i].Name, goods[j].Name) < 0
+	})
+	cExport := newCollator(collate.IgnoreCase)
+	sort.Slice(markets, func(i, j int) bool {
+		return cExport.CompareString(markets[i], markets[j]) < 0
+	})
+	return &outputSnapshot{Goods: goods, Markets: markets}
+}
+
+// enabledOutputs - writers for all outputs with a configured filename
+func enabledOutputs() []outputWriter {
+	var writers []outputWriter
+	if config.OutputCsv != "" {
+		writers = append(writers, outputWriter{"CSV", config.OutputCsv, appendToCsv, false})
+	}
+	if config.OutputJson != "" {
+		writers = append(writers, outputWriter{"JSON", config.OutputJson, appendToJson, false})
+		if config.OutputSchema != "" {
+			writers = append(writers, outputWriter{"schema", config.OutputSchema, writeOutputSchema, false})
+		}
+	}
+	if config.OutputNdjson != "" {
+		writers = append(writers, outputWriter{"NDJSON", config.OutputNdjson, appendToNdjson, false})
+	}
+	if config.OutputXml != "" {
+		writers = append(writers, outputWriter{"XML", config.OutputXml, appendToXml, false})
+	}
+	if config.PostgresDsn != "" {
+		writers = append(writers, outputWriter{"Postgres", config.PostgresTable, writePostgres, true})
+	}
+	if config.OutputImages != "" {
+		writers = append(writers, outputWriter{"images", config.OutputImages, writeImagesManifest, false})
+	}
+	return writers
+}
+
+// writeOutputs - run all writers concurrently, aggregate their errors
+func writeOutputs(snap *outputSnapshot, writers []outputWriter) error {
+	var wg sync.WaitGroup
+	errs := make([]error, len(writers))
+	for i, w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer stats.stageDone("output "+w.name, time.Now())
+			if err := w.write(snap, w.filename); err != nil {
+				errs[i] = fmt.Errorf("%s [%s]: %w", w.name, w.filename, err)
+			}
+		}()
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// trimUrl - product URL relative to the home page
+func trimUrl(url string) string {
+	return strings.TrimPrefix(url, KOOPI_HOME_URL)
+}
+
+// trimImageUrl - image URL relative to the thumbnails, empty for no image
+func trimImageUrl(imageUrl string) string {
+	imageUrl = strings.TrimPrefix(imageUrl, IMAGE_THUMBS_URL)
+	return strings.TrimPrefix(imageUrl, IMAGE_NO_IMAGE_URL)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestPreviousOutputCount(t *testing.T) {
+	dir := t.TempDir()
+	tests := []struct {
+		name    string
+		content string
+		count   int
+	}{
+		{"koopi.json", `{"count": 3, "goods": []}`, 3},
+		{"koopi.csv", "Name;Price\n\"a\";1\n\"b\";2\n", 2},
+		{"koopi.ndjson", "{\"name\":\"a \\\"quoted\\\"\"}\n{\"name\":\"b\"}\n\n", 2},
+		{"koopi.xml", "<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<offers version=\"2\" count=\"4\">\n</offers>\n", 4},
+		{"nocount.xml", "<offers></offers>", 0},
+		{"missing.ndjson", "", 0},
+	}
+	for _, tt := range tests {
+		filename := filepath.Join(dir, tt.name)
+		if tt.content != "" {
+			if err := os.WriteFile(filename, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if count := previousOutputCount(filename); count != tt.count {
+			t.Errorf("%s: got %d, want %d", tt.name, count, tt.count)
+		}
+	}
+}
+
+func TestKeepLastGoodCount(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.KeepLastGoodPercent = 50
+	tests := []struct {
+		previous, count int
+		keep            bool
+	}{
+		{0, 0, true}, // no previous output
+		{100, 50, true},
+		{100, 49, false},
+		{100, 200, true},
+	}
+	for _, tt := range tests {
+		if keep := keepLastGoodCount("koopi_offers", tt.previous, tt.count); keep != tt.keep {
+			t.Errorf("previous %d, count %d: got %v, want %v", tt.previous, tt.count, keep, tt.keep)
+		}
+	}
+
+	// the table name is not a file, Postgres checks the row count within its transaction
+	config.PostgresDsn, config.PostgresTable = "postgres://localhost/koopi", POSTGRES_TABLE
+	for _, w := range enabledOutputs() {
+		if w.database != (w.name == "Postgres") {
+			t.Errorf("%s: database = %v", w.name, w.database)
+		}
+	}
+}
+
+func TestOutputItemsRawPrices(t *testing.T) {
+	item := Goods{Name: "Pivo", Price: "1 299,90 Kč", PricePerUnit: "12.99 Kč / 1 l", Volume: "100 l", DiscountPercent: -1}
+	setVolumeValues(&item)
+	setPriceValues(&item)
+	items, _ := outputItems([]Goods{item})
+	if items[0].PriceRaw != item.Price || items[0].PricePerUnitRaw != item.PricePerUnit {
+		t.Errorf("raw texts %q %q, want the scraped %q %q", items[0].PriceRaw, items[0].PricePerUnitRaw, item.Price, item.PricePerUnit)
+	}
+	if items[0].Price == nil || *items[0].Price != 1299.9 {
+		t.Errorf("price = %v, want 1299.9", items[0].Price)
+	}
+}
+
+func TestFinishRunKeptSavesFailedJobs(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	t.Chdir(t.TempDir())
+	config.StateDir = "state"
+	config.OutputCsv, config.OutputNdjson, config.OutputXml, config.PostgresDsn, config.OutputImages = "", "", "", "", ""
+	config.OutputJson, config.OutputSchema = "koopi.json", ""
+	os.WriteFile(config.OutputJson, []byte(`{"count": 100}`), 0644)
+
+	defer func() { failedJobs = nil }()
+	recordFailedJob(scrapeJob{url: KOOPI_SEARCH_URL + "pivo", query: "pivo"}, errors.New("timeout"), 3)
+	goods := []Goods{{Name: "Pivo", Price: "19,90 Kč", Volume: "0,5 l", ScrapedAt: time.Now().Format("20060102"), DiscountPercent: -1}}
+	if err := finishRun(goods, nil); !errors.Is(err, errOutputsKept) {
+		t.Fatalf("finishRun = %v, want the outputs kept", err)
+	}
+	for _, filename := range []string{"state/" + FAILED_URLS_FILE, "state/" + STATS_FILE} {
+		if _, err := os.Stat(filename); err != nil {
+			t.Errorf("%s not saved: %v", filename, err)
+		}
+	}
+}
+
+func TestNewOutputCount(t *testing.T) {
+	for filename, want := range map[string]int{"koopi.csv": 10, "koopi.json": 7, "koopi.ndjson": 7, "feed.xml": 7} {
+		if count := newOutputCount(filename, 10, 7); count != want {
+			t.Errorf("%s: %d, want %d", filename, count, want)
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+)
+
+// packaging of the goods, SubCat keeps the old "lahev" / "plech" values
+const (
+	PACKAGING_CAN    = "plech"
+	PACKAGING_PET    = "pet"
+	PACKAGING_GLASS  = "sklo"
+	PACKAGING_BOTTLE = "lahev" // bottle of unknown material
+)
+
+// packagingRules - matched against the lowercase name and note, the first matching rule wins
+var packagingRules = []struct {
+	re        *regexp.Regexp
+	packaging string
+}{
+	{regexp.MustCompile(`(?:^|\PL)plech`), PACKAGING_CAN},
+	{regexp.MustCompile(`(?:^|\PL)pet(?:\PL|$)`), PACKAGING_PET},
+	{regexp.MustCompile(`(?:^|\PL)(?:sklo|skleněn)`), PACKAGING_GLASS},
+	{regexp.MustCompile(`(?:^|\PL)(?:lahev|láhev|lahv|láhv)`), PACKAGING_BOTTLE},
+}
+
+// returnable bottle, e.g. "zálohovaná lahev", "+3 Kč záloha na láhev"
+var reDeposit = regexp.MustCompile(`(?:^|\PL)(?:záloh|vratn)`)
+
+// setPackaging - packaging and deposit fields from the name and the note
+func setPackaging(item *Goods) {
+	text := strings.ToLower(item.Name + " " + item.Note)
+	item.Packaging = ""
+	for _, rule := range packagingRules {
+		if rule.re.MatchString(text) {
+			item.Packaging = rule.packaging
+			break
+		}
+	}
+	item.DepositBottle = item.Packaging != PACKAGING_CAN && reDeposit.MatchString(text)
+	if item.DepositBottle && item.Packaging == "" {
+		item.Packaging = PACKAGING_BOTTLE
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import "testing"
+
+func TestSetPackaging(t *testing.T) {
+	tests := []struct {
+		name, note string
+		packaging  string
+		deposit    bool
+	}{
+		{"Pivo Plzeň plech", "", PACKAGING_CAN, false},
+		{"Pivo Plzeň plechovka", "záloha 3 Kč", PACKAGING_CAN, false}, // cans are not returnable
+		{"Coca-Cola PET", "", PACKAGING_PET, false},
+		{"Kečup sklo", "", PACKAGING_GLASS, false},
+		{"Víno", "skleněná lahev", PACKAGING_GLASS, false}, // the first rule wins
+		{"Pivo Plzeň", "zálohovaná láhev", PACKAGING_BOTTLE, true},
+		{"Pivo Plzeň", "+3 Kč záloha", PACKAGING_BOTTLE, true}, // a returnable bottle of unknown material
+		{"Minerálka", "vratná lahev", PACKAGING_BOTTLE, true},
+		{"Petržel", "", "", false},
+		{"Máslo", "", "", false},
+	}
+	for _, tt := range tests {
+		item := Goods{Name: tt.name, Note: tt.note, Packaging: "x", DepositBottle: true}
+		setPackaging(&item)
+		if item.Packaging != tt.packaging || item.DepositBottle != tt.deposit {
+			t.Errorf("%q %q: got %q deposit=%v, want %q deposit=%v", tt.name, tt.note, item.Packaging, item.DepositBottle, tt.packaging, tt.deposit)
+		}
+	}
+}
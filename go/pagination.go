@@ -0,0 +1,124 @@
+package main
+
+import (
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"sync"
+)
+
+// PAGES column value of the automatic pagination
+const PAGES_AUTO = "auto"
+
+// safety caps of the automatically paginated listings, the shop listings are longer
+const (
+	AUTO_PAGES_MAX = 20
+	SHOP_PAGES_MAX = 60
+)
+
+// QUERY column prefix of the shop discount listings, e.g. "shop:Lidl"
+const SHOP_QUERY_PREFIX = "shop:"
+
+// page links of the pagination element, e.g. "/hledej?f=pivo&amp;page=3"
+var rePageLink = regexp.MustCompile(`[?&;]page=(\d+)`)
+
+// pageResult - outcome of a scraped page
+type pageResult struct {
+	ok       bool // extracted, false for failed or skipped pages
+	items    int
+	lastPage int // highest page of the pagination element, 0 = none
+}
+
+// lastPageLink - highest page number linked from the page
+func lastPageLink(body []byte) int {
+	last := 0
+	for _, m := range rePageLink.FindAllSubmatch(body, -1) {
+		if n, err := strconv.Atoi(string(m[1])); err == nil && n > last {
+			last = n
+		}
+	}
+	return last
+}
+
+// listingPager - per-listing coordination of the workers, keyed by the first page URL
+type listingPager struct {
+	mutex  sync.Mutex
+	queued map[string]int // highest queued page of the automatically paginated listings
+	empty  map[string]int // lowest page without offers, the pages after it are skipped
+}
+
+// newListingPager - pager of the initial jobs
+func newListingPager(jobs []scrapeJob) *listingPager {
+	p := &listingPager{queued: make(map[string]int), empty: make(map[string]int)}
+	for _, job := range jobs {
+		if job.autoPages {
+			p.queued[job.firstUrl] = max(p.queued[job.firstUrl], job.page)
+		}
+	}
+	return p
+}
+
+// next - the following pages of the listing: up to the last page of the pagination element,
+// without the element the next page as long as the pages have offers
+func (p *listingPager) next(job scrapeJob, result pageResult) []scrapeJob {
+	p.done(job, result)
+	if !job.autoPages || !result.ok || result.items == 0 {
+		return nil
+	}
+	last := result.lastPage
+	if last == 0 && result.items > 0 {
+		last = job.page + 1
+	}
+
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	pageCap := job.pageCap
+	if pageCap == 0 {
+		pageCap = config.AutoPagesMax
+	}
+	if last > pageCap {
+		if p.queued[job.firstUrl] < pageCap {
+			log.Printf("📑 [%s] more than %d pages, capped", job.query, pageCap)
+		}
+		last = pageCap
+	}
+	var jobs []scrapeJob
+	for pageNum := p.queued[job.firstUrl] + 1; pageNum <= last; pageNum++ {
+		jobs = append(jobs, listingPageJob(job, pageNum))
+	}
+	p.queued[job.firstUrl] = max(p.queued[job.firstUrl], last)
+	return jobs
+}
+
+// done - record an empty page of the listing
+func (p *listingPager) done(job scrapeJob, result pageResult) {
+	if !config.StopOnEmpty || job.firstUrl == "" || !result.ok || result.items > 0 {
+		return
+	}
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	if empty, ok := p.empty[job.firstUrl]; !ok || job.page < empty {
+		p.empty[job.firstUrl] = job.page
+	}
+}
+
+// skip - check if the page follows an empty page of the listing
+func (p *listingPager) skip(job scrapeJob) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	empty, ok := p.empty[job.firstUrl]
+	return ok && job.firstUrl != "" && job.page > empty
+}
+
+// listingPageJob - job of another page of the listing
+func listingPageJob(job scrapeJob, pageNum int) scrapeJob {
+	firstUrl, _ := url.Parse(job.firstUrl)
+	urlStr := listingPageUrl(*firstUrl, pageNum)
+	label := job.query
+	if term := firstUrl.Query().Get("f"); term != "" {
+		label = term // synonym of the query, see queryTerms
+	}
+	return scrapeJob{url: urlStr, cacheKey: cacheKeyFor(label, pageNum, urlStr), category: job.category, query: job.query,
+		page: pageNum, autoPages: true, firstUrl: job.firstUrl, pageCap: job.pageCap}
+}
@@ -0,0 +1,238 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"slices"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// streamNode - open element on the tokenizer stack
+type streamNode struct {
+	tag     string
+	classes []string
+}
+
+// streamSelector - one part of a descendant selector (tag and/or class)
+type streamSelector struct {
+	tag   string
+	class string
+}
+
+// elements without end tags
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true, "hr": true, "img": true,
+	"input": true, "link": true, "meta": true, "param": true, "source": true, "track": true, "wbr": true,
+}
+
+// selectors used by the stream parser (see extractGoodsFromHtml)
+var (
+	streamGroupName  = []streamSelector{{"div", "product_name"}, {"h2", ""}, {"a", ""}}
+	streamGroupImage = []streamSelector{{"div", "product_image"}, {"a", ""}, {"img", ""}}
+	streamMarket     = []streamSelector{{"", "discounts_shop_name"}, {"a", ""}, {"span", ""}}
+
+	streamHiddenOffer     = "discount_row_hidden"
+	streamHiddenOfferMore = []streamSelector{{"", "discounts_more"}, {"", "discount_row_more"}}
+)
+
+// isOfferRow - offer row, collapsed rows only with --hidden-offers
+func isOfferRow(node streamNode, inGroup []streamNode) bool {
+	if node.hasClass("discount_row") {
+		return true
+	}
+	if !*hiddenOffersFlag {
+		return false
+	}
+	return node.hasClass(streamHiddenOffer) || matchElement(append(inGroup[:len(inGroup):len(inGroup)], node), streamHiddenOfferMore)
+}
+
+// matches - check if the node matches the selector part
+func (n streamNode) matches(sel streamSelector) bool {
+	if sel.tag != "" && n.tag != sel.tag {
+		return false
+	}
+	return sel.class == "" || n.hasClass(sel.class)
+}
+
+// hasClass - check if the node has the class
+func (n streamNode) hasClass(class string) bool {
+	for _, c := range n.classes {
+		if c == class {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPath - check if the nodes contain the descendant selector (in order)
+func matchPath(nodes []streamNode, path []streamSelector) bool {
+	i := 0
+	for _, node := range nodes {
+		if i < len(path) && node.matches(path[i]) {
+			i++
+		}
+	}
+	return i == len(path)
+}
+
+// matchElement - check if the last node is the selector target and its ancestors match the rest
+func matchElement(nodes []streamNode, path []streamSelector) bool {
+	if len(nodes) == 0 || !nodes[len(nodes)-1].matches(path[len(path)-1]) {
+		return false
+	}
+	return matchPath(nodes[:len(nodes)-1], path[:len(path)-1])
+}
+
+// extractGoodsFromHtmlStream - extract data from HTML using the streaming tokenizer
+func extractGoodsFromHtmlStream(body []byte, category string, query string, scrapedAt string) ([]Goods, error) {
+	var goods []Goods
+	var stack []streamNode
+
+	groupDepth, offerDepth := -1, -1
+	groupActive := false
+	var group productGroup
+	var hrefSeen, imageSeen bool
+	var offers []rawOffer
+	var offer rawOffer
+
+	// offer fields by class
+	offerFields := []struct {
+		class  string
+		target *string
+	}{
+		{"discount_price_value", &offer.Price},
+		{"price_per_unit", &offer.PricePerUnit},
+		{"discount_percentage", &offer.Discount},
+		{"discount_amount", &offer.Volume},
+		{"discount_note", &offer.Note},
+		{"discounts_club", &offer.Club},
+		{"discounts_validity", &offer.Validity},
+		{"discount_price_original", &offer.OriginalPrice},
+		{"discount_price_before", &offer.OriginalPrice},
+	}
+
+	// finish the element(s) closed by popping the stack
+	closeElements := func() {
+		if offerDepth >= 0 && len(stack) <= offerDepth {
+			offers = append(offers, offer)
+			offerDepth = -1
+		}
+		if groupDepth >= 0 && len(stack) <= groupDepth {
+			if groupActive && prepareGroup(&group) {
+				for _, o := range offers {
+					if newGoods, ok := newGoodsFromOffer(group, o, category, query, scrapedAt); ok {
+						goods = append(goods, newGoods)
+					}
+				}
+			}
+			groupDepth = -1
+		}
+	}
+
+	z := html.NewTokenizer(bytes.NewReader(body))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			stack = stack[:0]
+			closeElements()
+			return goods, nil
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			tagName, hasAttr := z.TagName()
+			node := streamNode{tag: string(tagName)}
+			var href, dataSrc, ean, productCode string
+			for hasAttr {
+				var key, val []byte
+				key, val, hasAttr = z.TagAttr()
+				switch string(key) {
+				case "class":
+					node.classes = strings.Fields(string(val))
+				case "href":
+					href = string(val)
+				case "data-src":
+					dataSrc = string(val)
+				}
+				if slices.Contains(eanAttrs, string(key)) {
+					ean = string(val)
+				} else if slices.Contains(productCodeAttrs, string(key)) {
+					productCode = string(val)
+				}
+			}
+
+			switch {
+			case groupDepth < 0 && node.tag == "div" && node.hasClass("group_discounts"):
+				groupDepth = len(stack)
+				groupActive = !node.hasClass("notactive")
+				group = productGroup{}
+				hrefSeen, imageSeen = false, false
+				offers = nil
+			case groupDepth >= 0 && offerDepth < 0 && isOfferRow(node, stack[groupDepth+1:]):
+				offerDepth = len(stack)
+				offer = rawOffer{}
+			}
+
+			if groupDepth >= 0 && len(stack) > groupDepth {
+				path := append(stack[groupDepth+1:len(stack):len(stack)], node)
+				if !hrefSeen && matchElement(path, streamGroupName) {
+					group.Url, hrefSeen = href, true
+				}
+				if !imageSeen && matchElement(path, streamGroupImage) {
+					group.ImageUrl, imageSeen = dataSrc, true
+				}
+			}
+			if groupDepth >= 0 && group.Ean == "" {
+				group.Ean = ean
+			}
+			if groupDepth >= 0 && group.ProductCode == "" {
+				group.ProductCode = productCode
+			}
+
+			if tt == html.StartTagToken && !voidElements[node.tag] {
+				stack = append(stack, node)
+			} else if groupDepth == len(stack) || offerDepth == len(stack) {
+				closeElements() // self-closed group or offer
+			}
+
+		case html.EndTagToken:
+			tagName, _ := z.TagName()
+			for i := len(stack) - 1; i >= 0; i-- {
+				if stack[i].tag == string(tagName) {
+					stack = stack[:i]
+					closeElements()
+					break
+				}
+			}
+
+		case html.TextToken:
+			if groupDepth < 0 || len(stack) <= groupDepth+1 {
+				continue
+			}
+			text := string(z.Text())
+			inGroup := stack[groupDepth+1:]
+			if matchPath(inGroup, streamGroupName) {
+				group.Name += text
+			}
+			if offerDepth < 0 || len(stack) <= offerDepth+1 {
+				continue
+			}
+			inOffer := stack[offerDepth+1:]
+			for _, field := range offerFields {
+				for _, node := range inOffer {
+					if node.hasClass(field.class) {
+						*field.target += text
+						break
+					}
+				}
+			}
+			if matchPath(inOffer, streamMarket) {
+				offer.Market += text
+			}
+		}
+	}
+}
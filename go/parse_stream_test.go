@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// fixturePages - cached listing pages of the demo
+func fixturePages(tb testing.TB) map[string][]byte {
+	tb.Helper()
+	files, err := filepath.Glob(filepath.Join("demo", "cache", "*.html"))
+	if err != nil || len(files) == 0 {
+		tb.Fatalf("no demo pages: %v", err)
+	}
+	pages := make(map[string][]byte)
+	for _, file := range files {
+		content, err := os.ReadFile(file)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		pages[filepath.Base(file)] = content
+	}
+	return pages
+}
+
+func TestStreamParserParity(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+	config.StructuredData = false
+
+	for name, body := range fixturePages(t) {
+		config.Parser = PARSER_GOQUERY
+		want, err := extractGoods(body, LAYOUT_DESKTOP, "NÁPOJE", "pivo", "20261017")
+		if err != nil {
+			t.Fatal(err)
+		}
+		config.Parser = PARSER_STREAM
+		got, err := extractGoods(body, LAYOUT_DESKTOP, "NÁPOJE", "pivo", "20261017")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(want) == 0 {
+			t.Errorf("%s: no goods", name)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%s: the stream parser differs from goquery\ngot  %+v\nwant %+v", name, got, want)
+		}
+	}
+}
+
+func BenchmarkExtractGoods(b *testing.B) {
+	saved := config
+	defer func() { config = saved }()
+	config.StructuredData = false
+	pages := fixturePages(b)
+
+	for _, parser := range []string{PARSER_GOQUERY, PARSER_STREAM} {
+		b.Run(parser, func(b *testing.B) {
+			config.Parser = parser
+			b.ReportAllocs()
+			for b.Loop() {
+				for _, body := range pages {
+					extractGoods(body, LAYOUT_DESKTOP, "NÁPOJE", "pivo", "20261017")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// note of the placeholder row of a pinned product without offers
+const PINNED_NO_OFFER = "no current offer"
+
+// PinnedProduct - staple that always appears in the outputs, e.g.
+// {"name": "Máslo", "match": ["maslo 250"], "category": "MLÉČNÉ"}
+type PinnedProduct struct {
+	Name     string   `json:"name"`
+	Match    []string `json:"match"`    // keywords matched against offer names, default the name
+	Category string   `json:"category"` // category of the placeholder row
+
+	keywords []string
+}
+
+// preparePinnedProducts - validate the pins and normalize their keywords
+func preparePinnedProducts(pins []PinnedProduct) error {
+	seen := make(map[string]bool)
+	for i := range pins {
+		pin := &pins[i]
+		pin.Name = strings.TrimSpace(pin.Name)
+		if pin.Name == "" {
+			return fmt.Errorf("pinned product #%d: missing name", i+1)
+		}
+		if seen[pin.Name] {
+			return fmt.Errorf("pinned product %q: duplicate name", pin.Name)
+		}
+		seen[pin.Name] = true
+		match := pin.Match
+		if len(match) == 0 {
+			match = []string{pin.Name}
+		}
+		pin.keywords = nil
+		for _, keyword := range match {
+			if keyword = normalizeCzechString(keyword); keyword != "" {
+				pin.keywords = append(pin.keywords, keyword)
+			}
+		}
+		if len(pin.keywords) == 0 {
+			return fmt.Errorf("pinned product %q: empty match", pin.Name)
+		}
+	}
+	return nil
+}
+
+// matches - check if any keyword is in the normalized offer name
+func (pin PinnedProduct) matches(normalizedName string) bool {
+	padded := " " + normalizedName + " "
+	for _, keyword := range pin.keywords {
+		if strings.Contains(padded, " "+keyword+" ") {
+			return true
+		}
+	}
+	return false
+}
+
+// isPinPlaceholder - row added for a pinned product without offers
+func isPinPlaceholder(item Goods) bool {
+	return item.Pinned != "" && item.Price == ""
+}
+
+// applyPinnedProducts - tag offers of the pinned products, add placeholder rows for pins without offers
+func applyPinnedProducts(goods []Goods, pins []PinnedProduct) []Goods {
+	if len(pins) == 0 {
+		return goods
+	}
+
+	// placeholders of previous runs (merged outputs)
+	kept := goods[:0]
+	for _, item := range goods {
+		if !isPinPlaceholder(item) {
+			kept = append(kept, item)
+		}
+	}
+	goods = kept
+
+	found := make(map[string]bool)
+	for i := range goods {
+		goods[i].Pinned = ""
+		name := normalizeCzechString(goods[i].Name)
+		for _, pin := range pins {
+			if pin.matches(name) {
+				goods[i].Pinned = pin.Name
+				found[pin.Name] = true
+				break
+			}
+		}
+	}
+
+	today := time.Now().Format("20060102")
+	for _, pin := range pins {
+		if found[pin.Name] {
+			continue
+		}
+		goods = append(goods, Goods{
+			Name:      pin.Name,
+			Category:  pin.Category,
+			Note:      PINNED_NO_OFFER,
+			ImageUrl:  IMAGE_NO_IMAGE_URL,
+			ScrapedAt: today,
+			Pinned:    pin.Name,
+		})
+	}
+	return goods
+}
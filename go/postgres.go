@@ -0,0 +1,198 @@
+package main
+
+import (
+	"context"
+	"crypto/md5"
+	"database/sql"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	POSTGRES_TABLE      = "koopi_offers"
+	POSTGRES_BATCH      = 500   // rows per INSERT, 30 parameters each
+	POSTGRES_MAX_PARAMS = 65535 // parameters of one statement
+	POSTGRES_TIMEOUT    = 5 * time.Minute
+)
+
+// table name, optionally schema-qualified, used unquoted in the statements
+var rePostgresTable = regexp.MustCompile(`^[a-z_][a-z0-9_]*(\.[a-z_][a-z0-9_]*)?$`)
+
+// postgresColumn - column of the offers table with its value
+type postgresColumn struct {
+	name  string
+	ddl   string
+	value func(item Goods) any
+}
+
+// columns of the offers table, offer_key is the primary key
+var postgresColumns = []postgresColumn{
+	{"offer_key", "text PRIMARY KEY", func(item Goods) any { return offerKey(item) }},
+	{"product_id", "text NOT NULL", func(item Goods) any { return goodsHash(item) }},
+	{"name", "text NOT NULL", func(item Goods) any { return item.Name }},
+	{"brand", "text NOT NULL", func(item Goods) any { return item.Brand }},
+	{"category", "text NOT NULL", func(item Goods) any { return item.Category }},
+	{"subcat", "text NOT NULL", func(item Goods) any { return item.SubCat }},
+	{"query", "text NOT NULL", func(item Goods) any { return item.Query }},
+	{"volume", "text NOT NULL", func(item Goods) any { return item.Volume }},
+	{"quantity", "double precision", func(item Goods) any { return optionalNumber(item.Quantity) }},
+	{"unit", "text NOT NULL", func(item Goods) any { return item.Unit }},
+	{"price", "double precision", func(item Goods) any { return optionalNumber(item.PriceValue) }},
+	{"price_raw", "text NOT NULL", func(item Goods) any { return item.Price }},
+	{"price_per_unit", "double precision", func(item Goods) any { return optionalNumber(item.PricePerUnitValue) }},
+	{"currency", "text NOT NULL", func(item Goods) any { return item.Currency }},
+	{"discount_percent", "integer", func(item Goods) any {
+		if item.DiscountPercent < 0 {
+			return nil
+		}
+		return item.DiscountPercent
+	}},
+	{"original_price", "double precision", func(item Goods) any { return optionalNumber(item.OriginalPrice) }},
+	{"note", "text NOT NULL", func(item Goods) any { return item.Note }},
+	{"club", "text NOT NULL", func(item Goods) any { return item.Club }},
+	{"club_required", "boolean NOT NULL", func(item Goods) any { return item.ClubRequired }},
+	{"market", "text NOT NULL", func(item Goods) any { return item.Market }},
+	{"chain", "text NOT NULL", func(item Goods) any { return item.Chain }},
+	{"validity", "text NOT NULL", func(item Goods) any { return item.Validity }},
+	{"valid_from", "date", func(item Goods) any { return optionalString(item.ValidFrom) }},
+	{"valid_to", "date", func(item Goods) any { return optionalString(item.ValidTo) }},
+	{"url", "text NOT NULL", func(item Goods) any { return item.Url }},
+	{"image_url", "text NOT NULL", func(item Goods) any { return trimImageUrl(item.ImageUrl) }},
+	{"ean", "text", func(item Goods) any { return optionalString(item.Ean) }},
+	{"product_code", "text", func(item Goods) any { return optionalString(item.ProductCode) }},
+	{"scraped_at", "text NOT NULL", func(item Goods) any { return item.ScrapedAt }},
+}
+
+// offerKey - unique offer hash of the deduplication fields, the upsert key
+func offerKey(item Goods) string {
+	hash := md5.Sum([]byte(item.Name + item.Price + item.PricePerUnit + normalizeCzechString(item.Note) +
+		item.Club + item.Volume + item.Market + item.Validity))
+	return hex.EncodeToString(hash[:])
+}
+
+// optionalString - nullable column value, nil for ""
+func optionalString(s string) any {
+	if s == "" {
+		return nil
+	}
+	return s
+}
+
+// postgresSchema - statements creating the offers table if missing
+func postgresSchema(table string) []string {
+	var columns []string
+	for _, column := range postgresColumns {
+		columns = append(columns, column.name+" "+column.ddl)
+	}
+	columns = append(columns, "seen_at timestamptz NOT NULL")
+	index := strings.ReplaceAll(table, ".", "_")
+	return []string{
+		fmt.Sprintf("CREATE TABLE IF NOT EXISTS %s (\n\t%s\n)", table, strings.Join(columns, ",\n\t")),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_product_id_idx ON %s (product_id)", index, table),
+		fmt.Sprintf("CREATE INDEX IF NOT EXISTS %s_seen_at_idx ON %s (seen_at)", index, table),
+	}
+}
+
+// postgresUpsert - INSERT of rows offers, existing offers get the new values
+func postgresUpsert(table string, rows int) string {
+	var names, updates []string
+	for _, column := range postgresColumns {
+		names = append(names, column.name)
+		if column.name != "offer_key" {
+			updates = append(updates, column.name+" = EXCLUDED."+column.name)
+		}
+	}
+	names = append(names, "seen_at")
+	updates = append(updates, "seen_at = EXCLUDED.seen_at")
+
+	var values []string
+	n := 1
+	for range rows {
+		placeholders := make([]string, len(names))
+		for i := range placeholders {
+			placeholders[i] = fmt.Sprintf("$%d", n)
+			n++
+		}
+		values = append(values, "("+strings.Join(placeholders, ", ")+")")
+	}
+	return fmt.Sprintf("INSERT INTO %s (%s) VALUES %s ON CONFLICT (offer_key) DO UPDATE SET %s",
+		table, strings.Join(names, ", "), strings.Join(values, ", "), strings.Join(updates, ", "))
+}
+
+// writePostgres - upsert the offers into the table in one transaction, offers missing in the run are pruned
+func writePostgres(snap *outputSnapshot, table string) error {
+	ctx, cancel := context.WithTimeout(context.Background(), POSTGRES_TIMEOUT)
+	defer cancel()
+
+	db, err := sql.Open("postgres", config.PostgresDsn)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback() // no-op after the commit
+
+	for _, statement := range postgresSchema(table) {
+		if _, err := tx.ExecContext(ctx, statement); err != nil {
+			return fmt.Errorf("creating the schema: %w", err)
+		}
+	}
+
+	// one row per key, an upsert cannot update the same row twice
+	seenAt := time.Now()
+	var goods []Goods
+	seen := make(map[string]bool)
+	for _, item := range snap.Goods {
+		if key := offerKey(item); !seen[key] {
+			seen[key] = true
+			goods = append(goods, item)
+		}
+	}
+	// keep-last-good protection, the rows of the previous run are replaced by pruning only
+	if config.PostgresPrune {
+		var previous int
+		if err := tx.QueryRowContext(ctx, fmt.Sprintf("SELECT count(*) FROM %s", table)).Scan(&previous); err != nil {
+			return fmt.Errorf("counting offers: %w", err)
+		}
+		if !keepLastGoodCount(table, previous, len(goods)) {
+			return errOutputsKept
+		}
+	}
+
+	for start := 0; start < len(goods); start += config.PostgresBatch {
+		batch := goods[start:min(start+config.PostgresBatch, len(goods))]
+		args := make([]any, 0, len(batch)*(len(postgresColumns)+1))
+		for _, item := range batch {
+			for _, column := range postgresColumns {
+				args = append(args, column.value(item))
+			}
+			args = append(args, seenAt)
+		}
+		if _, err := tx.ExecContext(ctx, postgresUpsert(table, len(batch)), args...); err != nil {
+			return fmt.Errorf("upserting offers %d-%d: %w", start+1, start+len(batch), err)
+		}
+	}
+
+	pruned := int64(0)
+	if config.PostgresPrune {
+		result, err := tx.ExecContext(ctx, fmt.Sprintf("DELETE FROM %s WHERE seen_at < $1", table), seenAt)
+		if err != nil {
+			return fmt.Errorf("pruning offers: %w", err)
+		}
+		pruned, _ = result.RowsAffected()
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("🐘 %d offers upserted into %s, %d pruned", len(goods), table, pruned)
+	return nil
+}
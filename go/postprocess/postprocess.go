@@ -0,0 +1,111 @@
+// Package postprocess - custom enrichment and filtering of the scraped goods.
+//
+// A post-processor is a package that registers itself from init():
+//
+//	func init() {
+//		postprocess.Register(func(goods []postprocess.Goods) []postprocess.Goods { ... })
+//	}
+//
+// and is compiled into koopi by a blank import in a file of the koopi main package:
+//
+//	import _ "example.com/myprocessor"
+package postprocess
+
+import "sync"
+
+// Goods - one scraped offer, the fields of the koopi outputs
+type Goods struct {
+	Category     string
+	Query        string
+	Name         string
+	Price        string // raw text, e.g. "1 299,90 Kč"
+	PricePerUnit string // raw text, e.g. "20,00 Kč / 1 l"
+	Discount     string
+	Note         string
+	Club         string
+	Volume       string
+	Market       string // market label of the site, e.g. "Albert hypermarket"
+	Chain        string // canonical chain of the Market, e.g. "Albert"
+	Validity     string
+	ValidFrom    string // ISO date parsed from Validity, "" = unknown
+	ValidTo      string // ISO date parsed from Validity, "" = unknown
+	Url          string
+	ImageUrl     string
+	SubCat       string // by the subcat rules, the built-in ones give "lahev" | "plech"
+	ScrapedAt    string
+	GroupId      string // product group of the site (group_discounts), shared by its offers
+
+	DepositBottle bool   // returnable bottle (záloha)
+	Packaging     string // can, glass, PET, ..., "" = unknown
+
+	ClubRequired bool   // price for the members of a loyalty program only
+	ClubName     string // normalized loyalty program, e.g. "Tesco Clubcard", "" = unknown
+
+	Brand string // manufacturer detected in the name, "" = unknown
+
+	ProductId   string // stable UUID of the product, assigned by koopi
+	Ean         string // EAN/GTIN with a valid check digit, "" = unknown
+	ProductCode string // product ID of the site
+
+	// product detail page, filled with the detail_pages option
+	Description  string
+	AllMarkets   []string
+	PriceHistory []PricePoint
+
+	SourcePage      string // URL of the page the offer was extracted from
+	SourceCache     string // cache file name of the page
+	SourceFetchTime string // RFC3339 time the page was fetched
+
+	Pinned   string  // name of the matching pinned product
+	Baseline float64 // everyday price of the pinned product, 0 = unknown
+
+	Computed map[string]float64 // user-defined computed fields
+
+	PriceValue          float64 // parsed Price, 0 = unknown
+	PricePerUnitValue   float64 // parsed PricePerUnit, 0 = unknown
+	PricePerUnitDerived bool    // unit price computed from the price and the volume, not listed on the site
+	Currency            string  // ISO code of the parsed prices
+
+	DiscountPercent int     // parsed Discount, -1 = none
+	DiscountImplied bool    // DiscountPercent computed from the OriginalPrice
+	OriginalPrice   float64 // price before the discount, 0 = unknown
+
+	Quantity float64 // parsed Volume in Unit, multipacks in total, 0 = unknown
+	Unit     string  // normalized unit of the Quantity: kg, l, ks, m
+
+	PackCount     int     // pieces of the multipack, 1 = single piece, 0 = unknown volume
+	PieceQuantity float64 // size of one piece in Unit
+	PiecePrice    float64 // effective price of one piece, 0 = unknown
+}
+
+// PricePoint - price of the product history shown on the detail page
+type PricePoint struct {
+	Date  string  `json:"date"`
+	Price float64 `json:"price"`
+}
+
+// PostProcessor - custom enrichment/filter applied to the final goods
+type PostProcessor func([]Goods) []Goods
+
+// registered post-processors
+var (
+	mutex      sync.Mutex
+	processors []PostProcessor
+)
+
+// Register - register a post-processor compiled into the binary, they run in order of registration
+func Register(p PostProcessor) {
+	mutex.Lock()
+	defer mutex.Unlock()
+	processors = append(processors, p)
+}
+
+// Apply - run the registered post-processors
+func Apply(goods []Goods) []Goods {
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, p := range processors {
+		goods = p(goods)
+	}
+	return goods
+}
@@ -0,0 +1,16 @@
+package postprocess
+
+import "testing"
+
+func TestApplyInOrder(t *testing.T) {
+	Register(func(goods []Goods) []Goods {
+		return append(goods, Goods{Name: "first"})
+	})
+	Register(func(goods []Goods) []Goods {
+		return goods[1:] // drops the input, keeps the one added above
+	})
+	goods := Apply([]Goods{{Name: "input"}})
+	if len(goods) != 1 || goods[0].Name != "first" {
+		t.Errorf("goods = %v, want only the one added by the first post-processor", goods)
+	}
+}
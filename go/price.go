@@ -0,0 +1,180 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// treatment of offers without a price, e.g. "cena v letáku"
+const (
+	PRICE_UNKNOWN_KEEP       = "keep"       // emitted with price_unknown set
+	PRICE_UNKNOWN_DROP       = "drop"       // removed from the outputs
+	PRICE_UNKNOWN_QUARANTINE = "quarantine" // moved to config.QuarantineCsv
+
+	QUARANTINE_CSV = "price-unknown.csv"
+)
+
+// isPriceUnknown - offer without a parseable price, pinned placeholders have no offer at all
+func isPriceUnknown(item Goods) bool {
+	if isPinPlaceholder(item) {
+		return false
+	}
+	_, ok := parsePrice(item.Price)
+	return !ok
+}
+
+// applyPriceUnknownPolicy - drop or quarantine the offers without a price
+func applyPriceUnknownPolicy(goods []Goods, policy string) []Goods {
+	if policy == PRICE_UNKNOWN_KEEP {
+		return goods
+	}
+	var kept, unknown []Goods
+	for _, item := range goods {
+		if isPriceUnknown(item) {
+			unknown = append(unknown, item)
+		} else {
+			kept = append(kept, item)
+		}
+	}
+	if len(unknown) == 0 {
+		if policy == PRICE_UNKNOWN_QUARANTINE {
+			os.Remove(config.QuarantineCsv)
+		}
+		return goods
+	}
+	switch policy {
+	case PRICE_UNKNOWN_DROP:
+		log.Printf("🏷️ %d offers without a price dropped", len(unknown))
+	case PRICE_UNKNOWN_QUARANTINE:
+		if err := appendToCsv(newOutputSnapshot(unknown, nil), config.QuarantineCsv); err != nil {
+			log.Printf("[%s] 💥 error writing quarantine: %v", config.QuarantineCsv, err)
+		} else {
+			log.Printf("🏷️ %d offers without a price quarantined to %s", len(unknown), config.QuarantineCsv)
+		}
+	}
+	return kept
+}
+
+// currencies of the price texts, the site lists Czech crowns only
+const (
+	CURRENCY_CZK = "CZK"
+	CURRENCY_EUR = "EUR"
+)
+
+// setPriceValues - parse the raw price texts into the numeric fields
+func setPriceValues(item *Goods) {
+	item.PriceValue, _ = parsePrice(item.Price)
+	item.PricePerUnitValue, _ = parsePrice(item.PricePerUnit)
+	item.PiecePrice = 0
+	if item.PackCount > 0 {
+		item.PiecePrice = math.Round(item.PriceValue/float64(item.PackCount)*100) / 100
+	}
+	item.Currency = ""
+	if item.PriceValue > 0 || item.PricePerUnitValue > 0 {
+		item.Currency = priceCurrency(item.Price + " " + item.PricePerUnit)
+	}
+}
+
+// priceCurrency - currency of the price text, crowns without a symbol
+func priceCurrency(s string) string {
+	if strings.Contains(s, "€") || strings.Contains(s, "EUR") {
+		return CURRENCY_EUR
+	}
+	return CURRENCY_CZK
+}
+
+// optionalNumber - numeric output field, nil for an unknown (0) value
+func optionalNumber(v float64) *float64 {
+	if v == 0 {
+		return nil
+	}
+	return &v
+}
+
+// formatPrice - numeric price for the CSV, "" for an unknown price
+func formatPrice(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', 2, 64)
+}
+
+// derivePricePerUnit - compute the missing unit price from the price and the parsed volume, the raw text is kept
+func derivePricePerUnit(item *Goods) {
+	if isPricePerVolume(*item) {
+		// the site lists the price of the whole volume, e.g. "29,90 Kč/0,5 l", converted to the unit
+		item.PricePerUnitValue = 0
+		if item.PriceValue > 0 && item.Quantity > 0 {
+			item.PricePerUnitValue = math.Round(item.PriceValue/item.Quantity*100) / 100
+		}
+		return
+	}
+	if item.PricePerUnitValue > 0 || item.PriceValue <= 0 || item.Quantity <= 0 {
+		return
+	}
+	item.PricePerUnitValue = math.Round(item.PriceValue/item.Quantity*100) / 100
+	item.PricePerUnitDerived = true
+}
+
+// isPricePerVolume - the listed unit price text is the price per the whole volume of the offer
+func isPricePerVolume(item Goods) bool {
+	clean := strings.NewReplacer("\u00A0", "", "\u202F", "", " ", "")
+	listed := strings.ToLower(clean.Replace(item.PricePerUnit))
+	return listed != "" && listed == strings.ToLower(clean.Replace(item.Price+"/"+item.Volume))
+}
+
+// pricePerUnitText - unit price to display: the listed text, else formatted from the derived or converted value
+func pricePerUnitText(item Goods) string {
+	if strings.TrimSpace(item.PricePerUnit) != "" && !isPricePerVolume(item) {
+		return item.PricePerUnit
+	}
+	if item.PricePerUnitValue <= 0 || item.Quantity == 1 {
+		return "" // the unit price is the price, not shown like on the site
+	}
+	symbol := "Kč"
+	if item.Currency == CURRENCY_EUR {
+		symbol = "€"
+	}
+	return fmt.Sprintf("%s %s / 1 %s", strings.Replace(formatPrice(item.PricePerUnitValue), ".", ",", 1), symbol, item.Unit)
+}
+
+// regular price mentioned in the note, e.g. "běžná cena 39,90 Kč"
+var reOriginalPriceNote = regexp.MustCompile(`(?i)(?:běžná|původní)\s+cena:?\s*(\d[\d\s\x{00A0}\x{202F}]*(?:[.,]\d+)?)`)
+
+// originalPrice - price before the discount, the crossed-out price or the one in the note
+func originalPrice(text string, note string) float64 {
+	if v, ok := parsePrice(text); ok {
+		return v
+	}
+	if m := reOriginalPriceNote.FindStringSubmatch(note); m != nil {
+		v, _ := parsePrice(m[1])
+		return v
+	}
+	return 0
+}
+
+// setDiscount - parse the discount percentage, implied by the original price when the page shows none
+func setDiscount(item *Goods) {
+	item.DiscountPercent, item.DiscountImplied = -1, false
+	if m := rePercent.FindStringSubmatch(item.Discount); m != nil {
+		item.DiscountPercent, _ = strconv.Atoi(m[1])
+		return
+	}
+	if item.OriginalPrice > item.PriceValue && item.PriceValue > 0 {
+		item.DiscountPercent = int(math.Round((item.OriginalPrice - item.PriceValue) / item.OriginalPrice * 100))
+		item.DiscountImplied = true
+	}
+}
+
+// formatDiscount - discount percentage for the CSV, "" for none
+func formatDiscount(percent int) string {
+	if percent < 0 {
+		return ""
+	}
+	return strconv.Itoa(percent)
+}
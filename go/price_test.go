@@ -0,0 +1,61 @@
+package main
+
+import "testing"
+
+func TestSetDiscount(t *testing.T) {
+	tests := []struct {
+		discount      string
+		price         float64
+		originalPrice float64
+		percent       int
+		implied       bool
+	}{
+		{"-22 %", 0, 0, 22, false},
+		{"-22\u00a0%", 0, 0, 22, false}, // no-break space
+		{"-22\u202f%", 0, 0, 22, false}, // narrow no-break space of newGoodsFromOffer
+		{"-22%", 0, 0, 22, false},
+		{"", 0, 0, -1, false},
+		{"akce", 0, 0, -1, false},
+		{"", 75, 100, 25, true},
+		{"-10 %", 75, 100, 10, false}, // the listed discount wins
+		{"", 100, 75, -1, false},
+	}
+	for _, tt := range tests {
+		item := Goods{Discount: tt.discount, PriceValue: tt.price, OriginalPrice: tt.originalPrice}
+		setDiscount(&item)
+		if item.DiscountPercent != tt.percent || item.DiscountImplied != tt.implied {
+			t.Errorf("%q %v/%v: percent %d implied %v, want %d %v",
+				tt.discount, tt.price, tt.originalPrice, item.DiscountPercent, item.DiscountImplied, tt.percent, tt.implied)
+		}
+	}
+}
+
+func TestDerivePricePerUnit(t *testing.T) {
+	tests := []struct {
+		price, ppunit, volume string
+		value                 float64
+		derived               bool
+		text                  string
+	}{
+		{"29,90 Kč", "59,80 Kč / 1 l", "0,5 l", 59.8, false, "59,80 Kč / 1 l"},
+		{"29,90 Kč", "", "0,5 l", 59.8, true, "59,80 Kč / 1 l"},
+		{"29,90 Kč", "29,90 Kč/0,5 l", "0,5 l", 59.8, false, "59,80 Kč / 1 l"}, // the price of the whole volume
+		{"29,90 Kč", "", "1 l", 29.9, true, ""},
+		{"29,90 Kč", "", "?", 0, false, ""},
+	}
+	for _, tt := range tests {
+		item := Goods{Price: tt.price, PricePerUnit: tt.ppunit, Volume: tt.volume}
+		setVolumeValues(&item)
+		setPriceValues(&item)
+		derivePricePerUnit(&item)
+		if item.PricePerUnit != tt.ppunit {
+			t.Errorf("%q %q: raw text changed to %q", tt.ppunit, tt.volume, item.PricePerUnit)
+		}
+		if item.PricePerUnitValue != tt.value || item.PricePerUnitDerived != tt.derived {
+			t.Errorf("%q %q: value %v derived %v, want %v %v", tt.ppunit, tt.volume, item.PricePerUnitValue, item.PricePerUnitDerived, tt.value, tt.derived)
+		}
+		if text := pricePerUnitText(item); text != tt.text {
+			t.Errorf("%q %q: text %q, want %q", tt.ppunit, tt.volume, text, tt.text)
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// attributes with product identifiers on the product groups and detail pages
+var (
+	eanAttrs         = []string{"data-ean", "data-gtin", "data-barcode"}
+	productCodeAttrs = []string{"data-product-id", "data-product-code", "data-sku"}
+)
+
+var (
+	// EAN mentioned in the text of the detail page, e.g. "EAN: 8594404001234"
+	reEanText = regexp.MustCompile(`(?i)\b(?:EAN|GTIN|čárový kód)\s*:?\s*(\d{8,14})\b`)
+
+	// numeric ID at the end of the product URL, e.g. "/sleva/pivo-pilsner-123456"
+	reUrlProductCode = regexp.MustCompile(`[-/](\d{5,14})/?$`)
+)
+
+// validEan - EAN-8, UPC-A, EAN-13 or GTIN-14 with a valid check digit
+func validEan(code string) bool {
+	switch len(code) {
+	case 8, 12, 13, 14:
+	default:
+		return false
+	}
+	sum := 0
+	for i := len(code) - 2; i >= 0; i-- {
+		digit := int(code[i] - '0')
+		if digit < 0 || digit > 9 {
+			return false
+		}
+		if (len(code)-2-i)%2 == 0 {
+			digit *= 3
+		}
+		sum += digit
+	}
+	return int(code[len(code)-1]-'0') == (10-sum%10)%10
+}
+
+// normalizeEan - digits of the EAN, "" for invalid codes
+func normalizeEan(s string) string {
+	code := strings.Map(func(r rune) rune {
+		if r >= '0' && r <= '9' {
+			return r
+		}
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return 'x'
+	}, strings.TrimSpace(s))
+	if !validEan(code) {
+		return ""
+	}
+	return code
+}
+
+// attrCode - first of the attributes found on s or its descendants
+func attrCode(s *goquery.Selection, attrs []string) string {
+	for _, attr := range attrs {
+		if v, ok := s.Attr(attr); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+		if v, ok := s.Find("[" + attr + "]").First().Attr(attr); ok && strings.TrimSpace(v) != "" {
+			return strings.TrimSpace(v)
+		}
+	}
+	return ""
+}
+
+// urlProductCode - numeric ID of the product URL, valid EAN-13/GTIN-14 are returned as the EAN
+func urlProductCode(productUrl string) (ean string, code string) {
+	m := reUrlProductCode.FindStringSubmatch(productUrl)
+	if m == nil {
+		return "", ""
+	}
+	if len(m[1]) >= 13 && validEan(m[1]) {
+		return m[1], ""
+	}
+	return "", m[1]
+}
+
+// setProductCodes - fill the missing identifiers of the goods
+func setProductCodes(item *Goods, ean string, code string) {
+	if item.Ean == "" {
+		item.Ean = normalizeEan(ean)
+	}
+	if item.ProductCode == "" {
+		item.ProductCode = strings.TrimSpace(code)
+	}
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// stable product IDs persisted between runs, see assignProductIds
+const PRODUCT_IDS_FILE = "product-ids.json"
+
+// ID schemes of the JSON output and the images manifest
+const (
+	ID_SCHEME_MD5  = "md5"  // hash of Name+Volume+Category+SubCat, changes with any tweak of them
+	ID_SCHEME_UUID = "uuid" // stable UUIDv5 of the product, see assignProductIds
+)
+
+// RFC 4122 URL namespace, the koopi namespace is derived from it and KOOPI_HOME_URL
+var uuidNamespaceUrl = [16]byte{0x6b, 0xa7, 0xb8, 0x11, 0x9d, 0xad, 0x11, 0xd1, 0x80, 0xb4, 0x00, 0xc0, 0x4f, 0xd4, 0x30, 0xc8}
+
+// namespace of the product UUIDs
+var productNamespace = uuidV5(uuidNamespaceUrl, KOOPI_HOME_URL)
+
+// productIds - content of PRODUCT_IDS_FILE, aliases keep the first ID of a product
+type productIds struct {
+	Updated string            `json:"updated"`
+	Keys    map[string]string `json:"keys"`   // canonical product key -> ID
+	Groups  map[string]string `json:"groups"` // product group of the site | volume -> ID, survives renames
+}
+
+// uuidV5 - name-based UUID (SHA-1)
+func uuidV5(namespace [16]byte, name string) [16]byte {
+	hash := sha1.New()
+	hash.Write(namespace[:])
+	hash.Write([]byte(name))
+	var uuid [16]byte
+	copy(uuid[:], hash.Sum(nil))
+	uuid[6] = uuid[6]&0x0f | 0x50 // version 5
+	uuid[8] = uuid[8]&0x3f | 0x80 // RFC 4122 variant
+	return uuid
+}
+
+// formatUuid - canonical text form of the UUID
+func formatUuid(uuid [16]byte) string {
+	s := hex.EncodeToString(uuid[:])
+	return s[:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:]
+}
+
+// loadProductIds - load the ID aliases, empty for a missing file
+func loadProductIds(filename string) (productIds, error) {
+	ids := productIds{Keys: make(map[string]string), Groups: make(map[string]string)}
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return ids, nil
+	}
+	if err != nil {
+		return ids, err
+	}
+	if err := json.Unmarshal(content, &ids); err != nil {
+		return ids, fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	if ids.Keys == nil {
+		ids.Keys = make(map[string]string)
+	}
+	if ids.Groups == nil {
+		ids.Groups = make(map[string]string)
+	}
+	return ids, nil
+}
+
+// assignProductIds - set the stable IDs: the known ID of the canonical key or of the product group,
+// else the UUIDv5 of the canonical key; new aliases are saved for the next runs
+func assignProductIds(goods []Goods, filename string) error {
+	ids, err := loadProductIds(filename)
+	if err != nil {
+		return err
+	}
+	for i := range goods {
+		key := productKey(goods[i].Name, goods[i].Volume)
+		group := goods[i].GroupId + "|" + normalizeCzechString(goods[i].Volume)
+		id, ok := ids.Keys[key]
+		if !ok && goods[i].GroupId != "" {
+			id, ok = ids.Groups[group]
+		}
+		if !ok {
+			id = formatUuid(uuidV5(productNamespace, key))
+		}
+		goods[i].ProductId = id
+		ids.Keys[key] = id
+		if _, ok := ids.Groups[group]; !ok && goods[i].GroupId != "" {
+			ids.Groups[group] = id
+		}
+	}
+	if filename == "" {
+		return nil
+	}
+	ids.Updated = time.Now().Format(time.RFC3339)
+	content, err := json.MarshalIndent(ids, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, content)
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// links of the category page, facets are the ones below the category path
+const CATEGORY_FACET_SELECTOR = "a[href]"
+
+// offer counts and other noise around the facet names, e.g. "Světlé pivo (42)"
+var reFacetNoise = regexp.MustCompile(`\(\d+\)|\d+\s*(nabídek|nabídky|nabídka)`)
+
+// categoryFacets - names of the subcategory links of the category page
+func categoryFacets(body []byte, categoryUrl *url.URL, selector string) ([]string, string, error) {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return nil, "", err
+	}
+	prefix := strings.TrimSuffix(categoryUrl.Path, "/") + "/"
+	seen := make(map[string]bool)
+	var facets []string
+	doc.Find(selector).Each(func(_ int, s *goquery.Selection) {
+		href, _ := s.Attr("href")
+		link, err := categoryUrl.Parse(href)
+		if err != nil || link.Host != categoryUrl.Host || !strings.HasPrefix(link.Path, prefix) {
+			return
+		}
+		name := strings.ToLower(strings.Join(strings.Fields(reFacetNoise.ReplaceAllString(s.Text(), "")), " "))
+		if name == "" || seen[name] {
+			return
+		}
+		seen[name] = true
+		facets = append(facets, name)
+	})
+	title := strings.Join(strings.Fields(doc.Find("h1").First().Text()), " ")
+	return facets, title, nil
+}
+
+// existingQueries - normalized queries of the input CSV
+func existingQueries(filename string) (map[string]bool, error) {
+	queries := make(map[string]bool)
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	reader := csv.NewReader(file)
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %w", filename, err)
+	}
+	for _, record := range records {
+		if len(record) >= 2 {
+			queries[normalizeCzechString(record[1])] = true
+		}
+		if len(record) >= 4 {
+			for _, synonym := range strings.Split(record[3], SYNONYM_SEPARATOR) {
+				queries[normalizeCzechString(synonym)] = true
+			}
+		}
+	}
+	return queries, nil
+}
+
+// runImportCategory - append the facets of a category page as queries to the input CSV
+func runImportCategory(args []string) error {
+	flags := flag.NewFlagSet("queries import-category", flag.ExitOnError)
+	category := flags.String("category", "", "CATEGORY column of the new rows (default the page heading)")
+	pages := flags.Int("pages", 1, "PAGES column of the new rows")
+	selector := flags.String("selector", CATEGORY_FACET_SELECTOR, "facet links selector")
+	dryRun := flags.Bool("dry-run", false, "only print the new rows")
+	positional := parseInterspersed(flags, args)
+	if len(positional) != 1 {
+		return fmt.Errorf("%w: koopi queries import-category [flags] <category-url>", errUsage)
+	}
+	categoryUrl, err := url.Parse(positional[0])
+	if err != nil || categoryUrl.Host == "" {
+		return fmt.Errorf("invalid URL %q", positional[0])
+	}
+
+	UA, err := setupRun()
+	if err != nil {
+		return err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+
+	body, _, _, err := fetchPageWithRetries(context.Background(), UA, categoryUrl.String(), "", "", nil)
+	if err != nil {
+		return err
+	}
+	facets, title, err := categoryFacets(body, categoryUrl, *selector)
+	if err != nil {
+		return err
+	}
+	if *category == "" {
+		*category = strings.ToUpper(title)
+	}
+	if *category == "" {
+		return errors.New("no page heading, use --category")
+	}
+
+	existing, err := existingQueries(config.InputCsv)
+	if err != nil {
+		return err
+	}
+	var rows [][]string
+	for _, facet := range facets {
+		if existing[normalizeCzechString(facet)] {
+			continue
+		}
+		rows = append(rows, []string{*category, facet, fmt.Sprint(*pages)})
+	}
+	log.Printf("🗂️ %d facets found, %d new queries for %s", len(facets), len(rows), *category)
+	if len(rows) == 0 {
+		return nil
+	}
+
+	if *dryRun {
+		writer := csv.NewWriter(os.Stdout)
+		writer.WriteAll(rows)
+		return writer.Error()
+	}
+	return appendInputRows(rows)
+}
+
+// appendInputRows - append the rows to the input CSV
+func appendInputRows(rows [][]string) error {
+	file, err := os.OpenFile(config.InputCsv, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if content, err := os.ReadFile(config.InputCsv); err == nil && len(content) > 0 && content[len(content)-1] != '\n' {
+		file.WriteString("\n")
+	}
+	writer := csv.NewWriter(file)
+	writer.WriteAll(rows)
+	if err := writer.Error(); err != nil {
+		return err
+	}
+	log.Printf("🗂️ appended to %s", config.InputCsv)
+	return file.Close()
+}
+
+// runQueries - manage the queries of the input CSV
+func runQueries(args []string) error {
+	if len(args) > 0 && args[0] == "import-category" {
+		return runImportCategory(args[1:])
+	}
+	return fmt.Errorf("%w: koopi queries import-category [flags] <category-url>", errUsage)
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// fields the text replacements may be scoped to
+var replaceableFields = []string{"name", "note", "club", "volume", "validity", "market"}
+
+// TextReplacement - user-defined text fix, e.g. {"old": "láhev", "new": "lahev", "fields": ["note"]}
+type TextReplacement struct {
+	Old    string   `json:"old"`
+	New    string   `json:"new"`
+	Fields []string `json:"fields"` // empty = name and note
+}
+
+// prepareTextReplacements - validate the replacements and default their fields
+func prepareTextReplacements(replacements []TextReplacement) error {
+	for i := range replacements {
+		r := &replacements[i]
+		if r.Old == "" {
+			return fmt.Errorf("text replacement #%d: empty old text", i+1)
+		}
+		if len(r.Fields) == 0 {
+			r.Fields = []string{"name", "note"}
+		}
+		for _, field := range r.Fields {
+			if !slices.Contains(replaceableFields, field) {
+				return fmt.Errorf("text replacement %q: unknown field %q (use %s)", r.Old, field, strings.Join(replaceableFields, ", "))
+			}
+		}
+	}
+	return nil
+}
+
+// replaceText - apply the configured replacements scoped to the field
+func replaceText(field string, s string) string {
+	for _, r := range config.TextReplacements {
+		if slices.Contains(r.Fields, field) {
+			s = strings.ReplaceAll(s, r.Old, r.New)
+		}
+	}
+	return s
+}
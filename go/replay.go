@@ -0,0 +1,187 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	REPLAY_CORPUS      = "testdata"
+	REPLAY_GOLDEN      = ".golden.json" // golden file suffix replacing the page extension
+	REPLAY_SCRAPED_AT  = "20250101"     // fixed scrape date of the replayed pages
+	REPLAY_DIFFS_SHOWN = 5              // differences printed per page
+)
+
+// replayRecord - extracted fields compared against the golden file
+type replayRecord struct {
+	Name         string `json:"name"`
+	Price        string `json:"price,omitempty"`
+	PricePerUnit string `json:"ppunit,omitempty"`
+	Discount     string `json:"discount,omitempty"`
+	Note         string `json:"note,omitempty"`
+	Club         string `json:"club,omitempty"`
+	Volume       string `json:"volume,omitempty"`
+	Market       string `json:"market,omitempty"`
+	Validity     string `json:"validity,omitempty"`
+	Url          string `json:"url,omitempty"`
+	ImageUrl     string `json:"image_url,omitempty"`
+	GroupId      string `json:"group_id,omitempty"`
+}
+
+// newReplayRecord - the compared fields of the offer
+func newReplayRecord(item Goods) replayRecord {
+	return replayRecord{item.Name, item.Price, item.PricePerUnit, item.Discount, item.Note, item.Club,
+		item.Volume, item.Market, item.Validity, item.Url, item.ImageUrl, item.GroupId}
+}
+
+// replayPage - saved page of the corpus, mobile-* pages use the mobile layout
+type replayPage struct {
+	path   string
+	golden string
+	layout string
+}
+
+// replayPages - saved pages (.html, .html.gz) of the corpus directory
+func replayPages(corpus string) ([]replayPage, error) {
+	var pages []replayPage
+	err := filepath.WalkDir(corpus, func(path string, d os.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		base, ok := strings.CutSuffix(path, ".html.gz")
+		if !ok {
+			if base, ok = strings.CutSuffix(path, ".html"); !ok {
+				return nil
+			}
+		}
+		layout := LAYOUT_DESKTOP
+		if strings.HasPrefix(d.Name(), LAYOUT_MOBILE+"-") {
+			layout = LAYOUT_MOBILE
+		}
+		pages = append(pages, replayPage{path, base + REPLAY_GOLDEN, layout})
+		return nil
+	})
+	sort.Slice(pages, func(i, j int) bool { return pages[i].path < pages[j].path })
+	return pages, err
+}
+
+// readReplayPage - page content, gunzipped
+func readReplayPage(path string) ([]byte, error) {
+	content, err := os.ReadFile(path)
+	if err != nil || !strings.HasSuffix(path, ".gz") {
+		return content, err
+	}
+	reader, err := gzip.NewReader(bytes.NewReader(content))
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+	return io.ReadAll(reader)
+}
+
+// replayDiff - differences of the extracted offers from the golden ones
+func replayDiff(got []replayRecord, want []replayRecord) []string {
+	var diffs []string
+	if len(got) != len(want) {
+		diffs = append(diffs, fmt.Sprintf("%d offers, golden has %d", len(got), len(want)))
+	}
+	for i := range min(len(got), len(want)) {
+		gotJson, _ := json.Marshal(got[i])
+		wantJson, _ := json.Marshal(want[i])
+		if !bytes.Equal(gotJson, wantJson) {
+			diffs = append(diffs, fmt.Sprintf("offer %d:\n      got  %s\n      want %s", i+1, gotJson, wantJson))
+		}
+	}
+	return diffs
+}
+
+// runReplay - extract the goods of saved pages and compare them with the golden files
+func runReplay(args []string) error {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	corpus := flags.String("corpus", REPLAY_CORPUS, "directory of saved pages, mobile-*.html use the mobile layout")
+	update := flags.Bool("update", false, "write the golden files from the current extraction")
+	parseInterspersed(flags, args)
+
+	pages, err := replayPages(*corpus)
+	if err != nil {
+		return err
+	}
+	if len(pages) == 0 {
+		return fmt.Errorf("no .html pages in %s", *corpus)
+	}
+
+	failed, updated := 0, 0
+	for _, page := range pages {
+		body, err := readReplayPage(page.path)
+		if err != nil {
+			return err
+		}
+		goods, err := extractGoods(body, page.layout, "", "", REPLAY_SCRAPED_AT)
+		if err != nil {
+			return fmt.Errorf("[%s] %w", page.path, err)
+		}
+		got := make([]replayRecord, 0, len(goods))
+		for _, item := range goods {
+			got = append(got, newReplayRecord(item))
+		}
+
+		if *update {
+			content, err := json.MarshalIndent(got, "", "  ")
+			if err != nil {
+				return err
+			}
+			if err := os.WriteFile(page.golden, append(content, '\n'), 0644); err != nil {
+				return err
+			}
+			updated++
+			continue
+		}
+
+		content, err := os.ReadFile(page.golden)
+		if os.IsNotExist(err) {
+			log.Printf("❔ %s: no golden file, run with --update", page.path)
+			failed++
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		var want []replayRecord
+		if err := json.Unmarshal(content, &want); err != nil {
+			return fmt.Errorf("[%s] %w", page.golden, err)
+		}
+		diffs := replayDiff(got, want)
+		if len(diffs) == 0 {
+			log.Printf("✅ %s: %d offers", page.path, len(got))
+			continue
+		}
+		failed++
+		log.Printf("❌ %s:", page.path)
+		for i, diff := range diffs {
+			if i == REPLAY_DIFFS_SHOWN {
+				log.Printf("   ... and %d more", len(diffs)-i)
+				break
+			}
+			log.Printf("   %s", diff)
+		}
+	}
+
+	if *update {
+		log.Printf("📝 %d golden files written", updated)
+		return nil
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d pages differ from the golden files", failed, len(pages))
+	}
+	log.Printf("🎞️ all %d pages match", len(pages))
+	return nil
+}
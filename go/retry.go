@@ -0,0 +1,271 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const FAILED_URLS_FILE = "failed-urls.json"
+
+// failedJob - page that failed after all retries
+type failedJob struct {
+	Url      string `json:"url"`
+	CacheKey string `json:"cache_key"`
+	Category string `json:"category"`
+	Query    string `json:"query"`
+	Error    string `json:"error"`
+	Attempts int    `json:"attempts"`
+	Time     string `json:"time"`
+}
+
+// failed pages of the current run
+var (
+	failedJobsMutex sync.Mutex
+	failedJobs      []failedJob
+)
+
+// recordFailedJob - remember the page that failed after all retries
+func recordFailedJob(job scrapeJob, err error, attempts int) {
+	failedJobsMutex.Lock()
+	defer failedJobsMutex.Unlock()
+	failedJobs = append(failedJobs, failedJob{
+		Url:      job.url,
+		CacheKey: job.cacheKey,
+		Category: job.category,
+		Query:    job.query,
+		Error:    err.Error(),
+		Attempts: attempts,
+		Time:     time.Now().Format(time.RFC3339),
+	})
+}
+
+// saveFailedJobs - write the failed pages for koopi retry, remove the file when nothing failed
+func saveFailedJobs(filename string) {
+	failedJobsMutex.Lock()
+	defer failedJobsMutex.Unlock()
+	if len(failedJobs) == 0 {
+		if err := os.Remove(filename); err != nil && !os.IsNotExist(err) {
+			log.Printf("[%s] 💥 error removing: %v", filename, err)
+		}
+		return
+	}
+	content, err := json.MarshalIndent(failedJobs, "", "  ")
+	if err != nil {
+		return
+	}
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		log.Printf("[%s] 💥 error writing: %v", filename, err)
+		return
+	}
+	fmt.Printf("\n🩹 %d failed URLs saved to %s (koopi retry)\n", len(failedJobs), filename)
+}
+
+// loadFailedJobs - load the failed pages of the previous run
+func loadFailedJobs(filename string) ([]scrapeJob, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var failed []failedJob
+	if err := json.Unmarshal(content, &failed); err != nil {
+		return nil, fmt.Errorf("[%s] %w", filename, err)
+	}
+	var jobs []scrapeJob
+	for _, f := range failed {
+		jobs = append(jobs, scrapeJob{url: f.Url, cacheKey: f.CacheKey, category: f.Category, query: f.Query})
+	}
+	return jobs, nil
+}
+
+// loadGoodsFromCsv - load goods from the CSV output
+func loadGoodsFromCsv(filename string) ([]Goods, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	reader := csv.NewReader(file)
+	reader.Comma = ';'
+	reader.FieldsPerRecord = -1
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, fmt.Errorf("[%s] %w", filename, err)
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for i, name := range records[0] {
+		columns[name] = i
+	}
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+	rawField := func(record []string, name string) string {
+		if _, ok := columns[name+"Raw"]; ok {
+			return field(record, name+"Raw")
+		}
+		return field(record, name) // outputs before the numeric prices
+	}
+
+	var goods []Goods
+	for _, record := range records[1:] {
+		item := Goods{
+			Name:            field(record, "Name"),
+			Price:           rawField(record, "Price"),
+			PricePerUnit:    rawField(record, "PricePerUnit"),
+			Discount:        field(record, "Discount"),
+			Category:        field(record, "Category"),
+			SubCat:          field(record, "SubCat"),
+			Note:            field(record, "Note"),
+			Club:            field(record, "Club"),
+			Volume:          field(record, "Volume"),
+			Market:          field(record, "Market"),
+			Validity:        field(record, "Validity"),
+			ValidFrom:       field(record, "ValidFrom"),
+			ValidTo:         field(record, "ValidTo"),
+			Url:             field(record, "Url"),
+			ImageUrl:        field(record, "ImageUrl"),
+			Query:           field(record, "Query"),
+			ScrapedAt:       field(record, "ScrapedAt"),
+			SourcePage:      field(record, "SourcePage"),
+			SourceCache:     field(record, "SourceCache"),
+			SourceFetchTime: field(record, "SourceFetchTime"),
+			Pinned:          field(record, "Pinned"),
+			GroupId:         field(record, "GroupId"),
+			ProductId:       field(record, "ProductId"),
+			Ean:             field(record, "Ean"),
+			ProductCode:     field(record, "ProductCode"),
+		}
+
+		// restore the trimmed prefixes
+		if !strings.HasPrefix(item.Url, "http") {
+			item.Url = KOOPI_HOME_URL + item.Url
+		}
+		setVolumeValues(&item)
+		setPriceValues(&item)
+		setPackaging(&item)
+		setClub(&item)
+		item.Brand = detectBrand(item.Name)
+		item.Chain = marketChain(item.Market)
+		item.OriginalPrice, _ = parsePrice(field(record, "OriginalPrice"))
+		setDiscount(&item)
+		item.PricePerUnitDerived = field(record, "PricePerUnitDerived") == "true"
+		derivePricePerUnit(&item)
+		if item.ValidFrom == "" && item.ValidTo == "" {
+			item.ValidFrom, item.ValidTo = parseValidity(item.Validity, item.ScrapedAt) // outputs before valid_from
+		}
+		if item.GroupId == "" {
+			item.GroupId = groupId(productGroup{Name: item.Name, Url: item.Url}) // outputs before group_id
+		}
+		if item.ImageUrl == "" {
+			item.ImageUrl = IMAGE_NO_IMAGE_URL
+		} else if !strings.HasPrefix(item.ImageUrl, "http") {
+			item.ImageUrl = IMAGE_THUMBS_URL + item.ImageUrl
+		}
+		goods = append(goods, item)
+	}
+	return goods, nil
+}
+
+// loadDetailsFromJson - detail page fields by the product URL from the JSON output, the CSV has none
+func loadDetailsFromJson(filename string) (map[string]productDetail, error) {
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	var output outputDocument
+	if err := json.Unmarshal(content, &output); err != nil {
+		return nil, fmt.Errorf("[%s] %w", filename, err)
+	}
+	products := make([]outputProduct, 0, len(output.Goods)+len(output.Products))
+	for _, item := range output.Goods {
+		products = append(products, item.outputProduct)
+	}
+	for _, group := range output.Products {
+		products = append(products, group.outputProduct)
+	}
+	details := make(map[string]productDetail)
+	for _, product := range products {
+		if product.Description != "" || len(product.AllMarkets) > 0 || len(product.PriceHistory) > 0 {
+			details[product.Url] = productDetail{Description: product.Description, AllMarkets: product.AllMarkets, PriceHistory: product.PriceHistory}
+		}
+	}
+	return details, nil
+}
+
+// restoreDetails - attach the detail page fields of the previous outputs to the goods loaded from the CSV
+func restoreDetails(goods []Goods, filename string) {
+	if filename == "" || len(goods) == 0 {
+		return
+	}
+	details, err := loadDetailsFromJson(filename)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Printf("[%s] 💥 error loading the details: %v", filename, err)
+		}
+		return
+	}
+	for i := range goods {
+		if detail, ok := details[trimUrl(goods[i].Url)]; ok {
+			goods[i].Description = detail.Description
+			goods[i].AllMarkets = detail.AllMarkets
+			goods[i].PriceHistory = detail.PriceHistory
+		}
+	}
+}
+
+// runRetry - re-scrape the failed pages and merge them into the existing outputs
+func runRetry(args []string) error {
+	flags := flag.NewFlagSet("retry", flag.ExitOnError)
+	failedFile := flags.String("failed", statePath(config.FailedUrlsFile), "failed URLs file")
+	parseInterspersed(flags, args)
+
+	jobs, err := loadFailedJobs(*failedFile)
+	if os.IsNotExist(err) {
+		log.Println("🍀 Nothing to retry.")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if !checkLock() {
+		return errors.New("locked")
+	}
+	defer unlockLock()
+
+	UA, err := setupRun()
+	if err != nil {
+		return err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+
+	existingGoods, err := loadGoodsFromCsv(config.OutputCsv)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	restoreDetails(existingGoods, config.OutputJson)
+	allJobs, err := loadJobs(config.InputCsv)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("🩹 retrying %d failed URLs, merging into %d existing items", len(jobs), len(existingGoods))
+	retriedGoods := scrapeDetails(UA, scrapeJobs(UA, jobs))
+	return finishRun(append(existingGoods, retriedGoods...), allJobs)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestRestoreDetails(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "goods.json")
+	history := []pricePoint{{Date: "1. 10. 2026", Price: 24.9}}
+	output := outputDocument{
+		Goods:    []outputItem{{outputProduct: outputProduct{Url: "/pivo", Description: "světlý ležák", AllMarkets: []string{"Albert", "Billa"}}}},
+		Products: []outputGroup{{outputProduct: outputProduct{Url: "/maslo", PriceHistory: history}}},
+	}
+	content, _ := json.Marshal(output)
+	if err := os.WriteFile(filename, content, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	goods := []Goods{{Url: KOOPI_HOME_URL + "/pivo"}, {Url: KOOPI_HOME_URL + "/maslo"}, {Url: KOOPI_HOME_URL + "/cola"}}
+	restoreDetails(goods, filename)
+	if goods[0].Description != "světlý ležák" || !reflect.DeepEqual(goods[0].AllMarkets, []string{"Albert", "Billa"}) {
+		t.Errorf("flat layout: %+v", goods[0])
+	}
+	if !reflect.DeepEqual(goods[1].PriceHistory, history) {
+		t.Errorf("grouped layout: %+v", goods[1].PriceHistory)
+	}
+	if goods[2].Description != "" || goods[2].AllMarkets != nil || goods[2].PriceHistory != nil {
+		t.Errorf("no details: %+v", goods[2])
+	}
+
+	// no JSON output keeps the goods as loaded
+	restoreDetails(goods, filepath.Join(t.TempDir(), "missing.json"))
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"regexp"
+	"time"
+)
+
+const RUNS_FILE = "runs.jsonl"
+
+// run tags are used in filenames and reports
+var reRunTag = regexp.MustCompile(`^[\p{L}\p{N}._-]{1,64}$`)
+
+// start of the current run
+var runStarted time.Time
+
+// runRecord - one line of RUNS_FILE
+type runRecord struct {
+	Tag      string    `json:"tag,omitempty"`
+	Started  time.Time `json:"started"`
+	Finished time.Time `json:"finished"`
+	Items    int       `json:"items"`
+	Output   string    `json:"output"`
+
+	RateLimited    int      `json:"rate_limited,omitempty"`     // 429 responses
+	RateLimitPause Duration `json:"rate_limit_pause,omitempty"` // fetches paused by Retry-After
+
+	Status string `json:"status,omitempty"` // RUN_STATUS_COLLAPSED, "" = ok
+}
+
+// validateRunTag - check the --tag value
+func validateRunTag(tag string) error {
+	if tag != "" && !reRunTag.MatchString(tag) {
+		return fmt.Errorf("invalid run tag %q (letters, digits, . _ - only)", tag)
+	}
+	return nil
+}
+
+// recordRun - append the finished run to the runs file
+func recordRun(filename string, rec runRecord) error {
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	line, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// loadRuns - load the run records, optionally only the tagged ones
+func loadRuns(filename string, tag string) ([]runRecord, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var runs []runRecord
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var rec runRecord
+		if err := json.Unmarshal(scanner.Bytes(), &rec); err != nil {
+			return nil, fmt.Errorf("[%s] %w", filename, err)
+		}
+		if tag == "" || rec.Tag == tag {
+			runs = append(runs, rec)
+		}
+	}
+	return runs, scanner.Err()
+}
+
+// runRuns - list the recorded runs
+func runRuns(args []string) error {
+	flags := flag.NewFlagSet("runs", flag.ExitOnError)
+	runsFile := flags.String("runs", statePath(config.RunsFile), "runs file")
+	tag := flags.String("tag", "", "show only runs with this tag")
+	parseInterspersed(flags, args)
+
+	runs, err := loadRuns(*runsFile, *tag)
+	if err != nil {
+		return err
+	}
+	for _, rec := range runs {
+		tagName := rec.Tag
+		if tagName == "" {
+			tagName = "-"
+		}
+		fmt.Printf("%s  %-20s %6d items  %8s  %s",
+			rec.Started.Format("2006-01-02 15:04"), tagName, rec.Items,
+			rec.Finished.Sub(rec.Started).Round(time.Second), rec.Output)
+		if rec.RateLimited > 0 {
+			fmt.Printf("  🚦 %d x 429, paused %s", rec.RateLimited, time.Duration(rec.RateLimitPause).Round(time.Second))
+		}
+		if rec.Status == RUN_STATUS_COLLAPSED {
+			fmt.Printf("  🚨 COLLAPSED")
+		}
+		fmt.Println()
+	}
+	return nil
+}
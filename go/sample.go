@@ -0,0 +1,75 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheLocation - where the cached page of the entry is stored
+func cacheLocation(cacheName string) string {
+	if cacheName == "" {
+		return "-"
+	}
+	cache, ok := htmlCache.(*fileCache)
+	if !ok {
+		return fmt.Sprintf("%s [%s]", cacheName, config.CacheDb)
+	}
+	filePath := cache.path(cacheName)
+	for _, suffix := range []string{CACHE_GZ_SUFFIX, ""} {
+		if _, err := os.Stat(filePath + suffix); err == nil {
+			if abs, err := filepath.Abs(filePath + suffix); err == nil {
+				return abs
+			}
+			return filePath + suffix
+		}
+	}
+	return cacheName + " (no longer cached)"
+}
+
+// runSample - print random offers of the latest run for manual checks
+func runSample(args []string) error {
+	flags := flag.NewFlagSet("sample", flag.ExitOnError)
+	n := flags.Int("n", 20, "number of offers")
+	seed := flags.Int64("seed", 0, "random seed to repeat a sample, 0 = random")
+	parseInterspersed(flags, args)
+
+	goods, err := loadGoodsFromCsv(config.OutputCsv)
+	if err != nil {
+		return err
+	}
+	if len(goods) == 0 {
+		return fmt.Errorf("[%s] no offers", config.OutputCsv)
+	}
+	if *seed == 0 {
+		*seed = time.Now().UnixNano()
+	}
+	rnd := rand.New(rand.NewSource(*seed))
+	rnd.Shuffle(len(goods), func(i, j int) {
+		goods[i], goods[j] = goods[j], goods[i]
+	})
+	if *n > 0 && *n < len(goods) {
+		goods = goods[:*n]
+	}
+
+	if err := openHtmlCache(); err != nil {
+		return err
+	}
+	defer closeHtmlCache()
+
+	fmt.Printf("🎲 %d offers from %s (--seed %d)\n", len(goods), config.OutputCsv, *seed)
+	for i, item := range goods {
+		fmt.Printf("\n#%d %s%s%s · %s · %s · %s · %s\n", i+1, ColorCyan, item.Name, ColorReset,
+			item.Price, item.Volume, item.Market, item.Validity)
+		if item.Note != "" || item.Club != "" || item.Discount != "" {
+			fmt.Printf("   note: %s  club: %s  discount: %s\n", item.Note, item.Club, item.Discount)
+		}
+		fmt.Printf("   offer:  %s\n", item.Url)
+		fmt.Printf("   source: %s (%s)\n", item.SourcePage, item.SourceFetchTime)
+		fmt.Printf("   cache:  %s\n", cacheLocation(item.SourceCache))
+	}
+	return nil
+}
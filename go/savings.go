@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const PURCHASES_FILE = "purchases.jsonl"
+
+// purchase - one line of PURCHASES_FILE, the baseline is kept as it was when bought
+type purchase struct {
+	Date     time.Time `json:"date"`
+	Product  string    `json:"product"`
+	Price    float64   `json:"price"`
+	Quantity int       `json:"quantity"`
+	Market   string    `json:"market,omitempty"`
+	Baseline float64   `json:"baseline,omitempty"`
+}
+
+// saved - money saved against the baseline, false without a baseline
+func (p purchase) saved() (float64, bool) {
+	if p.Baseline <= 0 {
+		return 0, false
+	}
+	return (p.Baseline - p.Price) * float64(p.Quantity), true
+}
+
+// loadPurchases - load the recorded purchases
+func loadPurchases(filename string) ([]purchase, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var purchases []purchase
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var p purchase
+		if err := json.Unmarshal(scanner.Bytes(), &p); err != nil {
+			return nil, fmt.Errorf("[%s] %w", filename, err)
+		}
+		purchases = append(purchases, p)
+	}
+	return purchases, scanner.Err()
+}
+
+// runBought - record a purchase of a pinned product
+func runBought(args []string) error {
+	flags := flag.NewFlagSet("bought", flag.ExitOnError)
+	date := flags.String("date", "", "purchase date YYYY-MM-DD (default today)")
+	quantity := flags.Int("qty", 1, "number of pieces")
+	market := flags.String("market", "", "where it was bought")
+	positional := parseInterspersed(flags, args)
+	if len(positional) != 2 {
+		return fmt.Errorf("%w: koopi bought [flags] <pinned product> <price>", errUsage)
+	}
+
+	p := purchase{Date: time.Now(), Product: strings.TrimSpace(positional[0]), Quantity: *quantity, Market: *market}
+	var err error
+	if p.Price, err = strconv.ParseFloat(strings.Replace(positional[1], ",", ".", 1), 64); err != nil || p.Price <= 0 {
+		return fmt.Errorf("invalid price %q", positional[1])
+	}
+	if p.Quantity < 1 {
+		return fmt.Errorf("invalid quantity %d", p.Quantity)
+	}
+	if *date != "" {
+		if p.Date, err = time.ParseInLocation("2006-01-02", *date, time.Local); err != nil {
+			return fmt.Errorf("invalid date %q", *date)
+		}
+	}
+	baselines, err := loadBaselines(statePath(config.BaselinesFile))
+	if err != nil {
+		return err
+	}
+	if b, ok := baselines[p.Product]; ok {
+		p.Baseline = b.Price
+	} else {
+		log.Printf("⚠️ no baseline for %q, the purchase is not counted in savings (koopi baseline set)", p.Product)
+	}
+
+	file, err := os.OpenFile(statePath(config.PurchasesFile), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	line, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		return err
+	}
+	if saved, ok := p.saved(); ok {
+		log.Printf("🛒 %s %dx %.2f, saved %.2f Kč", p.Product, p.Quantity, p.Price, saved)
+	}
+	return file.Close()
+}
+
+// savingsPeriod - report period of the date
+func savingsPeriod(date time.Time, by string) string {
+	if by == "week" {
+		year, week := date.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	}
+	return date.Format("2006-01")
+}
+
+// runSavings - money saved against the baselines per month or week
+func runSavings(args []string) error {
+	flags := flag.NewFlagSet("savings", flag.ExitOnError)
+	by := flags.String("by", "month", "report period: month | week")
+	period := flags.String("period", "", "only this period, e.g. 2026-10 or 2026-W42")
+	parseInterspersed(flags, args)
+	if *by != "month" && *by != "week" {
+		return fmt.Errorf("invalid period %q, use month | week", *by)
+	}
+
+	purchases, err := loadPurchases(statePath(config.PurchasesFile))
+	if os.IsNotExist(err) {
+		log.Println("🛒 No purchases recorded yet (koopi bought).")
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	type periodSavings struct {
+		saved     float64
+		spent     float64
+		purchases int
+		products  map[string]float64
+	}
+	periods := make(map[string]*periodSavings)
+	uncounted := 0
+	for _, p := range purchases {
+		name := savingsPeriod(p.Date, *by)
+		if *period != "" && name != *period {
+			continue
+		}
+		saved, ok := p.saved()
+		if !ok {
+			uncounted++
+			continue
+		}
+		ps, ok := periods[name]
+		if !ok {
+			ps = &periodSavings{products: make(map[string]float64)}
+			periods[name] = ps
+		}
+		ps.saved += saved
+		ps.spent += p.Price * float64(p.Quantity)
+		ps.purchases++
+		ps.products[p.Product] += saved
+	}
+
+	var names []string
+	for name := range periods {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	total := 0.0
+	for _, name := range names {
+		ps := periods[name]
+		total += ps.saved
+		fmt.Printf("%-10s %4d purchases  spent %9.2f Kč  saved %8.2f Kč\n", name, ps.purchases, ps.spent, ps.saved)
+		var products []string
+		for product := range ps.products {
+			products = append(products, product)
+		}
+		sort.Slice(products, func(i, j int) bool {
+			return ps.products[products[i]] > ps.products[products[j]]
+		})
+		for _, product := range products {
+			fmt.Printf("           %-30s %8.2f Kč\n", product, ps.products[product])
+		}
+	}
+	fmt.Printf("\n💰 saved %.2f Kč thanks to koopi\n", total)
+	if uncounted > 0 {
+		fmt.Printf("   %d purchases without a baseline price are not counted\n", uncounted)
+	}
+	return nil
+}
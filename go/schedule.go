@@ -0,0 +1,188 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	SCHEDULE_FILE  = "schedule.json" // last scrape time per category
+	SCHEDULE_EVERY = 24 * time.Hour  // default category frequency
+	DAEMON_TICK    = time.Hour       // longest sleep between the schedule checks
+)
+
+// scheduleState - last successful scrape of each category
+type scheduleState map[string]time.Time
+
+// loadSchedule - load the schedule state, a missing file means nothing was scraped yet
+func loadSchedule(filename string) (scheduleState, error) {
+	state := make(scheduleState)
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return state, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(content, &state); err != nil {
+		return nil, err
+	}
+	return state, nil
+}
+
+// saveSchedule - write the schedule state atomically
+func saveSchedule(filename string, state scheduleState) error {
+	content, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filename+".tmp", content, 0644); err != nil {
+		return err
+	}
+	return os.Rename(filename+".tmp", filename)
+}
+
+// categoryEvery - scrape frequency of the category
+func categoryEvery(category string) time.Duration {
+	for name, every := range config.CategoryEvery {
+		if strings.EqualFold(name, category) {
+			return time.Duration(every)
+		}
+	}
+	return time.Duration(config.ScheduleEvery)
+}
+
+// dueJobs - jobs of the categories due at the time and the time of the next due category
+func dueJobs(jobs []scrapeJob, state scheduleState, now time.Time) ([]scrapeJob, map[string]bool, time.Time) {
+	due := make(map[string]bool)
+	var next time.Time
+	for _, job := range jobs {
+		if _, seen := due[job.category]; seen {
+			continue
+		}
+		nextRun := state[job.category].Add(categoryEvery(job.category))
+		due[job.category] = !nextRun.After(now)
+		if !due[job.category] && (next.IsZero() || nextRun.Before(next)) {
+			next = nextRun
+		}
+	}
+	var selected []scrapeJob
+	for _, job := range jobs {
+		if due[job.category] {
+			selected = append(selected, job)
+		}
+	}
+	for category, ok := range due {
+		if !ok {
+			delete(due, category)
+		}
+	}
+	return selected, due, next
+}
+
+// runScheduled - scrape the due categories, the other categories are kept from the previous output
+func runScheduled(state scheduleState) (time.Time, error) {
+	if !checkLock() {
+		return time.Time{}, errors.New("locked")
+	}
+	defer unlockLock()
+
+	UA, err := setupRun()
+	if err != nil {
+		return time.Time{}, err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+
+	allJobs, err := loadJobs(config.InputCsv)
+	if err != nil {
+		return time.Time{}, err
+	}
+	now := time.Now()
+	jobs, due, next := dueJobs(allJobs, state, now)
+	if len(jobs) == 0 {
+		log.Println("🍀 Nothing due.")
+		return next, nil
+	}
+
+	var categories []string
+	for category := range due {
+		categories = append(categories, category)
+	}
+	newCollator().SortStrings(categories)
+	log.Printf("⏰ due categories: %s", strings.Join(categories, ", "))
+
+	var keptGoods []Goods
+	existingGoods, err := loadGoodsFromCsv(config.OutputCsv)
+	if err != nil && !os.IsNotExist(err) {
+		return time.Time{}, err
+	}
+	for _, item := range existingGoods {
+		if !due[item.Category] {
+			keptGoods = append(keptGoods, item)
+		}
+	}
+	log.Printf("⏰ scraping %d pages, keeping %d items of the other categories", len(jobs), len(keptGoods))
+
+	scrapedGoods := scrapeJobs(UA, jobs)
+	if err := finishRun(scrapeDetails(UA, append(keptGoods, scrapedGoods...)), allJobs); err != nil {
+		return time.Time{}, err
+	}
+	for category := range due {
+		state[category] = now
+	}
+	if err := saveSchedule(statePath(config.ScheduleFile), state); err != nil {
+		return time.Time{}, err
+	}
+
+	// the next due category after this run
+	_, _, next = dueJobs(allJobs, state, now)
+	return next, nil
+}
+
+// runDaemon - keep scraping the categories by their frequencies until stopped
+func runDaemon(args []string) error {
+	flags := flag.NewFlagSet("daemon", flag.ExitOnError)
+	once := flags.Bool("once", false, "scrape the due categories once and exit")
+	parseInterspersed(flags, args)
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	for {
+		state, err := loadSchedule(statePath(config.ScheduleFile))
+		if err != nil {
+			return err
+		}
+		next, err := runScheduled(state)
+		if err != nil && !errors.Is(err, errOutputsKept) {
+			log.Printf("💥 %v", err)
+		}
+		if errors.Is(err, errExtractionCollapsed) {
+			writeFailureReport(newFailureReport("daemon", err.Error()))
+		}
+		if *once {
+			return err
+		}
+
+		wait := DAEMON_TICK
+		if !next.IsZero() && time.Until(next) < wait {
+			wait = max(time.Until(next), time.Minute)
+		}
+		log.Printf("💤 next check at %s", time.Now().Add(wait).Format("2006-01-02 15:04"))
+		select {
+		case <-ctx.Done():
+			log.Println("👋 daemon stopped")
+			return nil
+		case <-time.After(wait):
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const (
+	OUTPUT_SCHEMA     = "koopi.schema.json"
+	SCHEMA_DRAFT      = "https://json-schema.org/draft/2020-12/schema"
+	SCHEMA_MAX_ERRORS = 20 // errors printed by validate-output
+)
+
+// outputSchema - JSON Schema of the JSON output generated from the outputDocument types, they cannot drift apart
+func outputSchema() map[string]any {
+	schema := typeSchema(reflect.TypeFor[outputDocument]())
+	schema["$schema"] = SCHEMA_DRAFT
+	schema["title"] = fmt.Sprintf("koopi JSON output v%d", JSON_OUTPUT_VERSION)
+	schema["properties"].(map[string]any)["version"] = map[string]any{"const": JSON_OUTPUT_VERSION}
+	return schema
+}
+
+// typeSchema - schema of a Go type as encoded by encoding/json, pointers are nullable
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		schema := typeSchema(t.Elem())
+		schema["type"] = []any{schema["type"], "null"}
+		return schema
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": typeSchema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": typeSchema(t.Elem())}
+	case reflect.Struct:
+		properties := make(map[string]any)
+		required := []any{}
+		addStructFields(t, properties, &required)
+		return map[string]any{"type": "object", "properties": properties, "required": required, "additionalProperties": false}
+	}
+	return map[string]any{}
+}
+
+// addStructFields - properties of the exported fields, the embedded structs are inlined like by encoding/json
+func addStructFields(t reflect.Type, properties map[string]any, required *[]any) {
+	for field := range t.Fields() {
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" {
+			addStructFields(field.Type, properties, required)
+			continue
+		}
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = field.Name
+		}
+		properties[name] = typeSchema(field.Type)
+		if !strings.Contains(options, "omitempty") && !strings.Contains(options, "omitzero") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+// validateSchema - errors of the value against the schema subset produced by typeSchema
+func validateSchema(schema map[string]any, value any, path string) []string {
+	if expected, ok := schema["const"]; ok {
+		if fmt.Sprint(expected) != fmt.Sprint(value) {
+			return []string{fmt.Sprintf("%s: %v, expected %v", path, value, expected)}
+		}
+		return nil
+	}
+	if types, ok := schema["type"]; ok && !matchesType(types, value) {
+		return []string{fmt.Sprintf("%s: %s, expected %v", path, jsonTypeName(value), types)}
+	}
+	var errs []string
+	switch v := value.(type) {
+	case []any:
+		if items, ok := schema["items"].(map[string]any); ok {
+			for i, item := range v {
+				errs = append(errs, validateSchema(items, item, fmt.Sprintf("%s[%d]", path, i))...)
+			}
+		}
+	case map[string]any:
+		properties, _ := schema["properties"].(map[string]any)
+		if required, ok := schema["required"].([]any); ok {
+			for _, name := range required {
+				if _, ok := v[name.(string)]; !ok {
+					errs = append(errs, fmt.Sprintf("%s: missing %q", path, name))
+				}
+			}
+		}
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if property, ok := properties[key].(map[string]any); ok {
+				errs = append(errs, validateSchema(property, v[key], path+"."+key)...)
+			} else if additional, ok := schema["additionalProperties"].(map[string]any); ok {
+				errs = append(errs, validateSchema(additional, v[key], path+"."+key)...)
+			} else if schema["additionalProperties"] == false {
+				errs = append(errs, fmt.Sprintf("%s: unknown %q", path, key))
+			}
+		}
+	}
+	return errs
+}
+
+// matchesType - check the value against the type or list of types of the schema
+func matchesType(types any, value any) bool {
+	if list, ok := types.([]any); ok {
+		for _, t := range list {
+			if matchesType(t, value) {
+				return true
+			}
+		}
+		return false
+	}
+	name := jsonTypeName(value)
+	return name == types || (types == "number" && name == "integer")
+}
+
+// jsonTypeName - JSON Schema type of the decoded value
+func jsonTypeName(value any) string {
+	switch v := value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case string:
+		return "string"
+	case float64:
+		if v == math.Trunc(v) {
+			return "integer"
+		}
+		return "number"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+// validateNdjson - errors of the NDJSON lines against the offer schema of the flat layout
+func validateNdjson(schema map[string]any, content []byte) ([]string, error) {
+	properties, _ := schema["properties"].(map[string]any)
+	goods, _ := properties["goods"].(map[string]any)
+	items, ok := goods["items"].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("no goods items in the schema")
+	}
+	var errs []string
+	for i, line := range bytes.Split(content, []byte("\n")) {
+		if len(bytes.TrimSpace(line)) == 0 {
+			continue
+		}
+		var item any
+		if err := json.Unmarshal(line, &item); err != nil {
+			return nil, fmt.Errorf("line %d: %w", i+1, err)
+		}
+		errs = append(errs, validateSchema(items, item, fmt.Sprintf("line %d", i+1))...)
+	}
+	return errs, nil
+}
+
+// writeOutputSchema - publish the schema next to the JSON output
+func writeOutputSchema(snap *outputSnapshot, filename string) error {
+	content, err := json.MarshalIndent(outputSchema(), "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, append(content, '\n'))
+}
+
+// runValidateOutput - check a JSON output against the schema
+func runValidateOutput(args []string) error {
+	flags := flag.NewFlagSet("validate-output", flag.ExitOnError)
+	schemaFile := flags.String("schema", "", "JSON Schema file, default the schema of this build")
+	printSchema := flags.Bool("print-schema", false, "print the schema of this build and exit")
+	positional := parseInterspersed(flags, args)
+
+	if *printSchema {
+		content, err := json.MarshalIndent(outputSchema(), "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(content))
+		return nil
+	}
+	// the validator reads the schema as decoded from JSON, the built-in one makes a round trip
+	content, _ := json.Marshal(outputSchema())
+	if *schemaFile != "" {
+		var err error
+		if content, err = os.ReadFile(*schemaFile); err != nil {
+			return err
+		}
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(content, &schema); err != nil {
+		return fmt.Errorf("parsing %s: %w", *schemaFile, err)
+	}
+
+	filename := config.OutputJson
+	if len(positional) > 0 {
+		filename = positional[0]
+	}
+	content, err := os.ReadFile(filename)
+	if err != nil {
+		return err
+	}
+	var errs []string
+	if strings.HasSuffix(filename, ".ndjson") {
+		errs, err = validateNdjson(schema, content)
+	} else {
+		var output any
+		err = json.Unmarshal(content, &output)
+		errs = validateSchema(schema, output, "$")
+	}
+	if err != nil {
+		return fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	if len(errs) == 0 {
+		fmt.Printf("✅ %s is valid\n", filename)
+		return nil
+	}
+	for i, e := range errs {
+		if i == SCHEMA_MAX_ERRORS {
+			fmt.Printf("   ... %d more\n", len(errs)-i)
+			break
+		}
+		fmt.Printf("❌ %s\n", e)
+	}
+	return fmt.Errorf("[%s] %d schema errors", filename, len(errs))
+}
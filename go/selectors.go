@@ -0,0 +1,293 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/andybalholm/cascadia"
+)
+
+// selector profile overriding the built-in selectors, see loadSelectors
+const SELECTORS_FILE = "selectors.json"
+
+// page layouts
+const (
+	LAYOUT_DESKTOP = "desktop"
+	LAYOUT_MOBILE  = "mobile"
+)
+
+// selectorSet - CSS selectors of one site layout, the fields are chains of fallbacks
+type selectorSet struct {
+	layout string
+
+	Listing       string        `json:"listing"`      // result listing, present on the empty results too, "" = not checked
+	Group         string        `json:"group"`        // product group, .notactive groups are skipped
+	Name          selectorChain `json:"name"`         // product name link (text + href)
+	Image         selectorChain `json:"image"`        // product image
+	ImageAttr     string        `json:"image_attr"`   // attribute with the image URL
+	Offer         string        `json:"offer"`        // offer row within the group
+	HiddenOffer   string        `json:"hidden_offer"` // rows collapsed behind "zobrazit další", see --hidden-offers
+	Price         selectorChain `json:"price"`
+	PricePerUnit  selectorChain `json:"price_per_unit"`
+	Discount      selectorChain `json:"discount"`
+	Volume        selectorChain `json:"volume"`
+	Note          selectorChain `json:"note"`
+	Club          selectorChain `json:"club"`
+	Validity      selectorChain `json:"validity"`
+	Market        selectorChain `json:"market"`
+	OriginalPrice selectorChain `json:"original_price"` // crossed-out price before the discount
+}
+
+// selectorChain - selectors tried in order until one matches, a JSON string or array
+type selectorChain []string
+
+// UnmarshalJSON - parse one selector or the list
+func (c *selectorChain) UnmarshalJSON(data []byte) error {
+	var selector string
+	if err := json.Unmarshal(data, &selector); err == nil {
+		*c = selectorChain{selector}
+		return nil
+	}
+	var chain []string
+	if err := json.Unmarshal(data, &chain); err != nil {
+		return err
+	}
+	*c = chain
+	return nil
+}
+
+// selectorField - named chain of the set
+type selectorField struct {
+	name  string
+	chain selectorChain
+}
+
+// fields - the chains in the report order
+func (sel selectorSet) fields() []selectorField {
+	return []selectorField{{"name", sel.Name}, {"image", sel.Image}, {"price", sel.Price}, {"price_per_unit", sel.PricePerUnit},
+		{"discount", sel.Discount}, {"volume", sel.Volume}, {"note", sel.Note}, {"club", sel.Club},
+		{"validity", sel.Validity}, {"market", sel.Market}, {"original_price", sel.OriginalPrice}}
+}
+
+// selectors by layout, the built-in ones with the profile applied
+var selectorSets = loadDefaultSelectors()
+
+// built-in selectors by layout
+var defaultSelectorSets = map[string]selectorSet{
+	LAYOUT_DESKTOP: {
+		layout:        LAYOUT_DESKTOP,
+		Listing:       "div.discounts_list",
+		Group:         "div.group_discounts",
+		Name:          selectorChain{"div.product_name h2 a"},
+		Image:         selectorChain{"div.product_image a img"},
+		ImageAttr:     "data-src",
+		Offer:         ".discount_row",
+		HiddenOffer:   ".discount_row_hidden, .discounts_more .discount_row_more",
+		Price:         selectorChain{".discount_price_value"},
+		PricePerUnit:  selectorChain{".price_per_unit"},
+		Discount:      selectorChain{".discount_percentage"},
+		Volume:        selectorChain{".discount_amount"},
+		Note:          selectorChain{".discount_note"},
+		Club:          selectorChain{".discounts_club"},
+		Validity:      selectorChain{".discounts_validity"},
+		Market:        selectorChain{".discounts_shop_name a span"},
+		OriginalPrice: selectorChain{".discount_price_original", ".discount_price_before"},
+	},
+	LAYOUT_MOBILE: {
+		layout:        LAYOUT_MOBILE,
+		Group:         "div.product_discounts, div.group_discounts",
+		Name:          selectorChain{".product_name a", "h2 a"},
+		Image:         selectorChain{".product_image img", "img.product_img"},
+		ImageAttr:     "data-src",
+		Offer:         ".discount_row, .discount_item",
+		HiddenOffer:   ".discount_row_hidden, .discount_item_hidden",
+		Price:         selectorChain{".discount_price_value", ".price_value"},
+		PricePerUnit:  selectorChain{".price_per_unit", ".unit_price"},
+		Discount:      selectorChain{".discount_percentage", ".percentage"},
+		Volume:        selectorChain{".discount_amount", ".amount"},
+		Note:          selectorChain{".discount_note", ".note"},
+		Club:          selectorChain{".discounts_club", ".club"},
+		Validity:      selectorChain{".discounts_validity", ".validity"},
+		Market:        selectorChain{".discounts_shop_name a span", ".shop_name"},
+		OriginalPrice: selectorChain{".discount_price_original", ".discount_price_before", ".original_price"},
+	},
+}
+
+// loadDefaultSelectors - copy of the built-in selectors
+func loadDefaultSelectors() map[string]selectorSet {
+	sets := make(map[string]selectorSet)
+	for layout, sel := range defaultSelectorSets {
+		sets[layout] = sel
+	}
+	return sets
+}
+
+// loadSelectors - apply the selector profile to the built-in selectors, fields missing in the profile are kept
+func loadSelectors(filename string) error {
+	selectorSets = loadDefaultSelectors()
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var profile map[string]json.RawMessage
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	for layout, raw := range profile {
+		sel, ok := selectorSets[layout]
+		if !ok {
+			return fmt.Errorf("[%s] unknown layout %q, use %s | %s", filename, layout, LAYOUT_DESKTOP, LAYOUT_MOBILE)
+		}
+		if err := json.Unmarshal(raw, &sel); err != nil {
+			return fmt.Errorf("[%s] %s: %w", filename, layout, err)
+		}
+		if err := sel.validate(); err != nil {
+			return fmt.Errorf("[%s] %s: %w", filename, layout, err)
+		}
+		selectorSets[layout] = sel
+	}
+	return nil
+}
+
+// validate - check that the selectors parse
+func (sel selectorSet) validate() error {
+	fields := []selectorField{{"group", selectorChain{sel.Group}}, {"offer", selectorChain{sel.Offer}}}
+	if sel.Listing != "" {
+		fields = append(fields, selectorField{"listing", selectorChain{sel.Listing}})
+	}
+	if sel.HiddenOffer != "" {
+		fields = append(fields, selectorField{"hidden_offer", selectorChain{sel.HiddenOffer}})
+	}
+	for _, field := range append(fields, sel.fields()...) {
+		if len(field.chain) == 0 {
+			return fmt.Errorf("%s: no selector", field.name)
+		}
+		for _, selector := range field.chain {
+			if _, err := cascadia.ParseGroup(selector); err != nil {
+				return fmt.Errorf("%s selector %q: %w", field.name, selector, err)
+			}
+		}
+	}
+	return nil
+}
+
+// layoutBroken - page without extracted goods not recognized as a listing of the layout: the listing is missing,
+// or its groups are there but yield no offers (dying selectors); an empty listing of a query is not broken
+func layoutBroken(body []byte, sel selectorSet) bool {
+	doc, err := goquery.NewDocumentFromReader(bytes.NewReader(body))
+	if err != nil {
+		return true
+	}
+	if sel.Listing != "" && doc.Find(sel.Listing).Length() == 0 {
+		return true
+	}
+	return doc.Find(sel.Group).Not(".notactive").Length() > 0
+}
+
+// customSelectors - check if the profile changed the selectors of the layout
+func customSelectors(layout string) bool {
+	return !reflect.DeepEqual(selectorSets[layout], defaultSelectorSets[layout])
+}
+
+// runSelectors - print the selectors in effect, a starting point for the profile
+func runSelectors(args []string) error {
+	flags := flag.NewFlagSet("selectors", flag.ExitOnError)
+	parseInterspersed(flags, args)
+	content, err := json.MarshalIndent(selectorSets, "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(content))
+	return nil
+}
+
+// selectorHealth - matches of the chains by "layout field", one count per selector plus the misses
+type selectorHealth map[string][]int
+
+// find - first selector of the chain matching within s, recording which one matched
+func (h selectorHealth) find(layout string, field string, chain selectorChain, s *goquery.Selection) *goquery.Selection {
+	key := layout + " " + field
+	counts := h[key]
+	if counts == nil {
+		counts = make([]int, len(chain)+1)
+		h[key] = counts
+	}
+	found := s.Find(chain[0])
+	for i, selector := range chain {
+		if i > 0 {
+			found = s.Find(selector)
+		}
+		if found.Length() > 0 {
+			counts[i]++
+			return found
+		}
+	}
+	counts[len(chain)]++
+	return found
+}
+
+// selectorHealthLines - hit rates of the chains, dying primary selectors are flagged
+func selectorHealthLines(h selectorHealth) []string {
+	var lines []string
+	for _, layout := range []string{LAYOUT_DESKTOP, LAYOUT_MOBILE} {
+		for _, field := range selectorSets[layout].fields() {
+			counts, ok := h[layout+" "+field.name]
+			if !ok {
+				continue
+			}
+			total := 0
+			for _, n := range counts {
+				total += n
+			}
+			misses := counts[len(counts)-1]
+			line := fmt.Sprintf("%-7s %-15s %5.1f%% of %d", layout, field.name, percentOf(total-misses, total), total)
+			if len(counts) > 2 {
+				var parts []string
+				for i, n := range counts[:len(counts)-1] {
+					parts = append(parts, fmt.Sprintf("#%d %.1f%%", i+1, percentOf(n, total)))
+				}
+				line += " (" + strings.Join(parts, ", ") + ")"
+				if counts[0] == 0 && total > misses {
+					line += " ⚠️ primary selector dead"
+				}
+			}
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+// percentOf - n in % of total
+func percentOf(n int, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(n) * 100 / float64(total)
+}
+
+// offerSelector - offer rows of the layout, including the collapsed ones with --hidden-offers
+func (sel selectorSet) offerSelector() string {
+	if *hiddenOffersFlag && sel.HiddenOffer != "" {
+		return sel.Offer + ", " + sel.HiddenOffer
+	}
+	return sel.Offer
+}
+
+// mobileSiteUrl - the same page on the mobile site
+func mobileSiteUrl(desktopUrl string) string {
+	return strings.Replace(desktopUrl, KOOPI_HOME_URL, KOOPI_MOBILE_URL, 1)
+}
+
+// mobileCacheName - cache name of the mobile site page
+func mobileCacheName(cacheName string) string {
+	return LAYOUT_MOBILE + "-" + cacheName
+}
@@ -0,0 +1,22 @@
+package main
+
+import "testing"
+
+func TestLayoutBroken(t *testing.T) {
+	desktop := defaultSelectorSets[LAYOUT_DESKTOP]
+	tests := []struct {
+		page   string
+		broken bool
+	}{
+		{`<html><body><div class="discounts_list"></div></body></html>`, false}, // no results of the query
+		{`<html><body><div class="discounts_list"><div class="group_discounts notactive"></div></div></body></html>`, false},
+		{`<html><body><div class="app-root"></div></body></html>`, true}, // another layout or a JS shell
+		{`<html><body><div class="discounts_list"><div class="group_discounts"><div class="renamed"></div></div></div></body></html>`, true},
+	}
+	for _, tt := range tests {
+		if broken := layoutBroken([]byte(tt.page), desktop); broken != tt.broken {
+			t.Errorf("%s: broken %v, want %v", tt.page, broken, tt.broken)
+		}
+	}
+
+}
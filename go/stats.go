@@ -0,0 +1,265 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	PROGRESS_INTERVAL = 15 * time.Second
+	STATS_FILE        = "stats.json"
+)
+
+// runStats - counters updated by the workers during the run
+type runStats struct {
+	pages     atomic.Int64 // pages processed
+	cacheHits atomic.Int64 // pages served from the cache
+	fetched   atomic.Int64 // pages downloaded
+	bytes     atomic.Int64 // downloaded HTML bytes
+	items     atomic.Int64 // goods extracted
+	filtered  atomic.Int64 // groups and offers dropped by blocked goods/markets
+	errors    atomic.Int64 // failed downloads and extractions
+
+	rateLimited    atomic.Int64 // 429 responses
+	rateLimitPause atomic.Int64 // total pause of the fetches in ns
+
+	mutex     sync.Mutex
+	queries   map[string]*queryCacheStats
+	stages    []stageTiming            // wall clock, in the pipeline order
+	workers   map[string]time.Duration // summed over the worker threads
+	selectors selectorHealth           // selector chain matches, goquery parser only
+}
+
+// stageTiming - wall-clock time of a pipeline stage
+type stageTiming struct {
+	Stage    string        `json:"stage"`
+	Duration time.Duration `json:"-"`
+	Seconds  float64       `json:"seconds"`
+}
+
+// queryCacheStats - page sources of one query
+type queryCacheStats struct {
+	hits    int // served from the cache
+	network int // downloaded
+	expired int // cache misses because of the TTL
+	missing int // cache misses, not cached at all
+}
+
+// current run stats, reset by setupRun
+var stats = newRunStats()
+
+// newRunStats - empty stats
+func newRunStats() *runStats {
+	return &runStats{queries: make(map[string]*queryCacheStats), workers: make(map[string]time.Duration), selectors: make(selectorHealth)}
+}
+
+// addSelectorHealth - merge the selector matches of a page
+func (s *runStats) addSelectorHealth(h selectorHealth) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for key, counts := range h {
+		total := s.selectors[key]
+		if len(total) != len(counts) {
+			total = make([]int, len(counts))
+			s.selectors[key] = total
+		}
+		for i, n := range counts {
+			total[i] += n
+		}
+	}
+}
+
+// selectorReport - print the hit rates of the selector chains
+func (s *runStats) selectorReport() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	lines := selectorHealthLines(s.selectors)
+	if len(lines) == 0 {
+		return
+	}
+	fmt.Printf("\n🩺 selectors:\n")
+	for _, line := range lines {
+		fmt.Printf("   %s\n", line)
+	}
+}
+
+// stageDone - record the wall-clock time of the pipeline stage started at start
+func (s *runStats) stageDone(stage string, start time.Time) {
+	d := time.Since(start)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.stages = append(s.stages, stageTiming{stage, d, d.Seconds()})
+}
+
+// workerTime - add the time a worker spent in the stage started at start, e.g. defer stats.workerTime("fetch", time.Now())
+func (s *runStats) workerTime(stage string, start time.Time) {
+	d := time.Since(start)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.workers[stage] += d
+}
+
+// timingReport - print where the time of the run went
+func (s *runStats) timingReport() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var parts []string
+	for _, st := range s.stages {
+		parts = append(parts, fmt.Sprintf("%s %s", st.Stage, st.Duration.Round(time.Millisecond)))
+	}
+	fmt.Printf("\n⏱️ %s\n", strings.Join(parts, ", "))
+	parts = nil
+	for _, stage := range WORKER_STAGES {
+		if d, ok := s.workers[stage]; ok {
+			parts = append(parts, fmt.Sprintf("%s %s", stage, d.Round(time.Millisecond)))
+		}
+	}
+	if len(parts) > 0 {
+		fmt.Printf("   workers (summed over threads): %s\n", strings.Join(parts, ", "))
+	}
+}
+
+// worker stages in the report order
+var WORKER_STAGES = []string{"cache", "fetch", "extract", "images"}
+
+// statsRecord - content of STATS_FILE
+type statsRecord struct {
+	Tag       string             `json:"tag,omitempty"`
+	Started   time.Time          `json:"started"`
+	Finished  time.Time          `json:"finished"`
+	Pages     int64              `json:"pages"`
+	CacheHits int64              `json:"cache_hits"`
+	Fetched   int64              `json:"fetched"`
+	Bytes     int64              `json:"bytes"`
+	Items     int64              `json:"items"`
+	Filtered  int64              `json:"filtered"`
+	Errors    int64              `json:"errors"`
+	Stages    []stageTiming      `json:"stages"`
+	Workers   map[string]float64 `json:"workers"`   // seconds summed over the threads
+	Selectors map[string][]int   `json:"selectors"` // matches per selector of the chains, the last count are misses
+}
+
+// save - write the stats of the finished run
+func (s *runStats) save(filename string) error {
+	s.mutex.Lock()
+	rec := statsRecord{Tag: *tagFlag, Started: runStarted, Finished: time.Now(),
+		Pages: s.pages.Load(), CacheHits: s.cacheHits.Load(), Fetched: s.fetched.Load(), Bytes: s.bytes.Load(),
+		Items: s.items.Load(), Filtered: s.filtered.Load(), Errors: s.errors.Load(),
+		Stages: s.stages, Workers: make(map[string]float64), Selectors: s.selectors}
+	for stage, d := range s.workers {
+		rec.Workers[stage] = d.Seconds()
+	}
+	content, err := json.MarshalIndent(rec, "", "  ")
+	s.mutex.Unlock()
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filename, content, 0644)
+}
+
+// query - stats of the query, the caller holds the mutex
+func (s *runStats) query(query string) *queryCacheStats {
+	qs, ok := s.queries[query]
+	if !ok {
+		qs = &queryCacheStats{}
+		s.queries[query] = qs
+	}
+	return qs
+}
+
+// cacheHit - page served from the cache
+func (s *runStats) cacheHit(query string) {
+	s.cacheHits.Add(1)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.query(query).hits++
+}
+
+// cacheMiss - page not in the cache or expired
+func (s *runStats) cacheMiss(query string, expired bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if expired {
+		s.query(query).expired++
+	} else {
+		s.query(query).missing++
+	}
+}
+
+// networkPage - page downloaded
+func (s *runStats) networkPage(query string) {
+	s.fetched.Add(1)
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.query(query).network++
+}
+
+// cacheReport - cache hits and misses of the run, optionally per query
+func (s *runStats) cacheReport(perQuery bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	var total queryCacheStats
+	var names []string
+	for name, qs := range s.queries {
+		total.hits += qs.hits
+		total.network += qs.network
+		total.expired += qs.expired
+		total.missing += qs.missing
+		names = append(names, name)
+	}
+	fmt.Printf("🗂️ cache: %d hits, %d misses (%d expired, %d not cached), %d downloaded\n",
+		total.hits, total.expired+total.missing, total.expired, total.missing, total.network)
+	if !perQuery || len(names) == 0 {
+		return
+	}
+	newCollator().SortStrings(names)
+	fmt.Printf("\n   %-30s %6s %8s %8s %8s\n", "query", "hits", "expired", "missing", "network")
+	for _, name := range names {
+		qs := s.queries[name]
+		fmt.Printf("   %-30s %6d %8d %8d %8d\n", name, qs.hits, qs.expired, qs.missing, qs.network)
+	}
+}
+
+// String - one line summary
+func (s *runStats) String() string {
+	line := fmt.Sprintf("pages %d (cache %d, network %d, %s), items %d, filtered %d, errors %d",
+		s.pages.Load(), s.cacheHits.Load(), s.fetched.Load(), formatBytes(s.bytes.Load()),
+		s.items.Load(), s.filtered.Load(), s.errors.Load())
+	if n := s.rateLimited.Load(); n > 0 {
+		line += fmt.Sprintf(", 429s %d (paused %s)", n, time.Duration(s.rateLimitPause.Load()).Round(time.Second))
+	}
+	return line
+}
+
+// reportProgress - print the stats periodically until done is closed
+func (s *runStats) reportProgress(total int, done <-chan struct{}) {
+	ticker := time.NewTicker(time.Duration(config.ProgressInterval))
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+			log.Printf("⏳ %d/%d %s", s.pages.Load(), total, s)
+		}
+	}
+}
+
+// formatBytes - human readable size
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.1f GB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
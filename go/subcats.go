@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"slices"
+	"strings"
+)
+
+// SubCat rules replacing the built-in ones, see loadSubcatRules
+const SUBCATS_FILE = "subcats.json"
+
+// fields the SubCat rules may match
+var subcatFields = []string{"name", "note", "volume"}
+
+// subcatRule - SubCat of the goods matching the substring or regex, e.g. {"fields": ["note"], "contains": "plech", "subcat": "plech"}
+type subcatRule struct {
+	Fields   []string `json:"fields"` // empty = name and note
+	Contains string   `json:"contains"`
+	Regex    string   `json:"regex"`
+	SubCat   string   `json:"subcat"`
+
+	re *regexp.Regexp
+}
+
+// built-in rules, the first matching rule wins
+var defaultSubcatRules = []subcatRule{
+	{Fields: []string{"note"}, Contains: "plech", SubCat: "plech"},
+	{Fields: []string{"note"}, Contains: "zálohovaná lahev", SubCat: "lahev"},
+}
+
+// rules in effect
+var subcatRules = defaultSubcatRules
+
+// loadSubcatRules - replace the built-in rules by the rules file, the rules are evaluated in order
+func loadSubcatRules(filename string) error {
+	subcatRules = defaultSubcatRules
+	content, err := os.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	var rules []subcatRule
+	if err := json.Unmarshal(content, &rules); err != nil {
+		return fmt.Errorf("parsing %s: %w", filename, err)
+	}
+	for i := range rules {
+		r := &rules[i]
+		if (r.Contains == "") == (r.Regex == "") {
+			return fmt.Errorf("[%s] rule #%d: use one of contains | regex", filename, i+1)
+		}
+		if r.Regex != "" {
+			if r.re, err = regexp.Compile(r.Regex); err != nil {
+				return fmt.Errorf("[%s] rule #%d: %w", filename, i+1, err)
+			}
+		}
+		if len(r.Fields) == 0 {
+			r.Fields = []string{"name", "note"}
+		}
+		for _, field := range r.Fields {
+			if !slices.Contains(subcatFields, field) {
+				return fmt.Errorf("[%s] rule #%d: unknown field %q (use %s)", filename, i+1, field, strings.Join(subcatFields, ", "))
+			}
+		}
+	}
+	subcatRules = rules
+	return nil
+}
+
+// matches - check the rule against the field value
+func (r subcatRule) matches(s string) bool {
+	if r.re != nil {
+		return r.re.MatchString(s)
+	}
+	return strings.Contains(s, r.Contains)
+}
+
+// setSubCat - SubCat of the first matching rule, "" without a match
+func setSubCat(item *Goods) {
+	values := map[string]string{"name": item.Name, "note": item.Note, "volume": item.Volume}
+	item.SubCat = ""
+	for _, r := range subcatRules {
+		for _, field := range r.Fields {
+			if r.matches(values[field]) {
+				item.SubCat = r.SubCat
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// max bytes read at once by a throttled body
+const THROTTLE_CHUNK = 32 * 1024
+
+// bandwidthLimiter - global download bandwidth cap shared by all requests
+type bandwidthLimiter struct {
+	mutex sync.Mutex
+	rate  int64     // bytes per second
+	next  time.Time // time when the reserved bandwidth is used up
+}
+
+// wait - reserve n bytes and wait for their slot
+func (b *bandwidthLimiter) wait(ctx context.Context, n int) error {
+	b.mutex.Lock()
+	now := time.Now()
+	if b.next.Before(now) {
+		b.next = now
+	}
+	delay := b.next.Sub(now)
+	b.next = b.next.Add(time.Duration(int64(n) * int64(time.Second) / b.rate))
+	b.mutex.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// throttledTransport - transport limiting the download bandwidth of response bodies
+type throttledTransport struct {
+	base    http.RoundTripper
+	limiter *bandwidthLimiter
+}
+
+// RoundTrip - wrap the response body with the limiter
+func (t *throttledTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+	res.Body = &throttledBody{ReadCloser: res.Body, ctx: req.Context(), limiter: t.limiter}
+	return res, nil
+}
+
+// throttledBody - response body read at the limited rate
+type throttledBody struct {
+	io.ReadCloser
+	ctx     context.Context
+	limiter *bandwidthLimiter
+}
+
+// Read - read a chunk and wait for its bandwidth slot
+func (b *throttledBody) Read(p []byte) (int, error) {
+	if len(p) > THROTTLE_CHUNK {
+		p = p[:THROTTLE_CHUNK]
+	}
+	n, err := b.ReadCloser.Read(p)
+	if n > 0 {
+		if werr := b.limiter.wait(b.ctx, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+const (
+	RATE_LIMIT_PAUSE     = time.Minute      // pause after a 429 without Retry-After
+	RATE_LIMIT_MAX_PAUSE = 15 * time.Minute // longer Retry-After values are capped
+)
+
+// fetchPause - pause of all fetches after 429 responses
+var fetchPause struct {
+	mutex sync.Mutex
+	until time.Time
+}
+
+// parseRetryAfter - Retry-After in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		return max(date.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// rateLimited - pause all fetches for the Retry-After of the 429 response
+func rateLimited(header http.Header, urlStr string, qlog *queryLogger) {
+	pause, ok := parseRetryAfter(header.Get("Retry-After"), time.Now())
+	if !ok {
+		pause = time.Duration(config.RateLimitPause)
+	}
+	pause = min(pause, time.Duration(config.RateLimitMaxPause))
+	stats.rateLimited.Add(1)
+
+	fetchPause.mutex.Lock()
+	defer fetchPause.mutex.Unlock()
+	until := time.Now().Add(pause)
+	if !until.After(fetchPause.until) {
+		return // already paused long enough
+	}
+	extended := pause
+	if remaining := time.Until(fetchPause.until); remaining > 0 {
+		extended -= remaining
+	}
+	stats.rateLimitPause.Add(int64(extended))
+	fetchPause.until = until
+	qlog.Printf("🚦 429 Too Many Requests %s, pausing all fetches for %s", urlStr, pause.Round(time.Second))
+}
+
+// waitFetchPause - wait for the end of the rate limit pause, false when the context is done
+func waitFetchPause(ctx context.Context) bool {
+	fetchPause.mutex.Lock()
+	wait := time.Until(fetchPause.until)
+	fetchPause.mutex.Unlock()
+	if wait <= 0 {
+		return true
+	}
+	return sleepContext(ctx, wait)
+}
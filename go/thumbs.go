@@ -0,0 +1,124 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chai2010/webp"
+)
+
+// default thumbnail widths in pixels
+var THUMBNAIL_SIZES = []int{80, 160, 320}
+
+// imageThumb - resized variant of the image for the srcset
+type imageThumb struct {
+	Src   string `json:"src"`
+	Width int    `json:"w"`
+}
+
+// thumbName - file name of the resized WebP variant
+func thumbName(fileName string, width int) string {
+	return fmt.Sprintf("%s-%d.webp", strings.TrimSuffix(fileName, filepath.Ext(fileName)), width)
+}
+
+// imageVariants - derived files of the cached image
+func imageVariants(fileName string) []string {
+	variants := []string{webpName(fileName), avifName(fileName)}
+	for _, width := range config.ThumbnailSizes {
+		variants = append(variants, thumbName(fileName, width))
+	}
+	return variants
+}
+
+// ensureThumbnails - encode the missing resized variants, images are never upscaled
+func ensureThumbnails(fileName string) error {
+	if len(config.ThumbnailSizes) == 0 {
+		return nil
+	}
+	file, err := os.Open(filepath.Join(config.ImageCache, fileName))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	imgConfig, _, err := image.DecodeConfig(file)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", fileName, err)
+	}
+	var missing []int
+	for _, width := range config.ThumbnailSizes {
+		if width >= imgConfig.Width {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(config.ImageCache, thumbName(fileName, width))); err != nil {
+			missing = append(missing, width)
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", fileName, err)
+	}
+	for _, width := range missing {
+		var buf bytes.Buffer
+		if err := webp.Encode(&buf, resizeImage(img, width), &webp.Options{Quality: config.WebpQuality, Lossless: config.WebpLossless}); err != nil {
+			return fmt.Errorf("encoding %s: %w", thumbName(fileName, width), err)
+		}
+		if err := writeFileAtomic(filepath.Join(config.ImageCache, thumbName(fileName, width)), buf.Bytes()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resizeImage - downscale to the width keeping the aspect ratio, box filter
+func resizeImage(src image.Image, width int) *image.NRGBA {
+	b := src.Bounds()
+	height := max(1, b.Dy()*width/b.Dx())
+	dst := image.NewNRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		y0 := b.Min.Y + y*b.Dy()/height
+		y1 := max(y0+1, b.Min.Y+(y+1)*b.Dy()/height)
+		for x := range width {
+			x0 := b.Min.X + x*b.Dx()/width
+			x1 := max(x0+1, b.Min.X+(x+1)*b.Dx()/width)
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					c := color.NRGBA64Model.Convert(src.At(sx, sy)).(color.NRGBA64)
+					r, g, bl, a = r+uint64(c.R), g+uint64(c.G), bl+uint64(c.B), a+uint64(c.A)
+					n++
+				}
+			}
+			dst.SetNRGBA(x, y, color.NRGBA{uint8(r / n >> 8), uint8(g / n >> 8), uint8(bl / n >> 8), uint8(a / n >> 8)})
+		}
+	}
+	return dst
+}
+
+// imageThumbs - existing resized variants of the output image for the srcset
+func imageThumbs(imageUrl string) []imageThumb {
+	fileName := cachedImageFile(imageUrl)
+	if fileName == "" {
+		return nil
+	}
+	var thumbs []imageThumb
+	for _, width := range config.ThumbnailSizes {
+		name := thumbName(fileName, width)
+		if _, err := os.Stat(filepath.Join(config.ImageCache, name)); err == nil {
+			thumbs = append(thumbs, imageThumb{name, width})
+		}
+	}
+	return thumbs
+}
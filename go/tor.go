@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	TOR_SOCKS        = "127.0.0.1:9050"
+	TOR_CONTROL      = "127.0.0.1:9051"
+	TOR_CONTROL_WAIT = 10 * time.Second
+)
+
+// pages fetched over Tor since the last circuit rotation
+var (
+	torPages atomic.Int64
+	torMutex sync.Mutex
+)
+
+// torEnabled - fetch everything through the Tor SOCKS proxy
+func torEnabled() bool {
+	return *torFlag || config.Tor
+}
+
+// torProxy - transport proxy for the Tor SOCKS port, host names are resolved by Tor
+func torProxy() func(*http.Request) (*url.URL, error) {
+	return http.ProxyURL(&url.URL{Scheme: "socks5", Host: config.TorSocks})
+}
+
+// torNewnym - ask the Tor daemon for new circuits
+func torNewnym() error {
+	conn, err := net.DialTimeout("tcp", config.TorControl, TOR_CONTROL_WAIT)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(TOR_CONTROL_WAIT))
+
+	auth := "AUTHENTICATE"
+	switch {
+	case config.TorCookieFile != "":
+		cookie, err := os.ReadFile(config.TorCookieFile)
+		if err != nil {
+			return err
+		}
+		auth += " " + hex.EncodeToString(cookie)
+	case config.TorPassword != "":
+		auth += fmt.Sprintf(" %q", config.TorPassword)
+	}
+
+	reader := bufio.NewReader(conn)
+	for _, line := range []string{auth, "SIGNAL NEWNYM"} {
+		if _, err := fmt.Fprintf(conn, "%s\r\n", line); err != nil {
+			return err
+		}
+		reply, err := reader.ReadString('\n')
+		if err != nil {
+			return err
+		}
+		if !strings.HasPrefix(reply, "250") {
+			return fmt.Errorf("tor control: %s", strings.TrimSpace(reply))
+		}
+	}
+	fmt.Fprintf(conn, "QUIT\r\n")
+	return nil
+}
+
+// torRotate - rotate the circuits every TorNewnymEvery fetched pages
+func torRotate(qlog *queryLogger) {
+	if !torEnabled() || config.TorNewnymEvery <= 0 || config.TorControl == "" {
+		return
+	}
+	if torPages.Add(1)%int64(config.TorNewnymEvery) != 0 {
+		return
+	}
+	torMutex.Lock()
+	defer torMutex.Unlock()
+	if err := torNewnym(); err != nil {
+		qlog.Printf("🧅 💥 circuit rotation failed: %v", err)
+		return
+	}
+	httpClient.CloseIdleConnections() // kept-alive connections use the old circuits
+	qlog.Printf("🧅 new Tor circuits")
+}
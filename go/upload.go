@@ -0,0 +1,308 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	UPLOAD_STATE_FILE = "uploaded.json" // key -> MD5 of the uploaded content
+	UPLOAD_THREADS    = 4
+	UPLOAD_TIMEOUT    = 2 * time.Minute
+	UPLOAD_REGION     = "us-east-1"
+)
+
+// content types missing from minimal mime tables
+var uploadContentTypes = map[string]string{
+	".avif": "image/avif",
+	".csv":  "text/csv; charset=utf-8",
+	".gif":  "image/gif",
+	".jpeg": "image/jpeg",
+	".jpg":  "image/jpeg",
+	".json": "application/json",
+	".png":  "image/png",
+	".webp": "image/webp",
+}
+
+// image variants referenced by the outputs: WebP, its thumbnails and AVIF, the downloaded originals are not uploaded
+var uploadImageExtensions = map[string]bool{".webp": true, ".avif": true}
+
+// uploadFile - local file and its object key below the prefix
+type uploadFile struct {
+	path      string
+	key       string
+	immutable bool // content-addressed images, cached forever by the browsers
+}
+
+// s3Client - minimal S3 PUT client signing with AWS Signature V4, path-style URLs
+type s3Client struct {
+	endpoint  *url.URL
+	bucket    string
+	region    string
+	accessKey string
+	secretKey string
+	client    *http.Client
+}
+
+// newS3Client - client for the configured bucket, credentials default to the AWS_* variables
+func newS3Client() (*s3Client, error) {
+	if config.UploadEndpoint == "" || config.UploadBucket == "" {
+		return nil, errors.New("upload_endpoint and upload_bucket are not configured")
+	}
+	endpoint, err := url.Parse(config.UploadEndpoint)
+	if err != nil || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid upload_endpoint %q", config.UploadEndpoint)
+	}
+	c := &s3Client{endpoint: endpoint, bucket: config.UploadBucket, region: config.UploadRegion,
+		accessKey: config.UploadAccessKey, secretKey: config.UploadSecretKey, client: &http.Client{Timeout: UPLOAD_TIMEOUT}}
+	if c.accessKey == "" {
+		c.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+	}
+	if c.secretKey == "" {
+		c.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+	}
+	if c.accessKey == "" || c.secretKey == "" {
+		return nil, errors.New("no upload credentials, set upload_access_key/upload_secret_key or AWS_ACCESS_KEY_ID/AWS_SECRET_ACCESS_KEY")
+	}
+	return c, nil
+}
+
+// put - upload the object
+func (c *s3Client) put(ctx context.Context, key string, content []byte, header http.Header) error {
+	objectUrl := *c.endpoint
+	objectUrl.Path = strings.TrimSuffix(c.endpoint.Path, "/") + "/" + c.bucket + "/" + key
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, objectUrl.String(), bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	for name, values := range header {
+		req.Header[name] = values
+	}
+	hash := sha256.Sum256(content)
+	signS3Request(req, hex.EncodeToString(hash[:]), c.accessKey, c.secretKey, c.region, time.Now())
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("%w %s", &httpStatusError{resp.StatusCode, resp.Status}, bytes.TrimSpace(body))
+	}
+	return nil
+}
+
+// signS3Request - add the AWS Signature V4 headers, all request headers are signed
+func signS3Request(req *http.Request, payloadHash string, accessKey string, secretKey string, region string, now time.Time) {
+	amzDate := now.UTC().Format("20060102T150405Z")
+	date := amzDate[:8]
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	var names []string
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{req.Method, s3EscapePath(req.URL.Path), req.URL.Query().Encode(),
+		canonicalHeaders.String(), signedHeaders, payloadHash}, "\n")
+	scope := date + "/" + region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{date, region, "s3", "aws4_request"} {
+		key = hmacSha256(key, part)
+	}
+	signature := hex.EncodeToString(hmacSha256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, signature))
+}
+
+// hmacSha256 - HMAC of the data
+func hmacSha256(key []byte, data string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(data))
+	return h.Sum(nil)
+}
+
+// s3EscapePath - URI-encode the path segments, only the unreserved characters are kept
+func s3EscapePath(path string) string {
+	var b strings.Builder
+	for i := 0; i < len(path); i++ {
+		c := path[i]
+		if c == '/' || c == '-' || c == '_' || c == '.' || c == '~' ||
+			'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+			b.WriteByte(c)
+		} else {
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// uploadFiles - the outputs and the image variants of the cache with their object keys
+func uploadFiles() ([]uploadFile, error) {
+	prefix := strings.Trim(config.UploadPrefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	var files []uploadFile
+	for _, output := range []string{config.OutputJson, config.OutputSchema, config.OutputNdjson, config.OutputXml, config.OutputCsv, config.OutputImages} {
+		if output != "" {
+			files = append(files, uploadFile{output, prefix + filepath.Base(output), false})
+		}
+	}
+	entries, err := os.ReadDir(config.ImageCache)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.Type().IsRegular() || !uploadImageExtensions[strings.ToLower(filepath.Ext(name))] {
+			continue
+		}
+		files = append(files, uploadFile{filepath.Join(config.ImageCache, name), prefix + "images/" + name, true})
+	}
+	return files, nil
+}
+
+// loadUploadState - MD5 of the uploaded objects, a missing file is empty
+func loadUploadState(filename string) map[string]string {
+	state := make(map[string]string)
+	if content, err := os.ReadFile(filename); err == nil {
+		json.Unmarshal(content, &state)
+	}
+	return state
+}
+
+// uploadAll - upload the changed outputs and images, returns the number of uploaded files, or of the files to upload
+// with dryRun
+func uploadAll(ctx context.Context, force bool, dryRun bool) (int, error) {
+	c, err := newS3Client()
+	if err != nil {
+		return 0, err
+	}
+	files, err := uploadFiles()
+	if err != nil {
+		return 0, err
+	}
+	state := loadUploadState(statePath(config.UploadStateFile))
+
+	var wg sync.WaitGroup
+	var mutex sync.Mutex
+	var errs []error
+	uploaded, unchanged := 0, 0
+	tasks := make(chan uploadFile)
+	for range UPLOAD_THREADS {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range tasks {
+				content, err := os.ReadFile(f.path)
+				if err != nil {
+					mutex.Lock()
+					errs = append(errs, err)
+					mutex.Unlock()
+					continue
+				}
+				sum := md5.Sum(content)
+				md5hex := hex.EncodeToString(sum[:])
+				mutex.Lock()
+				if state[f.key] == md5hex && !force {
+					unchanged++
+					mutex.Unlock()
+					continue
+				}
+				if dryRun {
+					uploaded++
+					mutex.Unlock()
+					fmt.Println(f.key)
+					continue
+				}
+				mutex.Unlock()
+				header := http.Header{}
+				if contentType := uploadContentTypes[strings.ToLower(filepath.Ext(f.path))]; contentType != "" {
+					header.Set("Content-Type", contentType)
+				}
+				if f.immutable {
+					header.Set("Cache-Control", "public, max-age=31536000, immutable")
+				} else {
+					header.Set("Cache-Control", "no-cache")
+				}
+				err = c.put(ctx, f.key, content, header)
+				mutex.Lock()
+				if err != nil {
+					errs = append(errs, fmt.Errorf("[%s] %w", f.key, err))
+				} else {
+					state[f.key] = md5hex
+					uploaded++
+				}
+				mutex.Unlock()
+			}
+		}()
+	}
+	for _, f := range files {
+		if ctx.Err() != nil {
+			break
+		}
+		tasks <- f
+	}
+	close(tasks)
+	wg.Wait()
+
+	if !dryRun && uploaded > 0 {
+		content, err := json.MarshalIndent(state, "", "  ")
+		if err == nil {
+			err = os.WriteFile(statePath(config.UploadStateFile), content, 0644)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("[%s] %w", config.UploadStateFile, err))
+		}
+	}
+	if dryRun {
+		log.Printf("☁️ %d of %d files to upload to %s, %d unchanged, %d failed", uploaded, len(files), c.bucket, unchanged, len(errs))
+	} else {
+		log.Printf("☁️ %d of %d files uploaded to %s, %d unchanged, %d failed", uploaded, len(files), c.bucket, unchanged, len(errs))
+	}
+	return uploaded, errors.Join(errs...)
+}
+
+// runUpload - upload the outputs and the image variants to the configured bucket
+func runUpload(args []string) error {
+	flags := flag.NewFlagSet("upload", flag.ExitOnError)
+	force := flags.Bool("force", false, "upload all files, not only the changed ones")
+	dryRun := flags.Bool("dry-run", false, "only print the keys to upload")
+	parseInterspersed(flags, args)
+	_, err := uploadAll(context.Background(), *force, *dryRun)
+	return err
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	VALIDITY_DATE   = "2006-01-02" // ISO format of valid_from and valid_to
+	SCRAPED_AT_DATE = "20060102"   // Goods.ScrapedAt
+)
+
+var (
+	reValidityDate = regexp.MustCompile(`(\d{1,2})\.\s*(\d{1,2})\.(?:\s*(\d{4}))?`)
+	reValidityFrom = regexp.MustCompile(`(?:^|\s)od\s`)
+	reValidityTo   = regexp.MustCompile(`(?:^|\s)do\s`)
+)
+
+// Czech weekday stems, all cases ("od čtvrtka", "do neděle", "v pátek")
+var validityWeekdays = []struct {
+	stem    string
+	weekday time.Weekday
+}{
+	{"pondě", time.Monday}, {"úter", time.Tuesday}, {"střed", time.Wednesday}, {"čtvrt", time.Thursday},
+	{"pát", time.Friday}, {"sobot", time.Saturday}, {"neděl", time.Sunday},
+}
+
+// parseValidity - ISO start and end dates of the validity text, "" = unknown
+//
+//	"platí od čtvrtka 16. 1. do 22. 1." -> 2025-01-16, 2025-01-22
+//	"platí do neděle"                   -> "", the next Sunday
+//	"zítra končí"                       -> "", the day after scrapedAt
+//
+// dates without a year are the nearest to scrapedAt (YYYYMMDD, today if invalid)
+func parseValidity(text string, scrapedAt string) (string, string) {
+	ref, err := time.ParseInLocation(SCRAPED_AT_DATE, scrapedAt, time.Local)
+	if err != nil {
+		now := time.Now()
+		ref = time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	}
+	text = strings.ToLower(strings.Join(strings.Fields(text), " ")) + " "
+
+	var fromText, toText string
+	fromMatch := reValidityFrom.FindStringIndex(text)
+	toMatch := reValidityTo.FindStringIndex(text)
+	switch {
+	case fromMatch != nil && toMatch != nil && fromMatch[0] < toMatch[0]:
+		fromText, toText = text[fromMatch[1]:toMatch[0]], text[toMatch[1]:]
+	case fromMatch != nil:
+		fromText = text[fromMatch[1]:]
+	case toMatch != nil:
+		toText = text[toMatch[1]:]
+	case strings.Contains(text, "končí"):
+		toText = text
+	}
+
+	from, fromOk := validityDay(fromText, ref, time.Time{})
+	to, toOk := validityDay(toText, ref, from)
+	var validFrom, validTo string
+	if fromOk {
+		validFrom = from.Format(VALIDITY_DATE)
+	}
+	if toOk {
+		validTo = to.Format(VALIDITY_DATE)
+	}
+	return validFrom, validTo
+}
+
+// validityDay - day of the validity part, the end day is not before the start day
+func validityDay(text string, ref time.Time, start time.Time) (time.Time, bool) {
+	if text == "" {
+		return time.Time{}, false
+	}
+	if m := reValidityDate.FindStringSubmatch(text); m != nil {
+		day, _ := strconv.Atoi(m[1])
+		month, _ := strconv.Atoi(m[2])
+		if day < 1 || day > 31 || month < 1 || month > 12 {
+			return time.Time{}, false
+		}
+		if m[3] != "" {
+			year, _ := strconv.Atoi(m[3])
+			return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.Local), true
+		}
+		date := time.Date(ref.Year(), time.Month(month), day, 0, 0, 0, 0, time.Local)
+		if date.After(ref.AddDate(0, 6, 0)) {
+			date = date.AddDate(-1, 0, 0)
+		}
+		if date.Before(ref.AddDate(0, -6, 0)) {
+			date = date.AddDate(1, 0, 0)
+		}
+		if !start.IsZero() && date.Before(start) {
+			date = date.AddDate(1, 0, 0) // "od 28. 12. do 3. 1."
+		}
+		return date, true
+	}
+	switch {
+	case strings.Contains(text, "dnes"):
+		return ref, true
+	case strings.Contains(text, "zítra") || strings.Contains(text, "zítř"):
+		return ref.AddDate(0, 0, 1), true
+	}
+	for _, word := range strings.Fields(text) {
+		for _, w := range validityWeekdays {
+			if strings.HasPrefix(word, w.stem) {
+				days := (int(w.weekday) - int(ref.Weekday()) + 7) % 7
+				return ref.AddDate(0, 0, days), true
+			}
+		}
+	}
+	return time.Time{}, false
+}
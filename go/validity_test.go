@@ -0,0 +1,30 @@
+package main
+
+import "testing"
+
+func TestParseValidity(t *testing.T) {
+	tests := []struct {
+		text      string
+		scrapedAt string
+		from, to  string
+	}{
+		{"platí od čtvrtka 16. 1. do 22. 1.", "20250115", "2025-01-16", "2025-01-22"},
+		{"platí do neděle", "20250115", "", "2025-01-19"},
+		{"zítra končí", "20250115", "", "2025-01-16"},
+		{"dnes končí", "20250115", "", "2025-01-15"},
+		{"od pátku", "20250115", "2025-01-17", ""},
+		{"od 28. 12. do 3. 1.", "20241220", "2024-12-28", "2025-01-03"}, // over the new year
+		{"platí do 30. 12.", "20250103", "", "2024-12-30"},              // the nearest date is last year
+		{"od 2. 1. 2026 do 8. 1. 2026", "20250115", "2026-01-02", "2026-01-08"},
+		{"platí  od  16. 1.\n do 22. 1.", "20250115", "2025-01-16", "2025-01-22"},
+		{"platí do 32. 1.", "20250115", "", ""},
+		{"platí v pátek", "20250115", "", ""},
+		{"", "20250115", "", ""},
+	}
+	for _, tt := range tests {
+		from, to := parseValidity(tt.text, tt.scrapedAt)
+		if from != tt.from || to != tt.to {
+			t.Errorf("parseValidity(%q, %s) = %q, %q, want %q, %q", tt.text, tt.scrapedAt, from, to, tt.from, tt.to)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const VERIFY_TIMEOUT = 15 * time.Second
+
+// image verification results
+const (
+	IMAGE_OK = iota
+	IMAGE_DEAD
+	IMAGE_UNKNOWN
+)
+
+// checkImage - HEAD request for the image URL
+func checkImage(imageUrl string) (int, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), VERIFY_TIMEOUT)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodHead, imageUrl, nil)
+	if err != nil {
+		return IMAGE_UNKNOWN, err
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return IMAGE_UNKNOWN, err
+	}
+	resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return IMAGE_OK, nil
+	case resp.StatusCode == http.StatusNotFound || resp.StatusCode == http.StatusGone:
+		return IMAGE_DEAD, nil
+	default:
+		return IMAGE_UNKNOWN, &httpStatusError{resp.StatusCode, resp.Status}
+	}
+}
+
+// verifyImages - HEAD-check a sample (limit < 0 = all) of the referenced images,
+// re-download live images missing in the cache and drop dead links from the goods
+func verifyImages(goods []Goods, limit int) {
+	seen := make(map[string]bool)
+	var imageUrls []string
+	for _, item := range goods {
+		if item.ImageUrl == "" || strings.Contains(item.ImageUrl, "no_discounts") || seen[item.ImageUrl] {
+			continue
+		}
+		seen[item.ImageUrl] = true
+		imageUrls = append(imageUrls, item.ImageUrl)
+	}
+	rand.Shuffle(len(imageUrls), func(i, j int) {
+		imageUrls[i], imageUrls[j] = imageUrls[j], imageUrls[i]
+	})
+	if limit > 0 && limit < len(imageUrls) {
+		imageUrls = imageUrls[:limit]
+	}
+
+	var mutex sync.Mutex
+	var wg sync.WaitGroup
+	dead := make(map[string]bool)
+	unknown, repaired := 0, 0
+	slots := make(chan struct{}, config.Threads)
+	for _, imageUrl := range imageUrls {
+		wg.Add(1)
+		slots <- struct{}{}
+		go func() {
+			defer wg.Done()
+			defer func() { <-slots }()
+			status, err := checkImage(imageUrl)
+			missing := false
+			if status == IMAGE_OK {
+				if cachedImageFile(imageUrl) == "" {
+					missing = true
+					if err := saveImageToCache(context.Background(), imageUrl, nil); err != nil {
+						log.Printf("[%s] 💥 error downloading image: %v", imageUrl, err)
+						missing = false
+					}
+				}
+			}
+			mutex.Lock()
+			defer mutex.Unlock()
+			switch status {
+			case IMAGE_DEAD:
+				log.Printf("🖼️ %sdead image%s %s", ColorRed, ColorReset, imageUrl)
+				dead[imageUrl] = true
+			case IMAGE_UNKNOWN:
+				log.Printf("🖼️ [%s] 💥 image check failed: %v", imageUrl, err)
+				unknown++
+			case IMAGE_OK:
+				if missing {
+					repaired++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// dead links mean no image
+	for i := range goods {
+		if dead[goods[i].ImageUrl] {
+			goods[i].ImageUrl = ""
+		}
+	}
+
+	log.Printf("🖼️ verified %d images: %d dead, %d unknown, %d re-downloaded",
+		len(imageUrls), len(dead), unknown, repaired)
+}
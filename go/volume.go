@@ -0,0 +1,116 @@
+package main
+
+import (
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// normalized units of the parsed volumes
+const (
+	UNIT_KG    = "kg"
+	UNIT_L     = "l"
+	UNIT_PIECE = "ks"
+	UNIT_M     = "m"
+)
+
+// [pack count ×] amount unit, e.g. "0,5 l", "4×100 g", "24x 0,5 l"
+var reVolume = regexp.MustCompile(`^(?:(\d+)\s*[xX\x{00D7}]\s*)?(\d+(?:[.,]\d+)?)\s*(\pL+)`)
+
+// pack count × amount unit within a name, e.g. "Pivo Radegast 6x 0,5 l"
+var reMultipack = regexp.MustCompile(`(\d+)\s*[xX\x{00D7}]\s*(\d+(?:[.,]\d+)?)\s*(\pL+)`)
+
+// volume units and their size in the normalized unit
+var volumeUnits = map[string]struct {
+	unit   string
+	factor float64
+}{
+	"g":      {UNIT_KG, 0.001},
+	"dkg":    {UNIT_KG, 0.01},
+	"kg":     {UNIT_KG, 1},
+	"ml":     {UNIT_L, 0.001},
+	"cl":     {UNIT_L, 0.01},
+	"dl":     {UNIT_L, 0.1},
+	"l":      {UNIT_L, 1},
+	"ks":     {UNIT_PIECE, 1},
+	"kus":    {UNIT_PIECE, 1},
+	"kusy":   {UNIT_PIECE, 1},
+	"kusů":   {UNIT_PIECE, 1},
+	"pcs":    {UNIT_PIECE, 1},
+	"tbl":    {UNIT_PIECE, 1},
+	"tablet": {UNIT_PIECE, 1},
+	"cm":     {UNIT_M, 0.01},
+	"m":      {UNIT_M, 1},
+}
+
+// packVolume - parsed volume, count pieces of the size each
+type packVolume struct {
+	count int     // pieces in the pack, 1 for a single piece
+	piece float64 // size of a piece in the unit
+	unit  string  // normalized unit: kg, l, ks, m
+}
+
+// total - quantity of the whole pack
+func (v packVolume) total() float64 {
+	return roundQuantity(float64(v.count) * v.piece)
+}
+
+// parseVolume - volume in the normalized unit (kg, l, ks, m), false for unknown volumes
+func parseVolume(volume string) (packVolume, bool) {
+	return volumeOf(reVolume.FindStringSubmatch(strings.TrimSpace(volume)))
+}
+
+// parseMultipack - multipack notation within a text like the name, false without one
+func parseMultipack(text string) (packVolume, bool) {
+	return volumeOf(reMultipack.FindStringSubmatch(text))
+}
+
+// volumeOf - volume of the [count, amount, unit] match
+func volumeOf(m []string) (packVolume, bool) {
+	if m == nil {
+		return packVolume{}, false
+	}
+	u, ok := volumeUnits[strings.ToLower(m[3])]
+	if !ok {
+		return packVolume{}, false
+	}
+	amount, err := strconv.ParseFloat(strings.Replace(m[2], ",", ".", 1), 64)
+	if err != nil || amount <= 0 {
+		return packVolume{}, false
+	}
+	count := 1
+	if m[1] != "" {
+		count, _ = strconv.Atoi(m[1])
+		count = max(count, 1)
+	}
+	return packVolume{count, roundQuantity(amount * u.factor), u.unit}, true
+}
+
+// roundQuantity - no float noise like 0.30000000000000004
+func roundQuantity(v float64) float64 {
+	return math.Round(v*1e6) / 1e6
+}
+
+// setVolumeValues - parse the volume text into the quantity and pack fields, multipacks are found in the name too
+func setVolumeValues(item *Goods) {
+	volume, ok := parseVolume(item.Volume)
+	if multipack, found := parseMultipack(item.Name); found && (!ok || volume.count == 1 && multipack.unit == volume.unit &&
+		volume.total() == multipack.total()) {
+		volume, ok = multipack, true // "Pivo 6x 0,5 l" with the volume "?" or "3 l"
+	}
+	if !ok {
+		item.Quantity, item.Unit, item.PackCount, item.PieceQuantity = 0, "", 0, 0
+		return
+	}
+	item.Quantity, item.Unit = volume.total(), volume.unit
+	item.PackCount, item.PieceQuantity = volume.count, volume.piece
+}
+
+// formatQuantity - quantity for the CSV, "" for an unknown volume
+func formatQuantity(v float64) string {
+	if v == 0 {
+		return ""
+	}
+	return strconv.FormatFloat(v, 'f', -1, 64)
+}
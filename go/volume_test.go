@@ -0,0 +1,35 @@
+package main
+
+import "testing"
+
+func TestSetVolumeValues(t *testing.T) {
+	tests := []struct {
+		name, volume string
+		quantity     float64
+		unit         string
+		count        int
+		piece        float64
+	}{
+		{"Mléko", "1 l", 1, UNIT_L, 1, 1},
+		{"Pivo", "0,5 l", 0.5, UNIT_L, 1, 0.5},
+		{"Cola", "330 ml", 0.33, UNIT_L, 1, 0.33},
+		{"Jogurt", "4×100 g", 0.4, UNIT_KG, 4, 0.1},
+		{"Pivo", "24x 0,5 l", 12, UNIT_L, 24, 0.5},
+		{"Šunka", "10 dkg", 0.1, UNIT_KG, 1, 0.1},
+		{"Vajíčka", "10 ks", 10, UNIT_PIECE, 1, 10},
+		{"Alobal", "30 m", 30, UNIT_M, 1, 30},
+		{"Pivo Radegast 6x 0,5 l", "?", 3, UNIT_L, 6, 0.5}, // the multipack of the name
+		{"Pivo Radegast 6x 0,5 l", "3 l", 3, UNIT_L, 6, 0.5},
+		{"Pivo Radegast 6x 0,5 l", "1 l", 1, UNIT_L, 1, 1}, // a different volume wins
+		{"Káva", "1 balení", 0, "", 0, 0},
+		{"Káva", "", 0, "", 0, 0},
+	}
+	for _, tt := range tests {
+		item := Goods{Name: tt.name, Volume: tt.volume, Quantity: 99, Unit: "x", PackCount: 99, PieceQuantity: 99}
+		setVolumeValues(&item)
+		if item.Quantity != tt.quantity || item.Unit != tt.unit || item.PackCount != tt.count || item.PieceQuantity != tt.piece {
+			t.Errorf("%q %q: got %g %s %d×%g, want %g %s %d×%g", tt.name, tt.volume,
+				item.Quantity, item.Unit, item.PackCount, item.PieceQuantity, tt.quantity, tt.unit, tt.count, tt.piece)
+		}
+	}
+}
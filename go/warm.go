@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+	"math/rand"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+const WARM_DELAY = 30 * time.Second
+
+// runWarm - slowly download all uncached pages of the input CSV, no extraction
+func runWarm(args []string) error {
+	flags := flag.NewFlagSet("warm", flag.ExitOnError)
+	delay := flags.Duration("delay", WARM_DELAY, "pause between downloads, plus up to 50% jitter")
+	limit := flags.Int("limit", 0, "download at most N pages, 0 = all")
+	parseInterspersed(flags, args)
+	if *delay <= 0 {
+		return errors.New("--delay must be positive")
+	}
+
+	if !checkLock() {
+		return errors.New("locked")
+	}
+	defer unlockLock()
+
+	UA, err := setupRun()
+	if err != nil {
+		return err
+	}
+	defer saveCookies(httpClient)
+	defer closeHtmlCache()
+
+	jobs, err := loadJobs(config.InputCsv)
+	if err != nil {
+		return err
+	}
+	rand.Shuffle(len(jobs), func(i, j int) {
+		jobs[i], jobs[j] = jobs[j], jobs[i]
+	})
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
+	cached, fetched, failed := 0, 0, 0
+	for _, job := range jobs {
+		if *limit > 0 && fetched+failed >= *limit {
+			break
+		}
+		if _, _, err := loadHtmlFromCache(job.cacheKey); err == nil {
+			cached++
+			continue
+		}
+		if _, _, err := loadHtmlFromCache(mobileCacheName(job.cacheKey)); err == nil {
+			cached++
+			continue
+		}
+		if fetched+failed > 0 {
+			pause := *delay + time.Duration(rand.Int63n(int64(*delay)/2+1))
+			if !sleepContext(ctx, pause) {
+				break
+			}
+		}
+
+		qlog := newQueryLogger(job.query, 1)
+		fetchTime := time.Now()
+		body, header, attempt, err := fetchPageWithRetries(ctx, UA, job.url, job.cacheKey, job.query, qlog)
+		if err != nil {
+			if ctx.Err() != nil {
+				break
+			}
+			qlog.Printf("💥 %v", err)
+			recordFailedJob(job, err, attempt)
+			failed++
+		} else {
+			stats.networkPage(job.query)
+			stats.bytes.Add(int64(len(body)))
+			torRotate(qlog)
+			saveHtmlToCache(job.cacheKey, newCacheMeta(job.url, job.query, header, fetchTime), body, qlog)
+			fetched++
+		}
+		log.Printf("🔥 %d/%d pages warm", cached+fetched, len(jobs))
+	}
+
+	if ctx.Err() != nil {
+		log.Println("🤯 interrupted")
+	}
+	log.Printf("🔥 warm-up done: %d already cached, %d downloaded (%s), %d failed", cached, fetched, formatBytes(stats.bytes.Load()), failed)
+	saveFailedJobs(statePath(config.FailedUrlsFile))
+	return nil
+}
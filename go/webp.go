@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/chai2010/webp"
+)
+
+const WEBP_QUALITY = 80
+
+// webpName - name of the WebP variant of the image file
+func webpName(fileName string) string {
+	return strings.TrimSuffix(fileName, filepath.Ext(fileName)) + ".webp"
+}
+
+// ensureWebp - encode the WebP variant of the cached image, content-addressed files never change
+func ensureWebp(fileName string) error {
+	switch strings.ToLower(filepath.Ext(fileName)) {
+	case ".png", ".jpg", ".jpeg", ".gif":
+	default:
+		return nil
+	}
+	srcPath := filepath.Join(config.ImageCache, fileName)
+	dstPath := filepath.Join(config.ImageCache, webpName(fileName))
+	if _, err := os.Stat(dstPath); err == nil {
+		return nil
+	}
+
+	file, err := os.Open(srcPath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	img, _, err := image.Decode(file)
+	if err != nil {
+		return fmt.Errorf("decoding %s: %w", fileName, err)
+	}
+	var buf bytes.Buffer
+	if err := webp.Encode(&buf, img, &webp.Options{Quality: config.WebpQuality, Lossless: config.WebpLossless}); err != nil {
+		return fmt.Errorf("encoding %s: %w", webpName(fileName), err)
+	}
+	return writeFileAtomic(dstPath, buf.Bytes())
+}
@@ -0,0 +1,230 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	XLSX_SHEET_NAME_MAX = 31 // Excel limit
+	XLSX_WIDTH_MIN      = 8  // column widths in characters
+	XLSX_WIDTH_MAX      = 60
+	XLSX_OTHER_SHEET    = "Ostatní" // offers without a category
+
+	// cell styles of xlsxStyles
+	XLSX_STYLE_HEADER = 1
+	XLSX_STYLE_PRICE  = 2
+)
+
+// xlsxColumn - column of the sheets, the value is a string or a float64 (0 = empty cell)
+type xlsxColumn struct {
+	header string
+	value  func(item Goods) any
+}
+
+// columns of the category sheets, readable without the other outputs
+var xlsxColumns = []xlsxColumn{
+	{"Name", func(item Goods) any { return item.Name }},
+	{"Brand", func(item Goods) any { return item.Brand }},
+	{"Volume", func(item Goods) any { return item.Volume }},
+	{"Price", func(item Goods) any { return item.PriceValue }},
+	{"Price per unit", func(item Goods) any { return item.PricePerUnitValue }},
+	{"Unit", func(item Goods) any { return item.Unit }},
+	{"Discount", func(item Goods) any { return item.Discount }},
+	{"Market", func(item Goods) any { return item.Market }},
+	{"Validity", func(item Goods) any { return item.Validity }},
+	{"Club", func(item Goods) any { return item.Club }},
+	{"Note", func(item Goods) any { return item.Note }},
+	{"Url", func(item Goods) any { return item.Url }},
+}
+
+const xlsxContentTypes = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Types xmlns="http://schemas.openxmlformats.org/package/2006/content-types">
+<Default Extension="rels" ContentType="application/vnd.openxmlformats-package.relationships+xml"/>
+<Default Extension="xml" ContentType="application/xml"/>
+<Override PartName="/xl/workbook.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.sheet.main+xml"/>
+<Override PartName="/xl/styles.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.styles+xml"/>
+%s</Types>`
+
+const xlsxRootRels = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">
+<Relationship Id="rId1" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/officeDocument" Target="xl/workbook.xml"/>
+</Relationships>`
+
+// bold header, prices with 2 decimals
+const xlsxStyles = `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>
+<styleSheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">
+<fonts count="2"><font><sz val="11"/><name val="Calibri"/></font><font><b/><sz val="11"/><name val="Calibri"/></font></fonts>
+<fills count="2"><fill><patternFill patternType="none"/></fill><fill><patternFill patternType="gray125"/></fill></fills>
+<borders count="1"><border><left/><right/><top/><bottom/><diagonal/></border></borders>
+<cellStyleXfs count="1"><xf numFmtId="0" fontId="0" fillId="0" borderId="0"/></cellStyleXfs>
+<cellXfs count="3"><xf numFmtId="0" fontId="0" fillId="0" borderId="0" xfId="0"/><xf numFmtId="0" fontId="1" fillId="0" borderId="0" xfId="0" applyFont="1"/><xf numFmtId="2" fontId="0" fillId="0" borderId="0" xfId="0" applyNumberFormat="1"/></cellXfs>
+</styleSheet>`
+
+// xlsxSheet - one category
+type xlsxSheet struct {
+	name  string
+	goods []Goods
+}
+
+// writeXlsx - save the goods to an Excel workbook, one sheet per category with a frozen header row
+func writeXlsx(snap *outputSnapshot, filename string) error {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	sheets := xlsxSheets(snap.Goods)
+
+	var overrides, workbookSheets, workbookRels strings.Builder
+	for i, sheet := range sheets {
+		fmt.Fprintf(&overrides, `<Override PartName="/xl/worksheets/sheet%d.xml" ContentType="application/vnd.openxmlformats-officedocument.spreadsheetml.worksheet+xml"/>`+"\n", i+1)
+		fmt.Fprintf(&workbookSheets, `<sheet name="%s" sheetId="%d" r:id="rId%d"/>`, xmlEscape(sheet.name), i+1, i+1)
+		fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/worksheet" Target="worksheets/sheet%d.xml"/>`+"\n", i+1, i+1)
+	}
+	fmt.Fprintf(&workbookRels, `<Relationship Id="rId%d" Type="http://schemas.openxmlformats.org/officeDocument/2006/relationships/styles" Target="styles.xml"/>`+"\n", len(sheets)+1)
+
+	parts := []struct{ name, content string }{
+		{"[Content_Types].xml", fmt.Sprintf(xlsxContentTypes, overrides.String())},
+		{"_rels/.rels", xlsxRootRels},
+		{"xl/workbook.xml", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<workbook xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main" xmlns:r="http://schemas.openxmlformats.org/officeDocument/2006/relationships"><sheets>` +
+			workbookSheets.String() + `</sheets></workbook>`},
+		{"xl/_rels/workbook.xml.rels", `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+			`<Relationships xmlns="http://schemas.openxmlformats.org/package/2006/relationships">` + "\n" + workbookRels.String() + `</Relationships>`},
+		{"xl/styles.xml", xlsxStyles},
+	}
+	for i, sheet := range sheets {
+		parts = append(parts, struct{ name, content string }{fmt.Sprintf("xl/worksheets/sheet%d.xml", i+1), xlsxSheetXml(sheet.goods)})
+	}
+	for _, part := range parts {
+		w, err := zw.Create(part.name)
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write([]byte(part.content)); err != nil {
+			return err
+		}
+	}
+	if err := zw.Close(); err != nil {
+		return err
+	}
+	return writeFileAtomic(filename, buf.Bytes())
+}
+
+// xlsxSheets - the goods by category in the collation order, an empty sheet for no goods
+func xlsxSheets(goods []Goods) []xlsxSheet {
+	byCategory := make(map[string][]Goods)
+	var categories []string
+	for _, item := range goods {
+		if _, ok := byCategory[item.Category]; !ok {
+			categories = append(categories, item.Category)
+		}
+		byCategory[item.Category] = append(byCategory[item.Category], item)
+	}
+	newCollator().SortStrings(categories)
+
+	var sheets []xlsxSheet
+	used := make(map[string]bool)
+	for _, category := range categories {
+		name := xlsxSheetName(category)
+		base := name
+		for n := 2; used[strings.ToLower(name)]; n++ {
+			suffix := fmt.Sprintf(" (%d)", n)
+			name = truncateRunes(base, XLSX_SHEET_NAME_MAX-len(suffix)) + suffix
+		}
+		used[strings.ToLower(name)] = true
+		sheets = append(sheets, xlsxSheet{name, byCategory[category]})
+	}
+	if len(sheets) == 0 {
+		sheets = append(sheets, xlsxSheet{XLSX_OTHER_SHEET, nil})
+	}
+	return sheets
+}
+
+// xlsxSheetName - category as a valid sheet name
+func xlsxSheetName(category string) string {
+	name := strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return ' '
+		}
+		return r
+	}, category)
+	name = strings.Trim(strings.TrimSpace(name), "'")
+	if name == "" {
+		return XLSX_OTHER_SHEET
+	}
+	return truncateRunes(name, XLSX_SHEET_NAME_MAX)
+}
+
+// truncateRunes - first n runes of s
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
+
+// xlsxSheetXml - worksheet with the header row frozen and the columns sized by their longest value
+func xlsxSheetXml(goods []Goods) string {
+	widths := make([]int, len(xlsxColumns))
+	var rows strings.Builder
+	rows.WriteString(`<row r="1">`)
+	for col, column := range xlsxColumns {
+		rows.WriteString(xlsxCell(col, 1, column.header, XLSX_STYLE_HEADER))
+		widths[col] = utf8.RuneCountInString(column.header)
+	}
+	rows.WriteString("</row>")
+	for i, item := range goods {
+		row := i + 2
+		fmt.Fprintf(&rows, `<row r="%d">`, row)
+		for col, column := range xlsxColumns {
+			switch v := column.value(item).(type) {
+			case string:
+				if v != "" {
+					rows.WriteString(xlsxCell(col, row, v, 0))
+				}
+				widths[col] = max(widths[col], utf8.RuneCountInString(v))
+			case float64:
+				if v != 0 {
+					fmt.Fprintf(&rows, `<c r="%s%d" s="%d"><v>%s</v></c>`, xlsxColumnName(col), row, XLSX_STYLE_PRICE, strconv.FormatFloat(v, 'f', -1, 64))
+				}
+				widths[col] = max(widths[col], len(strconv.FormatFloat(v, 'f', 2, 64)))
+			}
+		}
+		rows.WriteString("</row>")
+	}
+
+	var cols strings.Builder
+	for col, width := range widths {
+		width = min(max(width+2, XLSX_WIDTH_MIN), XLSX_WIDTH_MAX)
+		fmt.Fprintf(&cols, `<col min="%d" max="%d" width="%d" customWidth="1"/>`, col+1, col+1, width)
+	}
+	return `<?xml version="1.0" encoding="UTF-8" standalone="yes"?>` + "\n" +
+		`<worksheet xmlns="http://schemas.openxmlformats.org/spreadsheetml/2006/main">` +
+		`<sheetViews><sheetView workbookViewId="0"><pane ySplit="1" topLeftCell="A2" activePane="bottomLeft" state="frozen"/></sheetView></sheetViews>` +
+		`<cols>` + cols.String() + `</cols><sheetData>` + rows.String() + `</sheetData></worksheet>`
+}
+
+// xlsxCell - inline string cell
+func xlsxCell(col int, row int, value string, style int) string {
+	return fmt.Sprintf(`<c r="%s%d" s="%d" t="inlineStr"><is><t xml:space="preserve">%s</t></is></c>`, xlsxColumnName(col), row, style, xmlEscape(value))
+}
+
+// xlsxColumnName - A, B, ... Z, AA, ... of the 0-based column
+func xlsxColumnName(col int) string {
+	name := ""
+	for col++; col > 0; col = (col - 1) / 26 {
+		name = string(rune('A'+(col-1)%26)) + name
+	}
+	return name
+}
+
+// xmlEscape - text escaped for XML, invalid characters are replaced
+func xmlEscape(s string) string {
+	var buf strings.Builder
+	xml.EscapeText(&buf, []byte(s))
+	return buf.String()
+}
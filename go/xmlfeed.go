@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"reflect"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	XML_ROOT    = "offers"
+	XML_ELEMENT = "offer"
+	XML_ITEM    = "item" // elements of the lists
+	OUTPUT_XML  = "koopi.xml"
+)
+
+// valid names of the root and offer elements
+var reXmlName = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_.-]*$`)
+
+// appendToXml - save the offers of the flat layout as an XML feed, the child elements are named like the JSON fields
+func appendToXml(snap *outputSnapshot, filename string) error {
+	items, _ := outputItems(snap.Goods)
+
+	file, err := os.OpenFile(filename, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	w.WriteString(xml.Header)
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	root := xml.StartElement{Name: xml.Name{Local: config.XmlRoot}, Attr: []xml.Attr{
+		{Name: xml.Name{Local: "version"}, Value: strconv.Itoa(JSON_OUTPUT_VERSION)},
+		{Name: xml.Name{Local: "created"}, Value: time.Now().Format(time.RFC3339)},
+		{Name: xml.Name{Local: "count"}, Value: strconv.Itoa(len(items))},
+	}}
+	if err := enc.EncodeToken(root); err != nil {
+		return err
+	}
+	for _, item := range items {
+		if err := encodeXmlValue(enc, config.XmlElement, reflect.ValueOf(item)); err != nil {
+			return err
+		}
+	}
+	if err := enc.EncodeToken(root.End()); err != nil {
+		return err
+	}
+	if err := enc.Flush(); err != nil {
+		return err
+	}
+	w.WriteString("\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	return file.Close()
+}
+
+// xmlFeedCount - count attribute of the root element, 0 if missing
+func xmlFeedCount(content []byte) int {
+	dec := xml.NewDecoder(bytes.NewReader(content))
+	for {
+		token, err := dec.Token()
+		if err != nil {
+			return 0
+		}
+		if root, ok := token.(xml.StartElement); ok {
+			for _, attr := range root.Attr {
+				if attr.Name.Local == "count" {
+					count, _ := strconv.Atoi(attr.Value)
+					return count
+				}
+			}
+			return 0
+		}
+	}
+}
+
+// encodeXmlValue - element of the value, unknown (nil) and omitted empty fields have no element
+func encodeXmlValue(enc *xml.Encoder, name string, v reflect.Value) error {
+	start := xml.StartElement{Name: xml.Name{Local: name}}
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.IsNil() {
+			return nil
+		}
+		return encodeXmlValue(enc, name, v.Elem())
+	case reflect.Struct:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		if err := encodeXmlFields(enc, v); err != nil {
+			return err
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Slice:
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		for i := range v.Len() {
+			if err := encodeXmlValue(enc, XML_ITEM, v.Index(i)); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	case reflect.Map:
+		// map keys are free text, e.g. the computed fields, so they go to the name attribute
+		if err := enc.EncodeToken(start); err != nil {
+			return err
+		}
+		keys := v.MapKeys()
+		slices.SortFunc(keys, func(a, b reflect.Value) int { return strings.Compare(fmt.Sprint(a), fmt.Sprint(b)) })
+		for _, key := range keys {
+			item := xml.StartElement{Name: xml.Name{Local: XML_ITEM}, Attr: []xml.Attr{{Name: xml.Name{Local: "name"}, Value: fmt.Sprint(key)}}}
+			if err := enc.EncodeElement(xmlText(v.MapIndex(key)), item); err != nil {
+				return err
+			}
+		}
+		return enc.EncodeToken(start.End())
+	}
+	return enc.EncodeElement(xmlText(v), start)
+}
+
+// encodeXmlFields - child elements of the exported fields by their JSON names, the embedded structs are inlined
+func encodeXmlFields(enc *xml.Encoder, v reflect.Value) error {
+	for i := range v.NumField() {
+		field := v.Type().Field(i)
+		tag := field.Tag.Get("json")
+		if field.Anonymous && tag == "" {
+			if err := encodeXmlFields(enc, v.Field(i)); err != nil {
+				return err
+			}
+			continue
+		}
+		if !field.IsExported() || tag == "-" {
+			continue
+		}
+		name, options, _ := strings.Cut(tag, ",")
+		if (strings.Contains(options, "omitempty") || strings.Contains(options, "omitzero")) && v.Field(i).IsZero() {
+			continue
+		}
+		if err := encodeXmlValue(enc, name, v.Field(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// xmlText - text of a scalar value, numbers like in the JSON output
+func xmlText(v reflect.Value) string {
+	switch v.Kind() {
+	case reflect.Float32, reflect.Float64:
+		return strconv.FormatFloat(v.Float(), 'f', -1, 64)
+	}
+	return fmt.Sprint(v.Interface())
+}